@@ -0,0 +1,231 @@
+package gose
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// JWT access token header types as specified in https://tools.ietf.org/html/rfc9068#section-2.1
+const (
+	AccessTokenType      string = "at+jwt"
+	AccessTokenMediaType string = "application/at+jwt"
+)
+
+// Number of random bytes in a generated JWT ID
+const jtiByteLen = 16
+
+// JWT access token claim names as specified in https://tools.ietf.org/html/rfc9068#section-2.2
+const (
+	ClaimClientId     string = "client_id"
+	ClaimScope        string = "scope"
+	ClaimGroups       string = "groups"
+	ClaimRoles        string = "roles"
+	ClaimEntitlements string = "entitlements"
+)
+
+// ScopeSet is a set of OAuth 2.0 scope values (https://tools.ietf.org/html/rfc6749#section-3.3)
+type ScopeSet map[string]struct{}
+
+// ParseScope parses a space delimited scope string into a set
+func ParseScope(scope string) ScopeSet {
+	s := make(ScopeSet)
+	for _, v := range strings.Fields(scope) {
+		s[v] = struct{}{}
+	}
+	return s
+}
+
+// Contains returns true if the scope value is in the set
+func (s ScopeSet) Contains(scope string) bool {
+	_, ok := s[scope]
+	return ok
+}
+
+// ContainsAll returns true if all the scope values are in the set
+func (s ScopeSet) ContainsAll(scopes ...string) bool {
+	for _, v := range scopes {
+		if !s.Contains(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the scope values sorted and space delimited
+func (s ScopeSet) String() string {
+	scopes := make([]string, 0, len(s))
+	for k := range s {
+		scopes = append(scopes, k)
+	}
+	sort.Strings(scopes)
+	return strings.Join(scopes, " ")
+}
+
+// AccessToken is a JWT access token as specified in https://tools.ietf.org/html/rfc9068. When signing, the typed
+// fields take precedence over the corresponding claims in Claims.
+type AccessToken struct {
+	// Header is the protected header of a parsed access token
+	Header *JwHeader
+	// Claims holds the registered claims (iss, exp, aud, sub, iat, jti) and any additional claims
+	Claims *ClaimSet
+	// ClientId is the client the token was issued to (client_id)
+	ClientId string
+	// Scope is the set of scopes granted (scope)
+	Scope ScopeSet
+	// Groups, Roles and Entitlements are the optional authorization attributes of
+	// https://tools.ietf.org/html/rfc9068#section-2.2.3.1
+	Groups       []string
+	Roles        []string
+	Entitlements []string
+}
+
+// SignAccessToken signs the access token with key and returns the compact serialized JWT with typ "at+jwt". The iss,
+// exp, aud, sub and client_id claims are required. If not set, iat is set to the current time and jti to a random
+// value.
+func SignAccessToken(at *AccessToken, key *Jwk, opts *JwtSignOptions) (string, error) {
+	c := new(ClaimSet)
+	if at.Claims != nil {
+		*c = *at.Claims
+	}
+
+	c.AdditionalClaims = make(map[string]interface{}, len(c.AdditionalClaims)+5)
+	if at.Claims != nil {
+		for k, v := range at.Claims.AdditionalClaims {
+			c.AdditionalClaims[k] = v
+		}
+	}
+
+	if at.ClientId != "" {
+		c.AdditionalClaims[ClaimClientId] = at.ClientId
+	}
+	if len(at.Scope) > 0 {
+		c.AdditionalClaims[ClaimScope] = at.Scope.String()
+	}
+	if len(at.Groups) > 0 {
+		c.AdditionalClaims[ClaimGroups] = at.Groups
+	}
+	if len(at.Roles) > 0 {
+		c.AdditionalClaims[ClaimRoles] = at.Roles
+	}
+	if len(at.Entitlements) > 0 {
+		c.AdditionalClaims[ClaimEntitlements] = at.Entitlements
+	}
+
+	if c.IssuedAt.IsZero() {
+		c.IssuedAt = time.Now()
+	}
+	if c.Id == "" {
+		jti, err := randomJti()
+		if err != nil {
+			return "", err
+		}
+		c.Id = jti
+	}
+
+	for _, name := range accessTokenRequiredClaims {
+		if !c.HasClaim(name) {
+			return "", fmt.Errorf("Access token claim %s is required", name)
+		}
+	}
+
+	o := JwtSignOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	o.Type = AccessTokenType
+
+	return SignJwt(c, key, &o)
+}
+
+// Claims that must be present in a JWT access token
+var accessTokenRequiredClaims = []string{ClaimIssuer, ClaimExpiration, ClaimAudience, ClaimSubject, ClaimClientId,
+	ClaimIssuedAt, ClaimId}
+
+// AccessTokenValidator validates JWT access tokens as specified in https://tools.ietf.org/html/rfc9068#section-4.
+// Set Issuers to the authorization server's issuer. Audiences must be set to the resource server's identifiers, so
+// that tokens issued for other resource servers are rejected.
+type AccessTokenValidator struct {
+	Validator
+	// RequiredScopes are the scopes the access token must have been granted
+	RequiredScopes []string
+}
+
+// ValidateClaims validates the required access token claims, their types and the required scopes, returning
+// ClaimErrors or nil
+func (v *AccessTokenValidator) ValidateClaims(c *ClaimSet) error {
+	if len(v.Audiences) < 1 {
+		return errors.New("AccessTokenValidator requires the accepted audiences")
+	}
+
+	errs := v.Validator.validate(c)
+	errs = v.requireClaims(c, errs, accessTokenRequiredClaims...)
+
+	if _, _, err := c.stringClaim(ClaimClientId); err != nil {
+		errs = append(errs, &ClaimError{ClaimClientId, err})
+	}
+
+	scope, _, err := c.stringClaim(ClaimScope)
+	if err != nil {
+		errs = append(errs, &ClaimError{ClaimScope, err})
+	} else if scopes := ParseScope(scope); !scopes.ContainsAll(v.RequiredScopes...) {
+		errs = append(errs, &ClaimError{ClaimScope, fmt.Errorf("Scope (%s) doesn't contain the required scopes %v", scope, v.RequiredScopes)})
+	}
+
+	for _, name := range []string{ClaimGroups, ClaimRoles, ClaimEntitlements} {
+		if _, _, err := c.stringsClaim(name); err != nil {
+			errs = append(errs, &ClaimError{name, err})
+		}
+	}
+
+	return v.checkReplay(c, errs)
+}
+
+// ParseAccessToken parses a compact serialized JWT access token, verifies its signature with the key resolved by ks
+// and validates it with v. Tokens without the "at+jwt" type (typ) are rejected, so that other JWTs signed by the same
+// key, such as ID Tokens, can't be used as access tokens.
+func ParseAccessToken(token string, ks KeySource, v *AccessTokenValidator, opts ...SignerOption) (*AccessToken, error) {
+	if v == nil {
+		return nil, errors.New("An AccessTokenValidator is required to validate an access token")
+	}
+
+	jwt, err := parseJwtPayload(token, ks, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.EqualFold(jwt.Header.Type, AccessTokenType) && !strings.EqualFold(jwt.Header.Type, AccessTokenMediaType) {
+		return nil, fmt.Errorf("JWT type (typ=%s) is not an access token (%s)", jwt.Header.Type, AccessTokenType)
+	}
+
+	claims := new(ClaimSet)
+	if err := claims.UnmarshalJSON(jwt.Payload); err != nil {
+		return nil, err
+	}
+	if err := v.ValidateClaims(claims); err != nil {
+		return nil, err
+	}
+
+	at := &AccessToken{Header: jwt.Header, Claims: claims}
+	at.ClientId, _, _ = claims.stringClaim(ClaimClientId)
+	scope, _, _ := claims.stringClaim(ClaimScope)
+	at.Scope = ParseScope(scope)
+	at.Groups, _, _ = claims.stringsClaim(ClaimGroups)
+	at.Roles, _, _ = claims.stringsClaim(ClaimRoles)
+	at.Entitlements, _, _ = claims.stringsClaim(ClaimEntitlements)
+
+	return at, nil
+}
+
+// Returns a random, base64url encoded JWT ID
+func randomJti() (string, error) {
+	b := make([]byte, jtiByteLen)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
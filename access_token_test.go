@@ -0,0 +1,122 @@
+package gose
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestScopeSet(t *testing.T) {
+	s := ParseScope(" read  write\tadmin ")
+	if len(s) != 3 || !s.ContainsAll("read", "write", "admin") || s.Contains("delete") {
+		t.Errorf("Unexpected scope set: %v\n", s)
+	}
+	if s.String() != "admin read write" {
+		t.Errorf("Unexpected scope string: %s\n", s.String())
+	}
+}
+
+func TestSignAndParseAccessToken(t *testing.T) {
+	key := new(Jwk)
+	if err := json.Unmarshal(jwaSignerTestVectors[1].signKeyJson, key); err != nil {
+		t.Fatalf("Unable to unmarshal key. Err: %v\n", err)
+	}
+
+	at := &AccessToken{
+		Claims: &ClaimSet{
+			Issuer:     "https://as.example.com",
+			Subject:    "5ba552d67",
+			Audience:   []string{"https://rs.example.com"},
+			Expiration: time.Now().Add(time.Hour),
+		},
+		ClientId: "s6BhdRkqt3",
+		Scope:    ParseScope("openid profile reademail"),
+		Roles:    []string{"admin"},
+	}
+
+	token, err := SignAccessToken(at, key, &JwtSignOptions{Algorithm: JwsAlgES256})
+	if err != nil {
+		t.Fatalf("Unable to sign access token. Err: %v\n", err)
+	}
+
+	v := &AccessTokenValidator{
+		Validator:      Validator{Issuers: []string{"https://as.example.com"}, Audiences: []string{"https://rs.example.com"}},
+		RequiredScopes: []string{"reademail"},
+	}
+	parsed, err := ParseAccessToken(token, key, v)
+	if err != nil {
+		t.Fatalf("Unable to parse access token. Err: %v\n", err)
+	}
+
+	if parsed.Header.Type != AccessTokenType || parsed.ClientId != at.ClientId || parsed.Claims.Id == "" ||
+		parsed.Claims.IssuedAt.IsZero() || !reflect.DeepEqual(parsed.Roles, at.Roles) || parsed.Groups != nil {
+		t.Errorf("Access token doesn't match. Got: %+v\n", parsed)
+	}
+	if !reflect.DeepEqual(parsed.Scope, at.Scope) {
+		t.Errorf("Scope doesn't match. Expected: %v, Got: %v\n", at.Scope, parsed.Scope)
+	}
+
+	v.RequiredScopes = []string{"writeemail"}
+	if _, err := ParseAccessToken(token, key, v); err == nil {
+		t.Errorf("Access token without the required scope was accepted\n")
+	}
+
+	// A JWT with the same claims but without the at+jwt type, e.g. an ID Token, must be rejected
+	v.RequiredScopes = nil
+	jwt, err := SignJwt(parsed.Claims, key, &JwtSignOptions{Algorithm: JwsAlgES256})
+	if err != nil {
+		t.Fatalf("Unable to sign jwt. Err: %v\n", err)
+	}
+	if _, err := ParseAccessToken(jwt, key, v); err == nil {
+		t.Errorf("JWT with typ %s was accepted as an access token\n", JwtType)
+	}
+
+	at.Claims.Subject = ""
+	if _, err := SignAccessToken(at, key, &JwtSignOptions{Algorithm: JwsAlgES256}); err == nil {
+		t.Errorf("Access token without a subject was signed\n")
+	}
+}
+
+func TestAccessTokenValidator(t *testing.T) {
+	base := func() *ClaimSet {
+		return &ClaimSet{
+			Issuer:     "iss",
+			Subject:    "sub",
+			Audience:   []string{"aud"},
+			Id:         "jti",
+			Expiration: time.Now().Add(time.Hour),
+			IssuedAt:   time.Now(),
+			AdditionalClaims: map[string]interface{}{
+				ClaimClientId: "client",
+				ClaimGroups:   []interface{}{"a", "b"},
+			},
+		}
+	}
+
+	vectors := []struct {
+		name   string
+		modify func(c *ClaimSet)
+		ok     bool
+	}{
+		{"Valid", func(c *ClaimSet) {}, true},
+		{"Missing client_id", func(c *ClaimSet) { delete(c.AdditionalClaims, ClaimClientId) }, false},
+		{"Missing jti", func(c *ClaimSet) { c.Id = "" }, false},
+		{"Wrong client_id type", func(c *ClaimSet) { c.AdditionalClaims[ClaimClientId] = 1.0 }, false},
+		{"Wrong groups type", func(c *ClaimSet) { c.AdditionalClaims[ClaimGroups] = "a" }, false},
+		{"Wrong scope type", func(c *ClaimSet) { c.AdditionalClaims[ClaimScope] = []interface{}{"a"} }, false},
+	}
+
+	v := &AccessTokenValidator{Validator: Validator{Audiences: []string{"aud"}}}
+	for i, vec := range vectors {
+		c := base()
+		vec.modify(c)
+		if err := v.ValidateClaims(c); (err == nil) != vec.ok {
+			t.Errorf("Test %d (%s). Unexpected result. Err: %v\n", i+1, vec.name, err)
+		}
+	}
+
+	if err := new(AccessTokenValidator).ValidateClaims(base()); err == nil {
+		t.Errorf("Access token was accepted without audiences to check\n")
+	}
+}
@@ -0,0 +1,347 @@
+package gose
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// Delegation claim names as specified in https://tools.ietf.org/html/rfc8693#section-4
+const (
+	ClaimActor  string = "act"
+	ClaimMayAct string = "may_act"
+)
+
+// Default maximum number of actors in an actor chain
+const defaultMaxActorDepth = 5
+
+// Default lifetime of a created delegated token
+const defaultDelegatedTokenLifetime = 5 * time.Minute
+
+// Actor identifies a party in an actor (act) or authorized actor (may_act) claim, see
+// https://tools.ietf.org/html/rfc8693#section-4.1. Prior actors in a delegation chain are nested in Actor.
+type Actor struct {
+	// Subject identifies the actor (sub)
+	Subject string
+	// Issuer is the issuer of the actor's subject identifier (iss)
+	Issuer string
+	// AdditionalClaims are any other claims identifying the actor, such as client_id
+	AdditionalClaims map[string]interface{}
+	// Actor is the prior actor (act), or nil
+	Actor *Actor
+}
+
+// MarshalJSON implements the json.Marshaler interface
+func (a *Actor) MarshalJSON() ([]byte, error) {
+	obj := make(map[string]interface{}, len(a.AdditionalClaims)+3)
+	for k, v := range a.AdditionalClaims {
+		obj[k] = v
+	}
+	delete(obj, ClaimSubject)
+	delete(obj, ClaimIssuer)
+	delete(obj, ClaimActor)
+
+	if a.Subject != "" {
+		obj[ClaimSubject] = a.Subject
+	}
+	if a.Issuer != "" {
+		obj[ClaimIssuer] = a.Issuer
+	}
+	if a.Actor != nil {
+		obj[ClaimActor] = a.Actor
+	}
+
+	return json.Marshal(obj)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface
+func (a *Actor) UnmarshalJSON(data []byte) error {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+
+	*a = Actor{}
+	if v, ok := obj[ClaimSubject]; ok {
+		if err := json.Unmarshal(v, &a.Subject); err != nil {
+			return fmt.Errorf("Actor claim %s must be a string", ClaimSubject)
+		}
+		delete(obj, ClaimSubject)
+	}
+	if v, ok := obj[ClaimIssuer]; ok {
+		if err := json.Unmarshal(v, &a.Issuer); err != nil {
+			return fmt.Errorf("Actor claim %s must be a string", ClaimIssuer)
+		}
+		delete(obj, ClaimIssuer)
+	}
+	if v, ok := obj[ClaimActor]; ok {
+		if err := json.Unmarshal(v, &a.Actor); err != nil {
+			return err
+		}
+		delete(obj, ClaimActor)
+	}
+
+	if len(obj) > 0 {
+		a.AdditionalClaims = make(map[string]interface{}, len(obj))
+		for k, v := range obj {
+			var val interface{}
+			if err := json.Unmarshal(v, &val); err != nil {
+				return err
+			}
+			a.AdditionalClaims[k] = val
+		}
+	}
+
+	return nil
+}
+
+// Chain returns the actor chain, starting with this (the current) actor followed by the prior actors
+func (a *Actor) Chain() []*Actor {
+	var chain []*Actor
+	for v := a; v != nil; v = v.Actor {
+		chain = append(chain, v)
+	}
+	return chain
+}
+
+// Authorizes returns true if the authorized actor (may_act) identifies actor: every claim of the authorized actor
+// (ignoring prior actors) must have the same value in actor. An authorized actor without any claims authorizes no one.
+func (a *Actor) Authorizes(actor *Actor) bool {
+	if actor == nil || (a.Subject == "" && a.Issuer == "" && len(a.AdditionalClaims) == 0) {
+		return false
+	}
+	if a.Subject != "" && a.Subject != actor.Subject {
+		return false
+	}
+	if a.Issuer != "" && a.Issuer != actor.Issuer {
+		return false
+	}
+	for k, v := range a.AdditionalClaims {
+		if av, ok := actor.AdditionalClaims[k]; !ok || !reflect.DeepEqual(normalizeClaimValue(av), normalizeClaimValue(v)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns a copy of the actor without prior actors
+func (a *Actor) withoutPrior() *Actor {
+	cp := *a
+	cp.Actor = nil
+	return &cp
+}
+
+// Actor returns the actor (act) claim, or nil if the claim set has none
+func (c *ClaimSet) Actor() (*Actor, error) {
+	return c.actorClaim(ClaimActor)
+}
+
+// SetActor sets the actor (act) claim, or removes it if act is nil
+func (c *ClaimSet) SetActor(act *Actor) error {
+	return c.setActorClaim(ClaimActor, act)
+}
+
+// MayAct returns the authorized actor (may_act) claim, or nil if the claim set has none
+func (c *ClaimSet) MayAct() (*Actor, error) {
+	return c.actorClaim(ClaimMayAct)
+}
+
+// SetMayAct sets the authorized actor (may_act) claim, or removes it if mayAct is nil
+func (c *ClaimSet) SetMayAct(mayAct *Actor) error {
+	return c.setActorClaim(ClaimMayAct, mayAct)
+}
+
+func (c *ClaimSet) actorClaim(name string) (*Actor, error) {
+	v, ok := c.AdditionalClaims[name]
+	if !ok {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	a := new(Actor)
+	if err := json.Unmarshal(data, a); err != nil {
+		return nil, fmt.Errorf("Invalid %s claim: %v", name, err)
+	}
+
+	return a, nil
+}
+
+func (c *ClaimSet) setActorClaim(name string, a *Actor) error {
+	if a == nil {
+		delete(c.AdditionalClaims, name)
+		return nil
+	}
+
+	data, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	var v map[string]interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	} else if len(v) == 0 {
+		return fmt.Errorf("The %s claim must identify the actor", name)
+	}
+
+	if c.AdditionalClaims == nil {
+		c.AdditionalClaims = make(map[string]interface{})
+	}
+	c.AdditionalClaims[name] = v
+
+	return nil
+}
+
+// DelegationValidator validates the delegation claims of a JWT (https://tools.ietf.org/html/rfc8693#section-4), as
+// well as its registered claims. Every actor in the chain must be identified by at least one claim.
+type DelegationValidator struct {
+	Validator
+	// MaxDepth is the maximum number of actors in the actor chain. Defaults to 5.
+	MaxDepth int
+	// RequireActor rejects tokens without an actor (act), i.e. tokens that aren't delegated
+	RequireActor bool
+	// RequireMayAct rejects delegated tokens without an authorized actor (may_act). If a token has both, the current
+	// actor must always be authorized by may_act.
+	RequireMayAct bool
+}
+
+// ValidateClaims validates the claims and the actor chain, returning ClaimErrors or nil
+func (v *DelegationValidator) ValidateClaims(c *ClaimSet) error {
+	errs := v.Validator.validate(c)
+
+	act, err := c.Actor()
+	if err != nil {
+		errs = append(errs, &ClaimError{ClaimActor, err})
+	} else if act == nil && v.RequireActor {
+		errs = append(errs, &ClaimError{ClaimActor, errors.New("Required claim is missing")})
+	} else if act != nil {
+		chain := act.Chain()
+		if len(chain) > v.maxDepth() {
+			errs = append(errs, &ClaimError{ClaimActor, fmt.Errorf("Actor chain is longer than %d actors", v.maxDepth())})
+		}
+		for i, a := range chain {
+			if a.Subject == "" && a.Issuer == "" && len(a.AdditionalClaims) == 0 {
+				errs = append(errs, &ClaimError{ClaimActor, fmt.Errorf("Actor %d of the chain isn't identified by any claim", i+1)})
+			}
+		}
+	}
+
+	mayAct, err := c.MayAct()
+	if err != nil {
+		errs = append(errs, &ClaimError{ClaimMayAct, err})
+	} else if act != nil && mayAct == nil && v.RequireMayAct {
+		errs = append(errs, &ClaimError{ClaimMayAct, errors.New("Required claim is missing")})
+	} else if act != nil && mayAct != nil && !mayAct.Authorizes(act) {
+		errs = append(errs, &ClaimError{ClaimMayAct, errors.New("The current actor is not authorized to act for the subject")})
+	}
+
+	return v.checkReplay(c, errs)
+}
+
+func (v *DelegationValidator) maxDepth() int {
+	if v.MaxDepth > 0 {
+		return v.MaxDepth
+	}
+	return defaultMaxActorDepth
+}
+
+// DelegationOptions configures how a delegated token is created
+type DelegationOptions struct {
+	// Audience is the audience of the new token
+	Audience []string
+	// Lifetime is the time until the token expires. Defaults to 5 minutes, and never exceeds the subject token's exp.
+	Lifetime time.Duration
+	// Clock returns the current time. If nil, time.Now is used.
+	Clock func() time.Time
+	// MaxDepth is the maximum number of actors in the new token's actor chain. Defaults to 5.
+	MaxDepth int
+	// RequireMayAct refuses to delegate if the subject token has no authorized actor (may_act). If it has one, the
+	// actor must always be authorized by it.
+	RequireMayAct bool
+	// Claims are additional claims to include in the token
+	Claims map[string]interface{}
+	// SignOptions configures the signature
+	SignOptions *JwtSignOptions
+}
+
+// NewDelegatedToken creates a token exchange (https://tools.ietf.org/html/rfc8693) result token issued by issuer for
+// the subject of the verified subject token claims. With an actor, the token is a delegation token whose act claim
+// is the actor, with the subject token's actor chain nested as its prior actors. Without an actor, the token
+// impersonates the subject and keeps the subject token's actor chain, if any.
+func NewDelegatedToken(issuer string, subject *ClaimSet, actor *Actor, key *Jwk, opts *DelegationOptions) (string, error) {
+	if issuer == "" || subject == nil || subject.Subject == "" {
+		return "", errors.New("A delegated token requires an issuer and a subject token with a subject")
+	}
+	if opts == nil {
+		opts = &DelegationOptions{}
+	}
+
+	prior, err := subject.Actor()
+	if err != nil {
+		return "", err
+	}
+
+	act := prior
+	if actor != nil {
+		mayAct, err := subject.MayAct()
+		if err != nil {
+			return "", err
+		} else if mayAct == nil && opts.RequireMayAct {
+			return "", errors.New("The subject token doesn't authorize any actor (may_act)")
+		} else if mayAct != nil && !mayAct.Authorizes(actor) {
+			return "", errors.New("The actor is not authorized to act for the subject (may_act)")
+		}
+
+		act = actor.withoutPrior()
+		act.Actor = prior
+	}
+
+	maxDepth := opts.MaxDepth
+	if maxDepth <= 0 {
+		maxDepth = defaultMaxActorDepth
+	}
+	if act != nil && len(act.Chain()) > maxDepth {
+		return "", fmt.Errorf("Actor chain would be longer than %d actors", maxDepth)
+	}
+
+	now := time.Now()
+	if opts.Clock != nil {
+		now = opts.Clock()
+	}
+	lifetime := opts.Lifetime
+	if lifetime <= 0 {
+		lifetime = defaultDelegatedTokenLifetime
+	}
+	exp := now.Add(lifetime)
+	if !subject.Expiration.IsZero() && subject.Expiration.Before(exp) {
+		exp = subject.Expiration
+	}
+
+	jti, err := randomJti()
+	if err != nil {
+		return "", err
+	}
+
+	claims := &ClaimSet{
+		Issuer:           issuer,
+		Subject:          subject.Subject,
+		Audience:         opts.Audience,
+		Id:               jti,
+		IssuedAt:         now,
+		Expiration:       exp,
+		AdditionalClaims: make(map[string]interface{}, len(opts.Claims)+1),
+	}
+	for k, v := range opts.Claims {
+		claims.AdditionalClaims[k] = v
+	}
+	delete(claims.AdditionalClaims, ClaimMayAct)
+	if err := claims.SetActor(act); err != nil {
+		return "", err
+	}
+
+	return SignJwt(claims, key, opts.SignOptions)
+}
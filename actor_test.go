@@ -0,0 +1,192 @@
+package gose
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestClaimSetActor(t *testing.T) {
+	// https://tools.ietf.org/html/rfc8693#section-4.1
+	data := []byte(`{"aud":"https://consumer.example.com","iss":"https://issuer.example.com","exp":1443904177,` +
+		`"nbf":1443904077,"sub":"user@example.com","act":{"sub":"https://service16.example.com",` +
+		`"act":{"sub":"https://service77.example.com","client_id":"s6BhdRkqt3"}},"may_act":{"sub":"admin@example.com"}}`)
+
+	c := new(ClaimSet)
+	if err := json.Unmarshal(data, c); err != nil {
+		t.Fatalf("Unable to unmarshal claims. Err: %v\n", err)
+	}
+	act, err := c.Actor()
+	if err != nil || act == nil {
+		t.Fatalf("Unable to get actor. Err: %v\n", err)
+	}
+	chain := act.Chain()
+	if len(chain) != 2 || chain[0].Subject != "https://service16.example.com" ||
+		chain[1].Subject != "https://service77.example.com" || chain[1].AdditionalClaims["client_id"] != "s6BhdRkqt3" {
+		t.Errorf("Unexpected actor chain: %+v\n", chain)
+	}
+	mayAct, err := c.MayAct()
+	if err != nil || mayAct == nil || mayAct.Subject != "admin@example.com" {
+		t.Errorf("Unexpected may_act: %+v. Err: %v\n", mayAct, err)
+	}
+
+	// Round trip
+	other := new(ClaimSet)
+	if err := other.SetActor(act); err != nil {
+		t.Fatalf("Unable to set actor. Err: %v\n", err)
+	}
+	out, _ := json.Marshal(other)
+	parsed := new(ClaimSet)
+	if err := json.Unmarshal(out, parsed); err != nil {
+		t.Fatalf("Unable to unmarshal claims. Err: %v\n", err)
+	}
+	if a, _ := parsed.Actor(); a == nil || len(a.Chain()) != 2 || a.Actor.AdditionalClaims["client_id"] != "s6BhdRkqt3" {
+		t.Errorf("Actor doesn't round trip: %s\n", out)
+	}
+
+	if err := other.SetMayAct(&Actor{}); err == nil {
+		t.Errorf("may_act without any claims was set\n")
+	}
+	other.SetActor(nil)
+	if other.HasClaim(ClaimActor) {
+		t.Errorf("Actor wasn't removed\n")
+	}
+
+	bad := &ClaimSet{AdditionalClaims: map[string]interface{}{ClaimActor: map[string]interface{}{"sub": 42}}}
+	if _, err := bad.Actor(); err == nil {
+		t.Errorf("Actor with a numeric subject was accepted\n")
+	}
+}
+
+func TestActorAuthorizes(t *testing.T) {
+	actor := &Actor{Subject: "admin@example.com", Issuer: "https://issuer.example.com",
+		AdditionalClaims: map[string]interface{}{"client_id": "s6BhdRkqt3"}}
+
+	vectors := []struct {
+		name   string
+		mayAct *Actor
+		ok     bool
+	}{
+		{"Subject", &Actor{Subject: "admin@example.com"}, true},
+		{"Subject and issuer", &Actor{Subject: "admin@example.com", Issuer: "https://issuer.example.com"}, true},
+		{"Client id", &Actor{AdditionalClaims: map[string]interface{}{"client_id": "s6BhdRkqt3"}}, true},
+		{"Other subject", &Actor{Subject: "mallory@example.com"}, false},
+		{"Other issuer", &Actor{Subject: "admin@example.com", Issuer: "https://other.example.com"}, false},
+		{"Missing claim", &Actor{Subject: "admin@example.com", AdditionalClaims: map[string]interface{}{"tenant": "acme"}}, false},
+		{"Empty", &Actor{}, false},
+	}
+	for i, v := range vectors {
+		if v.mayAct.Authorizes(actor) != v.ok {
+			t.Errorf("Test %d (%s). Expected %v\n", i+1, v.name, v.ok)
+		}
+	}
+}
+
+func TestDelegationValidator(t *testing.T) {
+	chain := func(n int) *Actor {
+		var a *Actor
+		for i := 0; i < n; i++ {
+			a = &Actor{Subject: "service" + string(rune('a'+i)), Actor: a}
+		}
+		return a
+	}
+	claims := func(act *Actor, mayAct *Actor) *ClaimSet {
+		c := &ClaimSet{Subject: "user@example.com"}
+		if act != nil {
+			c.SetActor(act)
+		}
+		if mayAct != nil {
+			c.SetMayAct(mayAct)
+		}
+		return c
+	}
+	unidentified := &ClaimSet{AdditionalClaims: map[string]interface{}{ClaimActor: map[string]interface{}{"act": map[string]interface{}{}}}}
+
+	vectors := []struct {
+		name string
+		c    *ClaimSet
+		v    *DelegationValidator
+		ok   bool
+	}{
+		{"No actor", claims(nil, nil), &DelegationValidator{}, true},
+		{"Actor required", claims(nil, nil), &DelegationValidator{RequireActor: true}, false},
+		{"Chain", claims(chain(3), nil), &DelegationValidator{RequireActor: true}, true},
+		{"Default max depth", claims(chain(6), nil), &DelegationValidator{}, false},
+		{"Max depth", claims(chain(3), nil), &DelegationValidator{MaxDepth: 2}, false},
+		{"Unidentified actor", unidentified, &DelegationValidator{}, false},
+		{"Authorized actor", claims(chain(2), &Actor{Subject: "serviceb"}), &DelegationValidator{RequireMayAct: true}, true},
+		{"Unauthorized actor", claims(chain(2), &Actor{Subject: "servicea"}), &DelegationValidator{}, false},
+		{"may_act required", claims(chain(2), nil), &DelegationValidator{RequireMayAct: true}, false},
+	}
+
+	for i, v := range vectors {
+		if err := v.v.ValidateClaims(v.c); (err == nil) != v.ok {
+			t.Errorf("Test %d (%s). Unexpected result. Err: %v\n", i+1, v.name, err)
+		}
+	}
+}
+
+func TestNewDelegatedToken(t *testing.T) {
+	key := new(Jwk)
+	if err := json.Unmarshal(jwaSignerTestVectors[1].signKeyJson, key); err != nil {
+		t.Fatalf("Unable to unmarshal key. Err: %v\n", err)
+	}
+	opts := &DelegationOptions{Audience: []string{"https://backend.example.com"}, SignOptions: &JwtSignOptions{Algorithm: JwsAlgES256}}
+	v := &DelegationValidator{Validator: Validator{Audiences: []string{"https://backend.example.com"}}, RequireActor: true}
+
+	subject := &ClaimSet{Issuer: "https://as.example.com", Subject: "user@example.com", Expiration: time.Now().Add(time.Minute)}
+	subject.SetMayAct(&Actor{Subject: "https://frontend.example.com"})
+
+	// The frontend exchanges the user's token to call the middle tier
+	token, err := NewDelegatedToken("https://as.example.com", subject, &Actor{Subject: "https://frontend.example.com"}, key, opts)
+	if err != nil {
+		t.Fatalf("Unable to create delegated token. Err: %v\n", err)
+	}
+	c, err := ParseAndVerifyJwt(token, key, v)
+	if err != nil {
+		t.Fatalf("Unable to parse delegated token. Err: %v\n", err)
+	}
+	if c.Subject != "user@example.com" || c.HasClaim(ClaimMayAct) || !c.Expiration.Equal(subject.Expiration.Truncate(time.Second)) {
+		t.Errorf("Unexpected claims: %+v\n", c)
+	}
+
+	// The middle tier exchanges it again, nesting the frontend as the prior actor
+	token, err = NewDelegatedToken("https://as.example.com", c, &Actor{Subject: "https://middle.example.com"}, key, opts)
+	if err != nil {
+		t.Fatalf("Unable to create delegated token. Err: %v\n", err)
+	}
+	c, err = ParseAndVerifyJwt(token, key, v)
+	if err != nil {
+		t.Fatalf("Unable to parse delegated token. Err: %v\n", err)
+	}
+	act, _ := c.Actor()
+	if chain := act.Chain(); len(chain) != 2 || chain[0].Subject != "https://middle.example.com" ||
+		chain[1].Subject != "https://frontend.example.com" {
+		t.Errorf("Unexpected actor chain: %+v\n", chain)
+	}
+
+	// Impersonation keeps the actor chain
+	token, _ = NewDelegatedToken("https://as.example.com", c, nil, key, opts)
+	if imp, err := ParseAndVerifyJwt(token, key, v); err != nil {
+		t.Errorf("Unable to parse impersonation token. Err: %v\n", err)
+	} else if a, _ := imp.Actor(); a == nil || len(a.Chain()) != 2 {
+		t.Errorf("Impersonation token doesn't keep the actor chain: %+v\n", imp)
+	}
+
+	invalid := []struct {
+		name    string
+		subject *ClaimSet
+		actor   *Actor
+		opts    *DelegationOptions
+	}{
+		{"Not authorized by may_act", subject, &Actor{Subject: "https://mallory.example.com"}, opts},
+		{"No may_act", &ClaimSet{Subject: "user@example.com"}, &Actor{Subject: "a"}, &DelegationOptions{RequireMayAct: true}},
+		{"Max depth", c, &Actor{Subject: "https://backend.example.com"}, &DelegationOptions{MaxDepth: 2}},
+		{"No subject", &ClaimSet{}, &Actor{Subject: "a"}, opts},
+	}
+	for i, vec := range invalid {
+		if _, err := NewDelegatedToken("https://as.example.com", vec.subject, vec.actor, key, vec.opts); err == nil {
+			t.Errorf("Test %d (%s). Delegated token was created\n", i+1, vec.name)
+		}
+	}
+}
@@ -0,0 +1,425 @@
+package gose
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ClaimRuleOp is the operator of a ClaimRule
+type ClaimRuleOp string
+
+// Claim rule operators. Where a claim is used as a list (contains, anyOf and allOf), a JSON array is used as is and a
+// string is treated as a space delimited list, like scope.
+const (
+	// ClaimRuleExists matches if the claim is present and not null
+	ClaimRuleExists ClaimRuleOp = "exists"
+	// ClaimRuleEquals matches if the claim equals the value
+	ClaimRuleEquals ClaimRuleOp = "eq"
+	// ClaimRuleContains matches if the claim (as a list) contains the value
+	ClaimRuleContains ClaimRuleOp = "contains"
+	// ClaimRuleAnyOf matches if the claim, or any element of the claim as a list, is one of the values (a list)
+	ClaimRuleAnyOf ClaimRuleOp = "anyOf"
+	// ClaimRuleAllOf matches if the claim (as a list) contains all the values (a list)
+	ClaimRuleAllOf ClaimRuleOp = "allOf"
+	// ClaimRuleRegex matches if the claim is a string that matches the value, a regular expression
+	ClaimRuleRegex ClaimRuleOp = "regex"
+	// ClaimRuleGreaterThan matches if the claim is a number greater than the value
+	ClaimRuleGreaterThan ClaimRuleOp = "gt"
+	// ClaimRuleLessThan matches if the claim is a number less than the value
+	ClaimRuleLessThan ClaimRuleOp = "lt"
+)
+
+// ClaimRule is a declarative check on a claim set. A rule is either a comparison of the claim at Path using Op and
+// Value, or combines other rules with exactly one of And, Or or Not. Rules can be JSON encoded, for example:
+//
+//	{"or": [
+//	  {"path": "realm_access.roles", "op": "contains", "value": "admin"},
+//	  {"and": [
+//	    {"path": "scope", "op": "allOf", "value": ["read", "write"]},
+//	    {"not": {"path": "/tenant", "op": "regex", "value": "^test-"}}
+//	  ]}
+//	]}
+//
+// Paths are either dotted (realm_access.roles) or JSON Pointers (https://tools.ietf.org/html/rfc6901), which must be
+// used for claim names that contain dots. Array elements are selected by their index. ClaimRule implements the
+// ClaimValidator interface.
+type ClaimRule struct {
+	Path  string       `json:"path,omitempty"`
+	Op    ClaimRuleOp  `json:"op,omitempty"`
+	Value interface{}  `json:"value,omitempty"`
+	And   []*ClaimRule `json:"and,omitempty"`
+	Or    []*ClaimRule `json:"or,omitempty"`
+	Not   *ClaimRule   `json:"not,omitempty"`
+	re    *regexp.Regexp
+}
+
+// ParseClaimRule JSON decodes a claim rule and compiles it
+func ParseClaimRule(data []byte) (*ClaimRule, error) {
+	r := new(ClaimRule)
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil, err
+	}
+	if err := r.Compile(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Compile checks that the rule and its nested rules are well formed, and compiles their regular expressions. Rules
+// that aren't compiled are checked (and their regular expressions compiled) every time they are used.
+func (r *ClaimRule) Compile() error {
+	if err := r.validate(); err != nil {
+		return err
+	}
+	for _, sub := range r.subRules() {
+		if err := sub.Compile(); err != nil {
+			return err
+		}
+	}
+	if r.Op == ClaimRuleRegex {
+		r.re, _ = r.regexp()
+	}
+	return nil
+}
+
+// ValidateClaims checks the claim set against the rule. If the rule doesn't match, ClaimErrors describe the rules
+// that failed and why. Other errors are returned for malformed rules.
+func (r *ClaimRule) ValidateClaims(c *ClaimSet) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+
+	if err := r.validate(); err != nil {
+		return err
+	}
+	return r.check(doc).err()
+}
+
+// String returns a readable description of the rule
+func (r *ClaimRule) String() string {
+	switch {
+	case r.Not != nil:
+		return "NOT " + r.Not.String()
+	case len(r.And) > 0:
+		return joinClaimRules(r.And, " AND ")
+	case len(r.Or) > 0:
+		return joinClaimRules(r.Or, " OR ")
+	case r.Op == ClaimRuleExists:
+		return r.Path + " exists"
+	default:
+		value, _ := json.Marshal(r.Value)
+		return fmt.Sprintf("%s %s %s", r.Path, r.Op, value)
+	}
+}
+
+func joinClaimRules(rules []*ClaimRule, sep string) string {
+	s := make([]string, len(rules))
+	for i, v := range rules {
+		s[i] = v.String()
+	}
+	return "(" + strings.Join(s, sep) + ")"
+}
+
+// Checks that the rule and its nested rules are well formed: each has exactly one of a comparison, And, Or and Not
+func (r *ClaimRule) validate() error {
+	kinds := 0
+	if r.Op != "" || r.Path != "" {
+		kinds++
+	}
+	if len(r.And) > 0 {
+		kinds++
+	}
+	if len(r.Or) > 0 {
+		kinds++
+	}
+	if r.Not != nil {
+		kinds++
+	}
+	if kinds != 1 {
+		return errors.New("Claim rule must have exactly one of a comparison (path and op), and, or and not")
+	}
+	for _, sub := range r.subRules() {
+		if sub == nil {
+			return errors.New("Claim rule contains a nil rule")
+		} else if err := sub.validate(); err != nil {
+			return err
+		}
+	}
+	if r.Op == "" && r.Path == "" {
+		return nil
+	}
+
+	if _, err := parseClaimPath(r.Path); err != nil {
+		return err
+	}
+
+	switch r.Op {
+	case ClaimRuleExists:
+	case ClaimRuleEquals, ClaimRuleContains:
+		if r.Value == nil {
+			return fmt.Errorf("Claim rule %s requires a value", r.Op)
+		}
+	case ClaimRuleAnyOf, ClaimRuleAllOf:
+		if _, ok := normalizeClaimValue(r.Value).([]interface{}); !ok {
+			return fmt.Errorf("Claim rule %s requires a list of values", r.Op)
+		}
+	case ClaimRuleRegex:
+		if _, ok := r.Value.(string); !ok {
+			return errors.New("Claim rule regex requires a regular expression string")
+		} else if _, err := r.regexp(); err != nil {
+			return err
+		}
+	case ClaimRuleGreaterThan, ClaimRuleLessThan:
+		if _, ok := normalizeClaimValue(r.Value).(float64); !ok {
+			return fmt.Errorf("Claim rule %s requires a number", r.Op)
+		}
+	default:
+		return fmt.Errorf("Unknown claim rule operator: %s", r.Op)
+	}
+	return nil
+}
+
+func (r *ClaimRule) subRules() []*ClaimRule {
+	rules := append(append([]*ClaimRule{}, r.And...), r.Or...)
+	if r.Not != nil {
+		rules = append(rules, r.Not)
+	}
+	return rules
+}
+
+func (r *ClaimRule) regexp() (*regexp.Regexp, error) {
+	if r.re != nil {
+		return r.re, nil
+	}
+	re, err := regexp.Compile(r.Value.(string))
+	if err != nil {
+		return nil, fmt.Errorf("Claim rule %s has an invalid regular expression: %v", r.Path, err)
+	}
+	return re, nil
+}
+
+// Returns the name reported in a ClaimError: the path of a comparison, or the description of a combined rule
+func (r *ClaimRule) claimName() string {
+	if r.Path != "" {
+		return r.Path
+	}
+	return r.String()
+}
+
+// Checks the validated rule against the JSON decoded claim set, returning the failed rules
+func (r *ClaimRule) check(doc interface{}) ClaimErrors {
+	switch {
+	case len(r.And) > 0:
+		var errs ClaimErrors
+		for _, sub := range r.And {
+			errs = append(errs, sub.check(doc)...)
+		}
+		return errs
+	case len(r.Or) > 0:
+		var reasons []string
+		for _, sub := range r.Or {
+			subErrs := sub.check(doc)
+			if len(subErrs) == 0 {
+				return nil
+			}
+			for _, e := range subErrs {
+				reasons = append(reasons, e.Err.Error())
+			}
+		}
+		return ClaimErrors{&ClaimError{r.claimName(), fmt.Errorf("None of the rules matched: %s", strings.Join(reasons, "; "))}}
+	case r.Not != nil:
+		if len(r.Not.check(doc)) == 0 {
+			return ClaimErrors{&ClaimError{r.Not.claimName(), fmt.Errorf("%s: rule must not match", r)}}
+		}
+		return nil
+	}
+
+	if reason := r.compare(doc); reason != "" {
+		return ClaimErrors{&ClaimError{r.Path, fmt.Errorf("%s: %s", r, reason)}}
+	}
+	return nil
+}
+
+// Compares the claim at the rule's path. An empty string is returned if it matches, otherwise the reason it doesn't.
+func (r *ClaimRule) compare(doc interface{}) string {
+	segments, _ := parseClaimPath(r.Path)
+	claim, ok := resolveClaimPath(doc, segments)
+	if !ok || claim == nil {
+		return "claim is missing"
+	}
+
+	value := normalizeClaimValue(r.Value)
+
+	switch r.Op {
+	case ClaimRuleExists:
+		return ""
+	case ClaimRuleEquals:
+		if !claimValuesEqual(claim, value) {
+			return "claim doesn't equal the value"
+		}
+	case ClaimRuleContains:
+		if !claimListContains(claimList(claim), value) {
+			return "claim doesn't contain the value"
+		}
+	case ClaimRuleAnyOf:
+		values := value.([]interface{})
+		if claimListContains(values, claim) {
+			return ""
+		}
+		for _, v := range claimList(claim) {
+			if claimListContains(values, v) {
+				return ""
+			}
+		}
+		return "claim isn't any of the values"
+	case ClaimRuleAllOf:
+		list := claimList(claim)
+		for _, v := range value.([]interface{}) {
+			if !claimListContains(list, v) {
+				return fmt.Sprintf("claim doesn't contain %v", v)
+			}
+		}
+	case ClaimRuleRegex:
+		s, ok := claim.(string)
+		if !ok {
+			return "claim isn't a string"
+		}
+		if re, _ := r.regexp(); !re.MatchString(s) {
+			return "claim doesn't match the regular expression"
+		}
+	case ClaimRuleGreaterThan, ClaimRuleLessThan:
+		n, ok := claim.(float64)
+		if !ok {
+			return "claim isn't a number"
+		}
+		if r.Op == ClaimRuleGreaterThan && !(n > value.(float64)) {
+			return fmt.Sprintf("claim (%v) isn't greater than the value", n)
+		} else if r.Op == ClaimRuleLessThan && !(n < value.(float64)) {
+			return fmt.Sprintf("claim (%v) isn't less than the value", n)
+		}
+	}
+
+	return ""
+}
+
+// Splits a dotted path or JSON Pointer into its segments
+func parseClaimPath(path string) ([]string, error) {
+	if path == "" {
+		return nil, errors.New("Claim rule requires a path")
+	}
+	if !strings.HasPrefix(path, "/") {
+		segments := strings.Split(path, ".")
+		for _, s := range segments {
+			if s == "" {
+				return nil, fmt.Errorf("Claim path %s has an empty segment", path)
+			}
+		}
+		return segments, nil
+	}
+
+	segments := strings.Split(path[1:], "/")
+	for i, s := range segments {
+		if strings.Contains(strings.ReplaceAll(strings.ReplaceAll(s, "~0", ""), "~1", ""), "~") {
+			return nil, fmt.Errorf("JSON Pointer %s has an invalid escape sequence", path)
+		}
+		segments[i] = strings.ReplaceAll(strings.ReplaceAll(s, "~1", "/"), "~0", "~")
+	}
+	return segments, nil
+}
+
+// Returns the value at the path, or false if it doesn't exist
+func resolveClaimPath(doc interface{}, segments []string) (interface{}, bool) {
+	v := doc
+	for _, s := range segments {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			next, ok := node[s]
+			if !ok {
+				return nil, false
+			}
+			v = next
+		case []interface{}:
+			i, err := strconv.Atoi(s)
+			if err != nil || i < 0 || i >= len(node) || strconv.Itoa(i) != s {
+				return nil, false
+			}
+			v = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// Converts numbers to float64 and slices to []interface{}, so that rule values can be compared to JSON decoded claims
+func normalizeClaimValue(v interface{}) interface{} {
+	switch n := v.(type) {
+	case nil, string, bool, float64, map[string]interface{}:
+		return v
+	case json.Number:
+		if f, err := n.Float64(); err == nil {
+			return f
+		}
+		return v
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint())
+	case reflect.Float32:
+		return rv.Float()
+	case reflect.Slice, reflect.Array:
+		list := make([]interface{}, rv.Len())
+		for i := range list {
+			list[i] = normalizeClaimValue(rv.Index(i).Interface())
+		}
+		return list
+	}
+	return v
+}
+
+// Returns the claim as a list: a JSON array, or the fields of a space delimited string
+func claimList(claim interface{}) []interface{} {
+	switch v := claim.(type) {
+	case []interface{}:
+		return v
+	case string:
+		fields := strings.Fields(v)
+		list := make([]interface{}, len(fields))
+		for i, f := range fields {
+			list[i] = f
+		}
+		return list
+	}
+	return []interface{}{claim}
+}
+
+func claimListContains(list []interface{}, v interface{}) bool {
+	for _, e := range list {
+		if claimValuesEqual(e, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func claimValuesEqual(a interface{}, b interface{}) bool {
+	if fa, ok := a.(float64); ok {
+		fb, ok := b.(float64)
+		return ok && fa == fb
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,178 @@
+package gose
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+const claimRuleTestClaims = `{
+	"iss": "https://issuer.example.com",
+	"aud": ["api", "admin-api"],
+	"scope": "openid read write",
+	"tenant": "acme-prod",
+	"level": 3,
+	"realm_access": {"roles": ["user", "admin"]},
+	"https://example.com/groups": ["staff"],
+	"accounts": [{"id": "a1", "balance": 250.5}]
+}`
+
+func TestClaimRule(t *testing.T) {
+	c := new(ClaimSet)
+	if err := json.Unmarshal([]byte(claimRuleTestClaims), c); err != nil {
+		t.Fatalf("Unable to unmarshal claims. Err: %v\n", err)
+	}
+
+	vectors := []struct {
+		name  string
+		rule  *ClaimRule
+		match bool
+	}{
+		{"Exists", &ClaimRule{Path: "tenant", Op: ClaimRuleExists}, true},
+		{"Missing", &ClaimRule{Path: "realm_access.groups", Op: ClaimRuleExists}, false},
+		{"Equals registered claim", &ClaimRule{Path: "iss", Op: ClaimRuleEquals, Value: "https://issuer.example.com"}, true},
+		{"Equals number", &ClaimRule{Path: "level", Op: ClaimRuleEquals, Value: 3}, true},
+		{"Nested contains", &ClaimRule{Path: "realm_access.roles", Op: ClaimRuleContains, Value: "admin"}, true},
+		{"Nested doesn't contain", &ClaimRule{Path: "realm_access.roles", Op: ClaimRuleContains, Value: "root"}, false},
+		{"Audience contains", &ClaimRule{Path: "aud", Op: ClaimRuleContains, Value: "api"}, true},
+		{"Scope all of", &ClaimRule{Path: "scope", Op: ClaimRuleAllOf, Value: []string{"read", "write"}}, true},
+		{"Scope not all of", &ClaimRule{Path: "scope", Op: ClaimRuleAllOf, Value: []string{"read", "delete"}}, false},
+		{"Scope any of", &ClaimRule{Path: "scope", Op: ClaimRuleAnyOf, Value: []string{"delete", "write"}}, true},
+		{"Tenant any of", &ClaimRule{Path: "tenant", Op: ClaimRuleAnyOf, Value: []string{"acme-prod", "acme-test"}}, true},
+		{"Regex", &ClaimRule{Path: "tenant", Op: ClaimRuleRegex, Value: "^acme-"}, true},
+		{"Regex no match", &ClaimRule{Path: "tenant", Op: ClaimRuleRegex, Value: "^globex-"}, false},
+		{"Regex not a string", &ClaimRule{Path: "level", Op: ClaimRuleRegex, Value: "3"}, false},
+		{"Greater than", &ClaimRule{Path: "level", Op: ClaimRuleGreaterThan, Value: 2}, true},
+		{"Not greater than", &ClaimRule{Path: "level", Op: ClaimRuleGreaterThan, Value: 3}, false},
+		{"Array index less than", &ClaimRule{Path: "accounts.0.balance", Op: ClaimRuleLessThan, Value: 1000}, true},
+		{"Array index out of range", &ClaimRule{Path: "accounts.1.balance", Op: ClaimRuleExists}, false},
+		{"JSON Pointer", &ClaimRule{Path: "/https:~1~1example.com~1groups", Op: ClaimRuleContains, Value: "staff"}, true},
+		{"JSON Pointer array", &ClaimRule{Path: "/accounts/0/id", Op: ClaimRuleEquals, Value: "a1"}, true},
+		{
+			"And",
+			&ClaimRule{And: []*ClaimRule{
+				{Path: "realm_access.roles", Op: ClaimRuleContains, Value: "admin"},
+				{Path: "tenant", Op: ClaimRuleRegex, Value: "^acme-"},
+			}},
+			true,
+		},
+		{
+			"And with failure",
+			&ClaimRule{And: []*ClaimRule{
+				{Path: "realm_access.roles", Op: ClaimRuleContains, Value: "admin"},
+				{Path: "level", Op: ClaimRuleGreaterThan, Value: 5},
+			}},
+			false,
+		},
+		{
+			"Or",
+			&ClaimRule{Or: []*ClaimRule{
+				{Path: "level", Op: ClaimRuleGreaterThan, Value: 5},
+				{Path: "scope", Op: ClaimRuleContains, Value: "write"},
+			}},
+			true,
+		},
+		{
+			"Or with failures",
+			&ClaimRule{Or: []*ClaimRule{
+				{Path: "level", Op: ClaimRuleGreaterThan, Value: 5},
+				{Path: "scope", Op: ClaimRuleContains, Value: "delete"},
+			}},
+			false,
+		},
+		{"Not", &ClaimRule{Not: &ClaimRule{Path: "tenant", Op: ClaimRuleRegex, Value: "-test$"}}, true},
+		{"Not matched", &ClaimRule{Not: &ClaimRule{Path: "tenant", Op: ClaimRuleExists}}, false},
+	}
+
+	for i, v := range vectors {
+		err := v.rule.ValidateClaims(c)
+		var errs ClaimErrors
+		if err != nil && !errors.As(err, &errs) {
+			t.Errorf("Test %d (%s). Unexpected error: %v\n", i+1, v.name, err)
+		} else if (err == nil) != v.match {
+			t.Errorf("Test %d (%s). Expected match %v. Err: %v\n", i+1, v.name, v.match, err)
+		}
+	}
+}
+
+func TestClaimRuleErrors(t *testing.T) {
+	c := new(ClaimSet)
+	if err := json.Unmarshal([]byte(claimRuleTestClaims), c); err != nil {
+		t.Fatalf("Unable to unmarshal claims. Err: %v\n", err)
+	}
+
+	rule := &ClaimRule{And: []*ClaimRule{
+		{Path: "realm_access.roles", Op: ClaimRuleContains, Value: "root"},
+		{Path: "tenant", Op: ClaimRuleRegex, Value: "^acme-"},
+		{Path: "level", Op: ClaimRuleLessThan, Value: 2},
+	}}
+	if !claimErrorsMatch(rule.ValidateClaims(c), []string{"realm_access.roles", "level"}) {
+		t.Errorf("Unexpected errors: %v\n", rule.ValidateClaims(c))
+	}
+
+	invalid := []struct {
+		name string
+		rule *ClaimRule
+	}{
+		{"Empty", &ClaimRule{}},
+		{"Comparison and combination", &ClaimRule{Path: "tenant", Op: ClaimRuleExists, Not: &ClaimRule{Path: "iss", Op: ClaimRuleExists}}},
+		{"Unknown operator", &ClaimRule{Path: "tenant", Op: "startsWith", Value: "acme"}},
+		{"No path", &ClaimRule{Op: ClaimRuleExists}},
+		{"Empty path segment", &ClaimRule{Path: "realm_access..roles", Op: ClaimRuleExists}},
+		{"Invalid JSON Pointer", &ClaimRule{Path: "/tenant~2", Op: ClaimRuleExists}},
+		{"Invalid regex", &ClaimRule{Path: "tenant", Op: ClaimRuleRegex, Value: "(acme"}},
+		{"Any of without a list", &ClaimRule{Path: "tenant", Op: ClaimRuleAnyOf, Value: "acme"}},
+		{"Greater than a string", &ClaimRule{Path: "level", Op: ClaimRuleGreaterThan, Value: "2"}},
+		{"Nested invalid rule", &ClaimRule{Or: []*ClaimRule{{Path: "tenant", Op: ClaimRuleExists}, {Op: ClaimRuleEquals}}}},
+	}
+	for i, v := range invalid {
+		if err := v.rule.Compile(); err == nil {
+			t.Errorf("Test %d (%s). Invalid rule was compiled\n", i+1, v.name)
+		}
+		var errs ClaimErrors
+		if err := v.rule.ValidateClaims(c); err == nil || errors.As(err, &errs) {
+			t.Errorf("Test %d (%s). Expected a rule error, got: %v\n", i+1, v.name, err)
+		}
+	}
+}
+
+func TestParseClaimRule(t *testing.T) {
+	rule, err := ParseClaimRule([]byte(`{"or": [
+		{"path": "realm_access.roles", "op": "contains", "value": "admin"},
+		{"and": [
+			{"path": "scope", "op": "allOf", "value": ["read", "write"]},
+			{"not": {"path": "/tenant", "op": "regex", "value": "^test-"}}
+		]}
+	]}`))
+	if err != nil {
+		t.Fatalf("Unable to parse rule. Err: %v\n", err)
+	}
+
+	expected := `(realm_access.roles contains "admin" OR (scope allOf ["read","write"] AND NOT /tenant regex "^test-"))`
+	if rule.String() != expected {
+		t.Errorf("Expected %s, got %s\n", expected, rule.String())
+	}
+
+	vectors := []struct {
+		claims string
+		match  bool
+	}{
+		{`{"realm_access": {"roles": ["admin"]}}`, true},
+		{`{"scope": "read write", "tenant": "acme"}`, true},
+		{`{"scope": "read write", "tenant": "test-1"}`, false},
+		{`{"scope": "read"}`, false},
+	}
+	for i, v := range vectors {
+		c := new(ClaimSet)
+		if err := json.Unmarshal([]byte(v.claims), c); err != nil {
+			t.Fatalf("Test %d. Unable to unmarshal claims. Err: %v\n", i+1, err)
+		}
+		if err := rule.ValidateClaims(c); (err == nil) != v.match {
+			t.Errorf("Test %d. Expected match %v. Err: %v\n", i+1, v.match, err)
+		}
+	}
+
+	if _, err := ParseClaimRule([]byte(`{"path": "tenant", "op": "regex", "value": "["}`)); err == nil {
+		t.Errorf("Rule with an invalid regular expression was parsed\n")
+	}
+}
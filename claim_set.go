@@ -1,11 +1,11 @@
 package gose
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"reflect"
-	"strings"
 	"time"
 )
 
@@ -21,74 +21,110 @@ type ClaimSet struct {
 	AdditionalClaims map[string]interface{} `json:"-"`
 }
 
-// Implements the json.Unmarshaler interface and JSON decodes a JSON representation of the a JWT ClaimSet Set.
-func (c *ClaimSet) UnmarshalJSON(data []byte) (err error) {
-	var obj map[string]json.RawMessage
+// ClaimParseMode selects how ParseClaimSet handles malformed claims
+type ClaimParseMode int
 
-	// Unmarshal into Map of Json.RawMessages. Each key is the JSON field, each value is the
-	// the value of each JSON Field
-	err = json.Unmarshal(data, &obj)
-	if err != nil {
+const (
+	// ClaimParseStrict rejects registered claims of the wrong type (including null dates), out of range dates and
+	// duplicate claim names
+	ClaimParseStrict ClaimParseMode = iota
+	// ClaimParseLenient skips malformed registered claims and tolerates duplicate claim names (the last one wins),
+	// reporting each problem as a warning
+	ClaimParseLenient
+)
 
+// ParseClaimSet JSON decodes a JWT Claim Set using the given mode. In lenient mode, the problems that were tolerated
+// are returned as warnings. In strict mode any problem is returned as an error (ClaimErrors for malformed claims).
+func ParseClaimSet(data []byte, mode ClaimParseMode) (*ClaimSet, ClaimErrors, error) {
+	dups, err := duplicateClaims(data)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	// Check if each member of the ClaimSet struct is present in the obj map. If it is,
-	// then attempt to unmarshal that member. Then, delete the member from obj
-	if v, ok := obj["iss"]; ok {
-		err = json.Unmarshal(v, &c.Issuer)
-		if err != nil {
-
-		}
-		delete(obj, "iss")
+	var problems ClaimErrors
+	for _, name := range dups {
+		problems = append(problems, &ClaimError{name, errors.New("Claim is present more than once")})
 	}
-	if v, ok := obj["sub"]; ok {
-		err = json.Unmarshal(v, &c.Subject)
-		if err != nil {
 
-		}
-		delete(obj, "sub")
+	c := new(ClaimSet)
+	errs, err := c.decode(data, true)
+	if err != nil {
+		return nil, nil, err
 	}
-	if v, ok := obj["aud"]; ok {
-		err = json.Unmarshal(v, &c.Audience)
-		if err != nil {
+	problems = append(problems, errs...)
 
-		}
-		delete(obj, "aud")
+	if mode == ClaimParseLenient {
+		return c, problems, nil
+	} else if len(problems) > 0 {
+		return nil, nil, problems
 	}
-	if v, ok := obj["jti"]; ok {
-		err = json.Unmarshal(v, &c.Id)
-		if err != nil {
 
-		}
-		delete(obj, "jti")
-	}
-	if v, ok := obj["exp"]; ok {
-		var nd NumericDate
-		err = json.Unmarshal(v, &nd)
-		if err != nil {
+	return c, nil, nil
+}
 
-		}
-		c.Expiration = nd.Time
-		delete(obj, "exp")
+// Implements the json.Unmarshaler interface and JSON decodes a JSON representation of the a JWT ClaimSet Set. The
+// audience (aud) may be a string or an array of strings. A registered claim of the wrong type is an error
+// (ClaimErrors). Duplicate claim names are not detected, use ParseClaimSet with ClaimParseStrict for that.
+func (c *ClaimSet) UnmarshalJSON(data []byte) error {
+	errs, err := c.decode(data, false)
+	if err != nil {
+		return err
 	}
-	if v, ok := obj["nbf"]; ok {
-		var nd NumericDate
-		err = json.Unmarshal(v, &nd)
-		if err != nil {
 
-		}
-		c.NotBefore = nd.Time
-		delete(obj, "nbf")
+	return errs.err()
+}
+
+// Decodes the claim set. An error is returned if data isn't a JSON object. Malformed registered claims are returned
+// as ClaimErrors; unless lenient is set, the remaining claims aren't decoded once a claim is malformed.
+func (c *ClaimSet) decode(data []byte, lenient bool) (ClaimErrors, error) {
+	var obj map[string]json.RawMessage
+
+	// Unmarshal into Map of Json.RawMessages. Each key is the JSON field, each value is the
+	// the value of each JSON Field
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	} else if obj == nil {
+		return nil, errors.New("JWT Claim Set must be a JSON object")
 	}
-	if v, ok := obj["iat"]; ok {
-		var nd NumericDate
-		err = json.Unmarshal(v, &nd)
-		if err != nil {
 
+	var errs ClaimErrors
+	var aud Audience
+	var exp, nbf, iat NumericDate
+
+	// Check if each registered claim is present in the obj map. If it is, then attempt to unmarshal it.
+	// Then, delete the member from obj
+	registered := []struct {
+		name string
+		v    interface{}
+	}{
+		{ClaimIssuer, &c.Issuer},
+		{ClaimSubject, &c.Subject},
+		{ClaimAudience, &aud},
+		{ClaimId, &c.Id},
+		{ClaimExpiration, &exp},
+		{ClaimNotBefore, &nbf},
+		{ClaimIssuedAt, &iat},
+	}
+	for _, r := range registered {
+		if v, ok := obj[r.name]; ok {
+			err := json.Unmarshal(v, r.v)
+			// NumericDate ignores null, but a registered date claim must be a number
+			if _, isDate := r.v.(*NumericDate); isDate && bytes.Equal(v, []byte("null")) {
+				err = errors.New("NumericDate must be a JSON number, got: null")
+			}
+			if err != nil {
+				errs = append(errs, &ClaimError{r.name, err})
+				if !lenient {
+					return errs, nil
+				}
+			}
+			delete(obj, r.name)
 		}
-		c.IssuedAt = nd.Time
-		delete(obj, "iat")
 	}
+	c.Audience = aud
+	c.Expiration = exp.Time
+	c.NotBefore = nbf.Time
+	c.IssuedAt = iat.Time
 
 	// Unmarshal remaing JSON k/v pairs into an interface{}
 	if len(obj) > 0 {
@@ -97,15 +133,47 @@ func (c *ClaimSet) UnmarshalJSON(data []byte) (err error) {
 
 		for k, v := range obj {
 			var intfVal interface{}
-			err = json.Unmarshal(v, &intfVal)
-			if err != nil {
-
+			if err := json.Unmarshal(v, &intfVal); err != nil {
+				return nil, err
 			}
 			c.AdditionalClaims[k] = intfVal
 		}
 	}
 
-	return nil
+	return errs, nil
+}
+
+// Returns the names of the top level members that appear more than once in a JSON object
+func duplicateClaims(data []byte) ([]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+
+	if tok, err := dec.Token(); err != nil {
+		return nil, err
+	} else if tok != json.Delim('{') {
+		return nil, errors.New("JWT Claim Set must be a JSON object")
+	}
+
+	seen := make(map[string]bool)
+	var dups []string
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		name := tok.(string)
+
+		var v json.RawMessage
+		if err := dec.Decode(&v); err != nil {
+			return nil, err
+		}
+
+		if seen[name] && !containsString(dups, name) {
+			dups = append(dups, name)
+		}
+		seen[name] = true
+	}
+
+	return dups, nil
 }
 
 func (c *ClaimSet) MarshalJSON() ([]byte, error) {
@@ -197,67 +265,63 @@ func (c *ClaimSet) MarshalJSON() ([]byte, error) {
 	return json.Marshal(obj)
 }
 
+// Validate validates the claims against the claims set in the reference claim set. Only the claims present in the
+// reference are validated. ClaimErrors is returned if any claim fails validation, otherwise nil. Use a Validator for
+// leeway, a configurable clock and sets of acceptable values.
 func (c *ClaimSet) Validate(ref *ClaimSet) error {
 
-	errStrings := make([]string, 0, 6)
+	var errs ClaimErrors
 
 	// Only valid the claims that are specified in the reference claimset
 	if !ref.Expiration.IsZero() {
 		if err := c.ValidateExp(); err != nil {
-			errStr := fmt.Sprintf("[Exp]- Validation failed: %s", err.Error())
-			errStrings = append(errStrings, errStr)
+			errs = append(errs, &ClaimError{"Exp", err})
 		}
 	}
 
 	if !ref.NotBefore.IsZero() {
 		if err := c.ValidateNbf(); err != nil {
-			errStr := fmt.Sprintf("[Nbf]- Validation failed: %s", err.Error())
-			errStrings = append(errStrings, errStr)
+			errs = append(errs, &ClaimError{"Nbf", err})
 		}
 	}
 
 	if ref.Issuer != "" {
 		if err := c.ValidateIss(ref.Issuer); err != nil {
-			errStr := fmt.Sprintf("[Iss]- Validation failed: %s", err.Error())
-			errStrings = append(errStrings, errStr)
+			errs = append(errs, &ClaimError{"Iss", err})
 		}
 	}
 
 	if ref.Subject != "" {
 		if err := c.ValidateSub(ref.Subject); err != nil {
-			errStr := fmt.Sprintf("[Sub]- Validation failed: %s", err.Error())
-			errStrings = append(errStrings, errStr)
+			errs = append(errs, &ClaimError{"Sub", err})
 		}
 	}
 
 	if ref.Audience != nil {
 		for i, aud := range ref.Audience {
 			if err := c.ValidateAud(aud); err != nil {
-				errStr := fmt.Sprintf("[Aud %d]- Validation failed: %s", i, err.Error())
-				errStrings = append(errStrings, errStr)
+				errs = append(errs, &ClaimError{fmt.Sprintf("Aud %d", i), err})
 			}
 		}
 	}
 
 	if ref.Id != "" {
 		if err := c.ValidateJti(ref.Id); err != nil {
-			errStr := fmt.Sprintf("[JTI]- Validation failed: %s", err.Error())
-			errStrings = append(errStrings, errStr)
+			errs = append(errs, &ClaimError{"JTI", err})
 		}
 	}
 
 	if ref.AdditionalClaims != nil {
 		if err := c.ValidateAdditionalClaims(ref.AdditionalClaims); err != nil {
-			errStr := fmt.Sprintf("[Additional Claims]- Validation failed: %s", err.Error())
-			errStrings = append(errStrings, errStr)
+			errs = append(errs, &ClaimError{"Additional Claims", err})
 		}
 	}
 
-	return fmt.Errorf(strings.Join(errStrings, "\n"))
+	return errs.err()
 }
 
 func (c *ClaimSet) ValidateIss(iss string) error {
-	if strings.TrimSpace(c.Issuer) != strings.TrimSpace(iss) {
+	if c.Issuer != iss {
 		return fmt.Errorf("Issuer (%v) doesn't match ref (%v)", c.Issuer, iss)
 	}
 
@@ -265,20 +329,17 @@ func (c *ClaimSet) ValidateIss(iss string) error {
 }
 
 func (c *ClaimSet) ValidateSub(sub string) error {
-	if strings.TrimSpace(c.Subject) != strings.TrimSpace(sub) {
+	if c.Subject != sub {
 		return fmt.Errorf("Subject (%s) doesn't match ref (%s)", c.Subject, sub)
 	}
 
 	return nil
 }
 
+// ValidateAud checks that the reference audience is one of the claim set's audiences
 func (c *ClaimSet) ValidateAud(refAud string) error {
-	refAud = strings.TrimSpace(refAud)
-	for _, v := range c.Audience {
-		aud := strings.TrimSpace(v)
-		if aud != refAud {
-			return fmt.Errorf("Aud Value: %v, doesn't match reference AUD value: %v", aud, refAud)
-		}
+	if !containsString(c.Audience, refAud) {
+		return fmt.Errorf("Aud Values: %v, don't contain reference AUD value: %v", c.Audience, refAud)
 	}
 
 	return nil
@@ -301,8 +362,8 @@ func (c *ClaimSet) ValidateNbf() error {
 }
 
 func (c *ClaimSet) ValidateJti(jti string) error {
-	if strings.TrimSpace(c.Id) != strings.TrimSpace(jti) {
-		return fmt.Errorf("Audience (%s) doesn't match ref (%s)", c.Id, jti)
+	if c.Id != jti {
+		return fmt.Errorf("JWT ID (%s) doesn't match ref (%s)", c.Id, jti)
 	}
 
 	return nil
@@ -319,3 +380,59 @@ func (c *ClaimSet) ValidateAdditionalClaims(addlC map[string]interface{}) error
 	}
 	return nil
 }
+
+// Returns an additional claim's string value. An error is returned if the claim is present but isn't a string.
+func (c *ClaimSet) stringClaim(name string) (string, bool, error) {
+	v, ok := c.AdditionalClaims[name]
+	if !ok {
+		return "", false, nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", true, fmt.Errorf("Claim %s must be a string", name)
+	}
+	return s, true, nil
+}
+
+// Returns an additional claim's NumericDate value. An error is returned if the claim is present but isn't a number.
+func (c *ClaimSet) timeClaim(name string) (time.Time, bool, error) {
+	v, ok := c.AdditionalClaims[name]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return time.Time{}, true, err
+	}
+	var nd NumericDate
+	if err := nd.UnmarshalJSON(data); err != nil {
+		return time.Time{}, true, fmt.Errorf("Claim %s must be a NumericDate: %v", name, err)
+	}
+	return nd.Time, true, nil
+}
+
+// Returns an additional claim's value as a string array. An error is returned if the claim is present but isn't an
+// array of strings.
+func (c *ClaimSet) stringsClaim(name string) ([]string, bool, error) {
+	v, ok := c.AdditionalClaims[name]
+	if !ok {
+		return nil, false, nil
+	}
+
+	switch arr := v.(type) {
+	case []string:
+		return arr, true, nil
+	case []interface{}:
+		strs := make([]string, len(arr))
+		for i, e := range arr {
+			s, ok := e.(string)
+			if !ok {
+				return nil, true, fmt.Errorf("Claim %s must be an array of strings", name)
+			}
+			strs[i] = s
+		}
+		return strs, true, nil
+	}
+
+	return nil, true, fmt.Errorf("Claim %s must be an array of strings", name)
+}
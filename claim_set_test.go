@@ -3,6 +3,7 @@ package gose
 import (
 	"bytes"
 	"encoding/json"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -85,3 +86,66 @@ func TestClaimSetUnmarshal(t *testing.T) {
 		}
 	}
 }
+
+var claimSetParseTestVectors = []struct {
+	name        string
+	cJson       []byte
+	unmarshalOk bool
+	strictOk    bool
+	warnings    []string
+	aud         []string
+	exp         time.Time
+}{
+	{"Single string aud", []byte(`{"aud":"AUD1","exp":1257894000}`), true, true, nil,
+		[]string{"AUD1"}, time.Unix(1257894000, 0)},
+	{"Fractional exp", []byte(`{"exp":1257894000.25}`), true, true, nil,
+		nil, time.Unix(1257894000, 250000000)},
+	{"Wrong exp type", []byte(`{"aud":"AUD1","exp":"1257894000"}`), false, false, []string{"exp"},
+		[]string{"AUD1"}, time.Time{}},
+	{"Exp out of range", []byte(`{"exp":253402300800}`), false, false, []string{"exp"}, nil, time.Time{}},
+	{"Negative nbf", []byte(`{"nbf":-1,"exp":1257894000}`), false, false, []string{"nbf"},
+		nil, time.Unix(1257894000, 0)},
+	{"Wrong aud type", []byte(`{"aud":[1],"iss":5}`), false, false, []string{"iss", "aud"}, nil, time.Time{}},
+	{"Null exp", []byte(`{"aud":"AUD1","exp":null}`), false, false, []string{"exp"}, []string{"AUD1"}, time.Time{}},
+	{"Null iat", []byte(`{"iat":null,"exp":1257894000}`), false, false, []string{"iat"},
+		nil, time.Unix(1257894000, 0)},
+	{"Duplicate claim", []byte(`{"exp":1,"exp":1257894000}`), true, false, []string{"exp"},
+		nil, time.Unix(1257894000, 0)},
+}
+
+func TestClaimSetParse(t *testing.T) {
+	for i, v := range claimSetParseTestVectors {
+		err := json.Unmarshal(v.cJson, new(ClaimSet))
+		if (err == nil) != v.unmarshalOk {
+			t.Errorf("Test %d (%s). Unexpected Unmarshal result. Err: %v\n", i+1, v.name, err)
+		}
+
+		c, warnings, err := ParseClaimSet(v.cJson, ClaimParseStrict)
+		if (err == nil) != v.strictOk || warnings != nil {
+			t.Errorf("Test %d (%s). Unexpected strict result. Err: %v\n", i+1, v.name, err)
+		}
+		if err == nil && (!reflect.DeepEqual(c.Audience, v.aud) || !c.Expiration.Equal(v.exp)) {
+			t.Errorf("Test %d (%s). Strict claims don't match. Got: %+v\n", i+1, v.name, c)
+		}
+
+		c, warnings, err = ParseClaimSet(v.cJson, ClaimParseLenient)
+		if err != nil {
+			t.Errorf("Test %d (%s). Unable to parse leniently. Err: %v\n", i+1, v.name, err)
+			continue
+		}
+		var claims []string
+		for _, w := range warnings {
+			claims = append(claims, w.Claim)
+		}
+		if !reflect.DeepEqual(claims, v.warnings) {
+			t.Errorf("Test %d (%s). Expected warnings for: %v, Got: %v\n", i+1, v.name, v.warnings, warnings)
+		}
+		if !reflect.DeepEqual(c.Audience, v.aud) || !c.Expiration.Equal(v.exp) {
+			t.Errorf("Test %d (%s). Lenient claims don't match. Got: %+v\n", i+1, v.name, c)
+		}
+	}
+
+	if _, _, err := ParseClaimSet([]byte(`["exp"]`), ClaimParseLenient); err == nil {
+		t.Errorf("A JSON array was parsed as a claim set\n")
+	}
+}
@@ -0,0 +1,310 @@
+package gose
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Audience is the "aud" claim. It decodes from either a single string or an array of strings as allowed by
+// https://tools.ietf.org/html/rfc7519#section-4.1.3, and encodes as an array.
+type Audience []string
+
+// Implements the json.Unmarshaler interface and JSON decodes a string or an array of strings
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	switch aud := v.(type) {
+	case nil:
+		*a = nil
+	case string:
+		*a = Audience{aud}
+	case []interface{}:
+		arr := make(Audience, len(aud))
+		for i, e := range aud {
+			s, ok := e.(string)
+			if !ok {
+				return errors.New("Audience (aud) must be a string or an array of strings")
+			}
+			arr[i] = s
+		}
+		*a = arr
+	default:
+		return errors.New("Audience (aud) must be a string or an array of strings")
+	}
+
+	return nil
+}
+
+// RegisteredClaims holds the registered JWT claims (https://tools.ietf.org/html/rfc7519#section-4.1) with json tags.
+// Unlike ClaimSet, it has no custom JSON encoding, so it can be embedded in user defined claim structs that are
+// encoded with encoding/json:
+//
+//	type MyClaims struct {
+//		gose.RegisteredClaims
+//		Roles []string `json:"roles"`
+//	}
+type RegisteredClaims struct {
+	Issuer     string       `json:"iss,omitempty"`
+	Subject    string       `json:"sub,omitempty"`
+	Audience   Audience     `json:"aud,omitempty"`
+	Id         string       `json:"jti,omitempty"`
+	Expiration *NumericDate `json:"exp,omitempty"`
+	NotBefore  *NumericDate `json:"nbf,omitempty"`
+	IssuedAt   *NumericDate `json:"iat,omitempty"`
+}
+
+// ToClaimSet returns the registered claims as a ClaimSet, e.g. to validate them with a Validator
+func (r *RegisteredClaims) ToClaimSet() *ClaimSet {
+	c := &ClaimSet{
+		Issuer:   r.Issuer,
+		Subject:  r.Subject,
+		Audience: r.Audience,
+		Id:       r.Id,
+	}
+	if r.Expiration != nil {
+		c.Expiration = r.Expiration.Time
+	}
+	if r.NotBefore != nil {
+		c.NotBefore = r.NotBefore.Time
+	}
+	if r.IssuedAt != nil {
+		c.IssuedAt = r.IssuedAt.Time
+	}
+
+	return c
+}
+
+// NewNumericDate returns a *NumericDate for t, or nil if t is the zero time
+func NewNumericDate(t time.Time) *NumericDate {
+	if t.IsZero() {
+		return nil
+	}
+	return &NumericDate{t}
+}
+
+// Token is a verified JWT whose claims have been decoded into a user defined type T. T is typically a struct that
+// embeds RegisteredClaims or ClaimSet.
+type Token[T any] struct {
+	Header *JwHeader
+	Claims T
+	// ClaimSet is the generic representation of the claims, which was used for validation
+	ClaimSet *ClaimSet
+}
+
+// ParseToken parses a compact serialized JWT, verifies its signature with the key resolved by ks, validates the claims
+// with validator (if not nil) and decodes them into T with DecodeClaims.
+func ParseToken[T any](token string, ks KeySource, validator ClaimValidator, opts ...SignerOption) (*Token[T], error) {
+	jwt, err := ParseJwt(token, ks, validator, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	tok := &Token[T]{Header: jwt.Header, ClaimSet: jwt.Claims}
+	if err := DecodeClaims(jwt.Payload, &tok.Claims); err != nil {
+		return nil, err
+	}
+
+	return tok, nil
+}
+
+// SignJwtClaims encodes v with EncodeClaims, signs it with key and returns the compact serialized JWT
+func SignJwtClaims(v interface{}, key *Jwk, opts *JwtSignOptions) (string, error) {
+	payload, err := EncodeClaims(v)
+	if err != nil {
+		return "", err
+	}
+
+	return signJwtPayload(payload, key, opts)
+}
+
+// EncodeClaims JSON encodes a claims value. Values are encoded with encoding/json, except structs that embed ClaimSet
+// (or *ClaimSet): the embedded ClaimSet's claims are merged with the struct's other fields, which take precedence.
+func EncodeClaims(v interface{}) ([]byte, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+
+	if rv.Kind() != reflect.Struct {
+		return json.Marshal(v)
+	}
+	idx := embeddedClaimSetIndex(rv.Type())
+	if idx < 0 {
+		return json.Marshal(v)
+	}
+
+	shadowType, fields, err := claimShadowType(rv.Type(), idx)
+	if err != nil {
+		return nil, err
+	}
+
+	shadow := reflect.New(shadowType).Elem()
+	for i, f := range fields {
+		shadow.Field(i).Set(rv.Field(f))
+	}
+
+	obj := make(map[string]json.RawMessage)
+	if cs := embeddedClaimSet(rv, idx, false); cs != nil {
+		data, err := json.Marshal(cs)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &obj); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := json.Marshal(shadow.Interface())
+	if err != nil {
+		return nil, err
+	}
+	var fieldObj map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fieldObj); err != nil {
+		return nil, err
+	}
+	for k, v := range fieldObj {
+		obj[k] = v
+	}
+
+	return json.Marshal(obj)
+}
+
+// DecodeClaims JSON decodes a claims payload into v, which must be a pointer. Values are decoded with encoding/json,
+// except structs that embed ClaimSet (or *ClaimSet): all claims are decoded into the embedded ClaimSet, and the
+// struct's other fields are decoded from the claims matching their json tags. Claims decoded into struct fields are
+// removed from the ClaimSet's AdditionalClaims.
+func DecodeClaims(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("DecodeClaims requires a non-nil pointer")
+	}
+
+	ev := rv.Elem()
+	if ev.Kind() != reflect.Struct {
+		return json.Unmarshal(data, v)
+	}
+	idx := embeddedClaimSetIndex(ev.Type())
+	if idx < 0 {
+		return json.Unmarshal(data, v)
+	}
+
+	shadowType, fields, err := claimShadowType(ev.Type(), idx)
+	if err != nil {
+		return err
+	}
+
+	shadow := reflect.New(shadowType)
+	if err := json.Unmarshal(data, shadow.Interface()); err != nil {
+		return err
+	}
+	for i, f := range fields {
+		ev.Field(f).Set(shadow.Elem().Field(i))
+	}
+
+	cs := embeddedClaimSet(ev, idx, true)
+	if err := json.Unmarshal(data, cs); err != nil {
+		return err
+	}
+	for _, name := range jsonFieldNames(shadowType) {
+		for k := range cs.AdditionalClaims {
+			if strings.EqualFold(k, name) {
+				delete(cs.AdditionalClaims, k)
+			}
+		}
+	}
+	if len(cs.AdditionalClaims) == 0 {
+		cs.AdditionalClaims = nil
+	}
+
+	return nil
+}
+
+// Returns the index of the embedded ClaimSet or *ClaimSet field of a struct type, or -1
+func embeddedClaimSetIndex(t reflect.Type) int {
+	csType := reflect.TypeOf(ClaimSet{})
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && (f.Type == csType || f.Type == reflect.PointerTo(csType)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Returns the embedded ClaimSet of the struct value. If alloc is set, a nil *ClaimSet is allocated.
+func embeddedClaimSet(v reflect.Value, idx int, alloc bool) *ClaimSet {
+	f := v.Field(idx)
+	if f.Kind() == reflect.Ptr {
+		if f.IsNil() {
+			if !alloc {
+				return nil
+			}
+			f.Set(reflect.New(f.Type().Elem()))
+		}
+		return f.Interface().(*ClaimSet)
+	}
+	return f.Addr().Interface().(*ClaimSet)
+}
+
+// Builds a struct type with the same exported fields as t except the embedded ClaimSet at idx. The shadow type has
+// no methods, so it is encoded with the standard json struct encoding. The index of each shadow field in t is returned.
+func claimShadowType(t reflect.Type, idx int) (reflect.Type, []int, error) {
+	var sfs []reflect.StructField
+	var fields []int
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if i == idx || f.PkgPath != "" {
+			continue
+		}
+		if f.Anonymous {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.NumMethod() > 0 || reflect.PointerTo(ft).NumMethod() > 0 {
+				return nil, nil, fmt.Errorf("Embedded field %s has methods and can't be combined with an embedded ClaimSet", f.Name)
+			}
+		}
+
+		sfs = append(sfs, reflect.StructField{Name: f.Name, Type: f.Type, Tag: f.Tag, Anonymous: f.Anonymous})
+		fields = append(fields, i)
+	}
+
+	return reflect.StructOf(sfs), fields, nil
+}
+
+// Returns the JSON member names of a struct type's fields, including promoted fields of embedded structs
+func jsonFieldNames(t reflect.Type) []string {
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			names = append(names, jsonFieldNames(ft)...)
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+		names = append(names, name)
+	}
+	return names
+}
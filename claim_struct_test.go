@@ -0,0 +1,153 @@
+package gose
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testEmbeddedClaims struct {
+	ClaimSet
+	Roles  []string `json:"roles"`
+	Level  int      `json:"level,omitempty"`
+	Nested struct {
+		Name string `json:"name"`
+	} `json:"nested"`
+	Ignored string `json:"-"`
+}
+
+type testRegisteredClaims struct {
+	RegisteredClaims
+	Scope string `json:"scope"`
+}
+
+func TestDecodeClaimsEmbeddedClaimSet(t *testing.T) {
+	payload := []byte(`{"iss":"joe","aud":["api"],"exp":1300819380,"roles":["admin","user"],"level":3,` +
+		`"nested":{"name":"n"},"Ignored":"x","extra":true}`)
+
+	var c testEmbeddedClaims
+	if err := DecodeClaims(payload, &c); err != nil {
+		t.Fatalf("Unable to decode claims. Err: %v\n", err)
+	}
+
+	if c.Issuer != "joe" || !reflect.DeepEqual(c.Audience, []string{"api"}) || c.Expiration.Unix() != 1300819380 {
+		t.Errorf("Registered claims don't match. Got: %+v\n", c.ClaimSet)
+	}
+	if !reflect.DeepEqual(c.Roles, []string{"admin", "user"}) || c.Level != 3 || c.Nested.Name != "n" {
+		t.Errorf("Custom claims don't match. Got: %+v\n", c)
+	}
+	if c.Ignored != "" {
+		t.Errorf("Field tagged json:\"-\" was decoded\n")
+	}
+	if !reflect.DeepEqual(c.AdditionalClaims, map[string]interface{}{"Ignored": "x", "extra": true}) {
+		t.Errorf("Unexpected additional claims: %v\n", c.AdditionalClaims)
+	}
+
+	enc, err := EncodeClaims(&c)
+	if err != nil {
+		t.Fatalf("Unable to encode claims. Err: %v\n", err)
+	}
+	var got, want map[string]interface{}
+	json.Unmarshal(enc, &got)
+	json.Unmarshal([]byte(`{"iss":"joe","aud":["api"],"exp":1300819380,"roles":["admin","user"],"level":3,`+
+		`"nested":{"name":"n"},"Ignored":"x","extra":true}`), &want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Encoded claims don't match. Expected: %v, Got: %v\n", want, got)
+	}
+}
+
+func TestDecodeClaimsEmbeddedClaimSetPointer(t *testing.T) {
+	var c struct {
+		*ClaimSet
+		Level int `json:"level"`
+	}
+	if err := DecodeClaims([]byte(`{"sub":"alice","level":2}`), &c); err != nil {
+		t.Fatalf("Unable to decode claims. Err: %v\n", err)
+	}
+	if c.ClaimSet == nil || c.Subject != "alice" || c.Level != 2 || c.AdditionalClaims != nil {
+		t.Errorf("Claims don't match. Got: %+v\n", c)
+	}
+}
+
+func TestDecodeClaimsRegisteredClaims(t *testing.T) {
+	vectors := []struct {
+		payload string
+		aud     []string
+		err     bool
+	}{
+		{`{"sub":"alice","aud":"api","iat":1300819380,"scope":"read"}`, []string{"api"}, false},
+		{`{"sub":"alice","aud":["a","b"],"iat":1300819380,"scope":"read"}`, []string{"a", "b"}, false},
+		{`{"sub":"alice","aud":null,"iat":1300819380,"scope":"read"}`, nil, false},
+		{`{"sub":"alice","aud":1,"scope":"read"}`, nil, true},
+		{`{"sub":"alice","aud":[null],"scope":"read"}`, nil, true},
+		{`{"sub":"alice","aud":["a",1],"scope":"read"}`, nil, true},
+	}
+
+	for i, v := range vectors {
+		var c testRegisteredClaims
+		err := DecodeClaims([]byte(v.payload), &c)
+		if (err != nil) != v.err {
+			t.Errorf("Test %d. Unexpected error result. Err: %v\n", i+1, err)
+			continue
+		} else if err != nil {
+			continue
+		}
+
+		if c.Subject != "alice" || c.Scope != "read" || !reflect.DeepEqual([]string(c.Audience), v.aud) ||
+			c.IssuedAt == nil || c.IssuedAt.Unix() != 1300819380 || c.Expiration != nil {
+			t.Errorf("Test %d. Claims don't match. Got: %+v\n", i+1, c)
+		}
+
+		cs := c.ToClaimSet()
+		if cs.Subject != "alice" || !cs.IssuedAt.Equal(c.IssuedAt.Time) || !cs.Expiration.IsZero() {
+			t.Errorf("Test %d. ClaimSet doesn't match. Got: %+v\n", i+1, cs)
+		}
+	}
+}
+
+func TestParseToken(t *testing.T) {
+	key := new(Jwk)
+	if err := json.Unmarshal(jwaSignerTestVectors[1].signKeyJson, key); err != nil {
+		t.Fatalf("Unable to unmarshal key. Err: %v\n", err)
+	}
+
+	now := time.Now().Truncate(time.Second)
+	claims := &testRegisteredClaims{
+		RegisteredClaims: RegisteredClaims{
+			Issuer:     "joe",
+			Audience:   Audience{"api"},
+			Expiration: NewNumericDate(now.Add(time.Hour)),
+			IssuedAt:   NewNumericDate(now),
+		},
+		Scope: "read write",
+	}
+
+	token, err := SignJwtClaims(claims, key, &JwtSignOptions{Algorithm: JwsAlgES256})
+	if err != nil {
+		t.Fatalf("Unable to sign claims. Err: %v\n", err)
+	}
+
+	tok, err := ParseToken[testRegisteredClaims](token, key, &Validator{Issuers: []string{"joe"}})
+	if err != nil {
+		t.Fatalf("Unable to parse token. Err: %v\n", err)
+	}
+	if tok.Claims.Scope != claims.Scope || !tok.Claims.Expiration.Equal(claims.Expiration.Time) {
+		t.Errorf("Claims don't match. Got: %+v\n", tok.Claims)
+	}
+	if tok.ClaimSet.Issuer != "joe" || tok.Header.Algorithm != JwsAlgES256 {
+		t.Errorf("Unexpected ClaimSet or header: %+v %+v\n", tok.ClaimSet, tok.Header)
+	}
+
+	if _, err := ParseToken[testRegisteredClaims](token, key, &Validator{Issuers: []string{"bob"}}); err == nil {
+		t.Errorf("Token with an unaccepted issuer was parsed\n")
+	}
+
+	embedded, err := ParseToken[testEmbeddedClaims](token, key, nil)
+	if err != nil {
+		t.Fatalf("Unable to parse token into embedded ClaimSet. Err: %v\n", err)
+	}
+	if embedded.Claims.Issuer != "joe" || embedded.Claims.AdditionalClaims["scope"] != "read write" {
+		t.Errorf("Embedded claims don't match. Got: %+v\n", embedded.Claims)
+	}
+}
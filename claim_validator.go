@@ -0,0 +1,222 @@
+package gose
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Registered claim names as specified in https://tools.ietf.org/html/rfc7519#section-4.1
+const (
+	ClaimIssuer     string = "iss"
+	ClaimSubject    string = "sub"
+	ClaimAudience   string = "aud"
+	ClaimExpiration string = "exp"
+	ClaimNotBefore  string = "nbf"
+	ClaimIssuedAt   string = "iat"
+	ClaimId         string = "jti"
+)
+
+// ClaimError describes why a single claim failed validation
+type ClaimError struct {
+	Claim string
+	Err   error
+}
+
+func (e *ClaimError) Error() string {
+	return fmt.Sprintf("[%s]- Validation failed: %s", e.Claim, e.Err.Error())
+}
+
+func (e *ClaimError) Unwrap() error {
+	return e.Err
+}
+
+// ClaimErrors is returned when one or more claims fail validation. Each failure is reported as a *ClaimError.
+type ClaimErrors []*ClaimError
+
+func (e ClaimErrors) Error() string {
+	errStrings := make([]string, len(e))
+	for i, v := range e {
+		errStrings[i] = v.Error()
+	}
+	return strings.Join(errStrings, "\n")
+}
+
+func (e ClaimErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, v := range e {
+		errs[i] = v
+	}
+	return errs
+}
+
+// Returns the errors as an error, or nil if there are none
+func (e ClaimErrors) err() error {
+	if len(e) < 1 {
+		return nil
+	}
+	return e
+}
+
+// Validator validates the registered claims of a JWT. The zero value checks exp and nbf (if present) against the
+// current time without any leeway. It implements the ClaimValidator interface.
+type Validator struct {
+	// Leeway is the allowed clock skew when checking exp, nbf, iat and MaxAge
+	Leeway time.Duration
+	// Clock returns the current time. If nil, time.Now is used.
+	Clock func() time.Time
+	// RequiredClaims are the names of claims that must be present (registered or additional claims)
+	RequiredClaims []string
+	// Issuers are the acceptable issuers. If empty, any issuer is accepted.
+	Issuers []string
+	// Audiences are the acceptable audiences; at least one of the JWT's audiences must be listed. If empty, any
+	// audience is accepted.
+	Audiences []string
+	// MaxAge is the maximum time since the JWT was issued (iat). If set, iat is required.
+	MaxAge time.Duration
+	// ReplayCache, if set, makes JWTs one-time use: jti is required, and is recorded until the JWT expires (exp, or
+	// iat plus MaxAge) plus Leeway. The jti is only recorded if all other claims are valid.
+	ReplayCache ReplayCache
+}
+
+// ValidateClaims validates the claims, returning ClaimErrors describing every claim that failed validation or nil
+func (v *Validator) ValidateClaims(c *ClaimSet) error {
+	return v.checkReplay(c, v.validate(c))
+}
+
+// Validates the claims without recording the jti
+func (v *Validator) validate(c *ClaimSet) ClaimErrors {
+	now := v.now()
+	var errs ClaimErrors
+
+	for _, name := range v.RequiredClaims {
+		if !c.HasClaim(name) {
+			errs = append(errs, &ClaimError{name, errors.New("Required claim is missing")})
+		}
+	}
+
+	if !c.Expiration.IsZero() && !now.Before(c.Expiration.Add(v.Leeway)) {
+		errs = append(errs, &ClaimError{ClaimExpiration, errors.New("JWT has expired")})
+	}
+
+	if !c.NotBefore.IsZero() && now.Add(v.Leeway).Before(c.NotBefore) {
+		errs = append(errs, &ClaimError{ClaimNotBefore, errors.New("JWT can not yet be accepted for processing")})
+	}
+
+	if !c.IssuedAt.IsZero() && now.Add(v.Leeway).Before(c.IssuedAt) {
+		errs = append(errs, &ClaimError{ClaimIssuedAt, errors.New("JWT was issued in the future")})
+	}
+
+	if v.MaxAge > 0 {
+		if c.IssuedAt.IsZero() {
+			errs = append(errs, &ClaimError{ClaimIssuedAt, errors.New("Issued at (iat) is required to check the JWT's age")})
+		} else if now.Sub(c.IssuedAt) > v.MaxAge+v.Leeway {
+			errs = append(errs, &ClaimError{ClaimIssuedAt, fmt.Errorf("JWT is older than the maximum age of %v", v.MaxAge)})
+		}
+	}
+
+	if len(v.Issuers) > 0 && !containsString(v.Issuers, c.Issuer) {
+		errs = append(errs, &ClaimError{ClaimIssuer, fmt.Errorf("Issuer (%v) is not accepted", c.Issuer)})
+	}
+
+	if len(v.Audiences) > 0 {
+		accepted := false
+		for _, aud := range c.Audience {
+			if containsString(v.Audiences, aud) {
+				accepted = true
+				break
+			}
+		}
+		if !accepted {
+			errs = append(errs, &ClaimError{ClaimAudience, fmt.Errorf("None of the audiences (%v) are accepted", c.Audience)})
+		}
+	}
+
+	if v.ReplayCache != nil {
+		if c.Id == "" {
+			errs = append(errs, &ClaimError{ClaimId, errors.New("JWT ID is required for replay detection")})
+		}
+		if c.Expiration.IsZero() && (v.MaxAge <= 0 || c.IssuedAt.IsZero()) {
+			errs = append(errs, &ClaimError{ClaimExpiration, errors.New("Expiration (or iat and a maximum age) is required for replay detection")})
+		}
+	}
+
+	return errs
+}
+
+// Appends an error to errs for each of the named claims that is missing. Claims that are also in RequiredClaims are
+// skipped, as validate already reports them.
+func (v *Validator) requireClaims(c *ClaimSet, errs ClaimErrors, names ...string) ClaimErrors {
+	for _, name := range names {
+		if !c.HasClaim(name) && !containsString(v.RequiredClaims, name) {
+			errs = append(errs, &ClaimError{name, errors.New("Required claim is missing")})
+		}
+	}
+	return errs
+}
+
+// Records the jti in the ReplayCache if there are no validation errors. The errors (or nil) are returned, or a
+// ClaimError if the jti was already used.
+func (v *Validator) checkReplay(c *ClaimSet, errs ClaimErrors) error {
+	if len(errs) > 0 {
+		return errs
+	} else if v.ReplayCache == nil {
+		return nil
+	}
+
+	expires := c.Expiration
+	if expires.IsZero() {
+		expires = c.IssuedAt.Add(v.MaxAge)
+	}
+
+	// The issuer is length prefixed, so that no other issuer and jti pair can produce the same key
+	ok, err := v.ReplayCache.Add(fmt.Sprintf("%d:%s%s", len(c.Issuer), c.Issuer, c.Id), expires.Add(v.Leeway))
+	if err != nil {
+		return err
+	} else if !ok {
+		return ClaimErrors{&ClaimError{ClaimId, errors.New("JWT has already been used")}}
+	}
+
+	return nil
+}
+
+func (v *Validator) now() time.Time {
+	if v.Clock != nil {
+		return v.Clock()
+	}
+	return time.Now()
+}
+
+// HasClaim returns true if the claim is present, either as a (non-empty) registered claim or as an additional claim
+func (c *ClaimSet) HasClaim(name string) bool {
+	switch name {
+	case ClaimIssuer:
+		return c.Issuer != ""
+	case ClaimSubject:
+		return c.Subject != ""
+	case ClaimAudience:
+		return len(c.Audience) > 0
+	case ClaimId:
+		return c.Id != ""
+	case ClaimExpiration:
+		return !c.Expiration.IsZero()
+	case ClaimNotBefore:
+		return !c.NotBefore.IsZero()
+	case ClaimIssuedAt:
+		return !c.IssuedAt.IsZero()
+	}
+
+	_, ok := c.AdditionalClaims[name]
+	return ok
+}
+
+// Returns true if the string is in the list. Values are compared exactly, without trimming or case folding.
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
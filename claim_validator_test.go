@@ -0,0 +1,116 @@
+package gose
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+var validatorTestNow = time.Date(2020, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+var validatorTestVectors = []struct {
+	name      string
+	validator *Validator
+	claims    *ClaimSet
+	failed    []string
+}{
+	{
+		"Valid",
+		&Validator{Issuers: []string{"iss-1", "iss-2"}, Audiences: []string{"aud-1"}, RequiredClaims: []string{"exp", "scope"}},
+		&ClaimSet{
+			Issuer:           "iss-2",
+			Audience:         []string{"aud-0", "aud-1"},
+			Expiration:       validatorTestNow.Add(time.Minute),
+			AdditionalClaims: map[string]interface{}{"scope": "read"},
+		},
+		nil,
+	},
+	{
+		"Expired",
+		&Validator{},
+		&ClaimSet{Expiration: validatorTestNow.Add(-time.Second)},
+		[]string{"exp"},
+	},
+	{
+		"Expired within leeway",
+		&Validator{Leeway: time.Minute},
+		&ClaimSet{Expiration: validatorTestNow.Add(-time.Second), NotBefore: validatorTestNow.Add(time.Second)},
+		nil,
+	},
+	{
+		"Not yet valid and issued in the future",
+		&Validator{Leeway: time.Second},
+		&ClaimSet{NotBefore: validatorTestNow.Add(time.Minute), IssuedAt: validatorTestNow.Add(time.Minute)},
+		[]string{"nbf", "iat"},
+	},
+	{
+		"Too old",
+		&Validator{MaxAge: time.Hour},
+		&ClaimSet{IssuedAt: validatorTestNow.Add(-2 * time.Hour)},
+		[]string{"iat"},
+	},
+	{
+		"Max age without iat",
+		&Validator{MaxAge: time.Hour},
+		&ClaimSet{},
+		[]string{"iat"},
+	},
+	{
+		"Wrong issuer, audience and missing claims",
+		&Validator{Issuers: []string{"iss-1"}, Audiences: []string{"aud-1"}, RequiredClaims: []string{"sub", "jti"}},
+		&ClaimSet{Issuer: "iss-3", Audience: []string{"aud-2"}},
+		[]string{"sub", "jti", "iss", "aud"},
+	},
+	{
+		"Padded issuer",
+		&Validator{Issuers: []string{"https://issuer.example.com"}},
+		&ClaimSet{Issuer: " https://issuer.example.com "},
+		[]string{"iss"},
+	},
+}
+
+func TestValidator(t *testing.T) {
+	for i, v := range validatorTestVectors {
+		v.validator.Clock = func() time.Time { return validatorTestNow }
+
+		err := v.validator.ValidateClaims(v.claims)
+		if len(v.failed) == 0 {
+			if err != nil {
+				t.Errorf("Test %d (%s). Unexpected error: %v\n", i+1, v.name, err)
+			}
+			continue
+		}
+
+		var claimErrs ClaimErrors
+		if !errors.As(err, &claimErrs) {
+			t.Errorf("Test %d (%s). Expected ClaimErrors. Got: %v\n", i+1, v.name, err)
+			continue
+		}
+		if len(claimErrs) != len(v.failed) {
+			t.Errorf("Test %d (%s). Expected %d errors. Got: %v\n", i+1, v.name, len(v.failed), err)
+			continue
+		}
+		for j, claim := range v.failed {
+			if claimErrs[j].Claim != claim {
+				t.Errorf("Test %d (%s). Expected error %d for claim %s. Got: %s\n", i+1, v.name, j+1, claim, claimErrs[j].Claim)
+			}
+		}
+	}
+}
+
+func TestClaimSetValidate(t *testing.T) {
+	c := &ClaimSet{Issuer: "iss", Audience: []string{"aud-1", "aud-2"}, Id: "jti"}
+
+	if err := c.Validate(&ClaimSet{Issuer: "iss", Audience: []string{"aud-2"}, Id: "jti"}); err != nil {
+		t.Errorf("Unexpected validation error: %v\n", err)
+	}
+	if err := c.Validate(&ClaimSet{Audience: []string{"aud-3"}}); err == nil {
+		t.Errorf("Expected an audience validation error\n")
+	}
+
+	// Values are compared exactly
+	padded := &ClaimSet{Issuer: " iss", Subject: "sub ", Id: " jti "}
+	if !claimErrorsMatch(padded.Validate(&ClaimSet{Issuer: "iss", Subject: "sub", Id: "jti"}), []string{"Iss", "Sub", "JTI"}) {
+		t.Errorf("Expected padded values not to match\n")
+	}
+}
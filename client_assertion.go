@@ -0,0 +1,177 @@
+package gose
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Assertion types as specified in https://tools.ietf.org/html/rfc7523#section-8
+const (
+	// ClientAssertionType is the client_assertion_type of JWT client authentication
+	ClientAssertionType string = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+	// JwtBearerGrantType is the grant_type of a JWT authorization grant
+	JwtBearerGrantType string = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+)
+
+// Default lifetime of a created assertion
+const defaultAssertionLifetime = time.Minute
+
+// AssertionOptions configures how an assertion is created
+type AssertionOptions struct {
+	// Algorithm is the JWS algorithm (alg). If empty, the key's algorithm is used, or HS256 for client secrets.
+	Algorithm string
+	// KeyId is the key id (kid) put in the header. If empty, the key's id is used.
+	KeyId string
+	// Lifetime is the time until the assertion expires. Defaults to 1 minute.
+	Lifetime time.Duration
+	// Clock returns the current time. If nil, time.Now is used.
+	Clock func() time.Time
+	// Claims are additional claims to include in the assertion
+	Claims map[string]interface{}
+}
+
+// NewPrivateKeyJwt creates a client assertion for the private_key_jwt client authentication method
+// (https://openid.net/specs/openid-connect-core-1_0.html#ClientAuthentication). The assertion is signed with the
+// client's private key, and its issuer and subject are the client id.
+func NewPrivateKeyJwt(clientId string, tokenEndpoint string, key *Jwk, opts *AssertionOptions) (string, error) {
+	if key == nil || key.Type == KeyTypeOct {
+		return "", errors.New("private_key_jwt requires an RSA or EC private key")
+	}
+
+	return newAssertion(clientId, clientId, tokenEndpoint, key, opts)
+}
+
+// NewClientSecretJwt creates a client assertion for the client_secret_jwt client authentication method. The
+// assertion is signed with an HMAC algorithm (HS256 by default) keyed with the client secret.
+func NewClientSecretJwt(clientId string, tokenEndpoint string, secret []byte, opts *AssertionOptions) (string, error) {
+	key := new(Jwk)
+	if err := key.ImportKey(secret); err != nil {
+		return "", err
+	}
+	key.Algorithm = JwsAlgHS256
+	if opts != nil && opts.Algorithm != "" && GetKeyType(opts.Algorithm) != KeyTypeOct {
+		return "", fmt.Errorf("client_secret_jwt requires an HMAC algorithm, not %s", opts.Algorithm)
+	}
+
+	return newAssertion(clientId, clientId, tokenEndpoint, key, opts)
+}
+
+// NewGrantAssertion creates a JWT authorization grant (https://tools.ietf.org/html/rfc7523#section-2.1) issued by
+// issuer for subject. The audience is the authorization server, e.g. its token endpoint.
+func NewGrantAssertion(issuer string, subject string, audience string, key *Jwk, opts *AssertionOptions) (string, error) {
+	return newAssertion(issuer, subject, audience, key, opts)
+}
+
+// Creates and signs an assertion with a random jti
+func newAssertion(iss string, sub string, aud string, key *Jwk, opts *AssertionOptions) (string, error) {
+	if iss == "" || sub == "" || aud == "" {
+		return "", errors.New("An assertion requires an issuer, a subject and an audience")
+	}
+	if opts == nil {
+		opts = &AssertionOptions{}
+	}
+
+	now := time.Now()
+	if opts.Clock != nil {
+		now = opts.Clock()
+	}
+	lifetime := opts.Lifetime
+	if lifetime <= 0 {
+		lifetime = defaultAssertionLifetime
+	}
+
+	jti, err := randomJti()
+	if err != nil {
+		return "", err
+	}
+
+	claims := &ClaimSet{
+		Issuer:     iss,
+		Subject:    sub,
+		Audience:   []string{aud},
+		Id:         jti,
+		IssuedAt:   now,
+		Expiration: now.Add(lifetime),
+	}
+	if len(opts.Claims) > 0 {
+		claims.AdditionalClaims = make(map[string]interface{}, len(opts.Claims))
+		for k, v := range opts.Claims {
+			claims.AdditionalClaims[k] = v
+		}
+	}
+
+	return SignJwt(claims, key, &JwtSignOptions{Algorithm: opts.Algorithm, KeyId: opts.KeyId})
+}
+
+// AssertionValidator validates JWT assertions as specified in https://tools.ietf.org/html/rfc7523#section-3.
+// Audiences must be set to the identifiers of the authorization server, such as its token endpoint URL. The iss, sub,
+// aud, exp and jti claims are required, and each jti is only accepted once. The jti of accepted assertions is recorded
+// in the embedded Validator's ReplayCache until they expire; without a ReplayCache, the validator records them in
+// memory and the same validator must be used for every request.
+type AssertionValidator struct {
+	Validator
+	// MaxLifetime is the maximum allowed time between iat (or now, without iat) and exp. If 0, it isn't checked.
+	MaxLifetime time.Duration
+
+	replays MemoryReplayCache
+}
+
+// ValidateClaims validates the assertion's claims, returning ClaimErrors or nil. The jti is only recorded if all other
+// claims are valid.
+func (v *AssertionValidator) ValidateClaims(c *ClaimSet) error {
+	if len(v.Audiences) < 1 {
+		return errors.New("AssertionValidator requires the accepted audiences")
+	}
+	validator := v.Validator
+	if validator.ReplayCache == nil {
+		validator.ReplayCache = &v.replays
+	}
+
+	errs := validator.validate(c)
+	errs = validator.requireClaims(c, errs, ClaimIssuer, ClaimSubject, ClaimAudience, ClaimExpiration, ClaimId)
+
+	if v.MaxLifetime > 0 && !c.Expiration.IsZero() {
+		start := c.IssuedAt
+		if start.IsZero() {
+			start = v.now()
+		}
+		if c.Expiration.Sub(start) > v.MaxLifetime+v.Leeway {
+			errs = append(errs, &ClaimError{ClaimExpiration, fmt.Errorf("Assertion lifetime exceeds %v", v.MaxLifetime)})
+		}
+	}
+
+	return validator.checkReplay(c, errs)
+}
+
+// ParseClientAssertion parses and validates a client assertion (private_key_jwt or client_secret_jwt). The issuer and
+// subject must both be the client id. If clientId is empty (no client_id request parameter), the issuer is used. ks
+// resolves the client's key: its registered public keys, or its client secret as an oct JWK.
+func ParseClientAssertion(assertion string, clientId string, ks KeySource, v *AssertionValidator) (*ClaimSet, error) {
+	if v == nil {
+		return nil, errors.New("An AssertionValidator is required to validate a client assertion")
+	}
+
+	cv := ClaimValidatorFunc(func(c *ClaimSet) error {
+		id := clientId
+		if id == "" {
+			id = c.Issuer
+		}
+		if c.Issuer != id || c.Subject != id {
+			return ClaimErrors{&ClaimError{ClaimIssuer, errors.New("Issuer and subject must both be the client id")}}
+		}
+		return v.ValidateClaims(c)
+	})
+
+	return ParseAndVerifyJwt(assertion, ks, cv)
+}
+
+// ParseGrantAssertion parses and validates a JWT authorization grant. The verified claims are returned; the caller
+// decides whether the issuer may assert the subject.
+func ParseGrantAssertion(assertion string, ks KeySource, v *AssertionValidator) (*ClaimSet, error) {
+	if v == nil {
+		return nil, errors.New("An AssertionValidator is required to validate an assertion")
+	}
+
+	return ParseAndVerifyJwt(assertion, ks, v)
+}
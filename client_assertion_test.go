@@ -0,0 +1,115 @@
+package gose
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+const testTokenEndpoint = "https://server.example.com/token"
+
+func TestPrivateKeyJwt(t *testing.T) {
+	for i, idx := range []int{1, 2} {
+		key := new(Jwk)
+		if err := json.Unmarshal(jwaSignerTestVectors[idx].signKeyJson, key); err != nil {
+			t.Fatalf("Unable to unmarshal key %d. Err: %v\n", i+1, err)
+		}
+		alg := JwsAlgES256
+		if key.Type == KeyTypeRSA {
+			alg = JwsAlgPS256
+		}
+
+		assertion, err := NewPrivateKeyJwt("client", testTokenEndpoint, key, &AssertionOptions{Algorithm: alg})
+		if err != nil {
+			t.Errorf("Test %d. Unable to create assertion. Err: %v\n", i+1, err)
+			continue
+		}
+
+		v := &AssertionValidator{
+			Validator:   Validator{Audiences: []string{testTokenEndpoint}},
+			MaxLifetime: 5 * time.Minute,
+		}
+		c, err := ParseClientAssertion(assertion, "client", key.Public(), v)
+		if err != nil {
+			t.Errorf("Test %d. Unable to validate assertion. Err: %v\n", i+1, err)
+			continue
+		}
+		if c.Issuer != "client" || c.Subject != "client" || c.Id == "" || c.Expiration.Sub(c.IssuedAt) != time.Minute {
+			t.Errorf("Test %d. Unexpected claims: %+v\n", i+1, c)
+		}
+
+		if _, err := ParseClientAssertion(assertion, "client", key.Public(), v); err == nil {
+			t.Errorf("Test %d. Replayed assertion was accepted\n", i+1)
+		}
+	}
+}
+
+func TestClientSecretJwt(t *testing.T) {
+	secret := []byte("a client secret of at least 32 bytes")
+
+	assertion, err := NewClientSecretJwt("client", testTokenEndpoint, secret, nil)
+	if err != nil {
+		t.Fatalf("Unable to create assertion. Err: %v\n", err)
+	}
+
+	v := &AssertionValidator{Validator: Validator{Audiences: []string{testTokenEndpoint}}}
+	other := &AssertionValidator{Validator: Validator{Audiences: []string{"https://other.example.com/token"}}}
+
+	vectors := []struct {
+		name     string
+		clientId string
+		v        *AssertionValidator
+		key      []byte
+		ok       bool
+	}{
+		{"Wrong audience", "client", other, secret, false},
+		{"Wrong client id", "other", v, secret, false},
+		{"Wrong secret", "client", v, []byte("another secret"), false},
+		{"Valid without client id", "", v, secret, true},
+		{"Replay", "client", v, secret, false},
+	}
+
+	for i, vec := range vectors {
+		key := new(Jwk)
+		if err := key.ImportKey(vec.key); err != nil {
+			t.Fatalf("Unable to import secret. Err: %v\n", err)
+		}
+		if _, err := ParseClientAssertion(assertion, vec.clientId, key, vec.v); (err == nil) != vec.ok {
+			t.Errorf("Test %d (%s). Unexpected result. Err: %v\n", i+1, vec.name, err)
+		}
+	}
+
+	if _, err := NewClientSecretJwt("client", testTokenEndpoint, secret, &AssertionOptions{Algorithm: JwsAlgRS256}); err == nil {
+		t.Errorf("client_secret_jwt was created with RS256\n")
+	}
+}
+
+func TestGrantAssertion(t *testing.T) {
+	key := new(Jwk)
+	if err := json.Unmarshal(jwaSignerTestVectors[1].signKeyJson, key); err != nil {
+		t.Fatalf("Unable to unmarshal key. Err: %v\n", err)
+	}
+
+	assertion, err := NewGrantAssertion("https://jwt-idp.example.com", "mailto:mike@example.com", testTokenEndpoint,
+		key, &AssertionOptions{Algorithm: JwsAlgES256, Lifetime: time.Hour})
+	if err != nil {
+		t.Fatalf("Unable to create assertion. Err: %v\n", err)
+	}
+
+	v := &AssertionValidator{
+		Validator:   Validator{Audiences: []string{testTokenEndpoint}},
+		MaxLifetime: 5 * time.Minute,
+	}
+	if _, err := ParseGrantAssertion(assertion, key, v); err == nil {
+		t.Errorf("Assertion exceeding the maximum lifetime was accepted\n")
+	}
+
+	v.MaxLifetime = 0
+	c, err := ParseGrantAssertion(assertion, key, v)
+	if err != nil {
+		t.Fatalf("Unable to validate assertion. Err: %v\n", err)
+	}
+	if c.Issuer != "https://jwt-idp.example.com" || c.Subject != "mailto:mike@example.com" {
+		t.Errorf("Unexpected claims: %+v\n", c)
+	}
+}
@@ -0,0 +1,185 @@
+package gose
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Confirmation claim name as specified in https://tools.ietf.org/html/rfc7800#section-3.1
+const ClaimConfirmation string = "cnf"
+
+// Confirmation is the "cnf" claim of a proof-of-possession JWT (https://tools.ietf.org/html/rfc7800). It identifies
+// the key the presenter must prove possession of, by one of its members.
+type Confirmation struct {
+	// Jwk is the proof-of-possession public key
+	Jwk *Jwk `json:"jwk,omitempty"`
+	// Jwe is the compact serialized JWE of an encrypted (e.g. symmetric) proof-of-possession key
+	Jwe string `json:"jwe,omitempty"`
+	// KeyId identifies the proof-of-possession key by key id
+	KeyId string `json:"kid,omitempty"`
+	// Jkt is the base64url encoded JWK SHA-256 Thumbprint of the proof-of-possession key
+	// (https://tools.ietf.org/html/rfc9449#section-6.1)
+	Jkt string `json:"jkt,omitempty"`
+	// X5tS256 is the base64url encoded SHA-256 thumbprint of the client certificate the token is bound to
+	// (https://tools.ietf.org/html/rfc8705#section-3.1)
+	X5tS256 string `json:"x5t#S256,omitempty"`
+}
+
+// Confirmation returns the confirmation (cnf) claim, or nil if the claim set has none
+func (c *ClaimSet) Confirmation() (*Confirmation, error) {
+	v, ok := c.AdditionalClaims[ClaimConfirmation]
+	if !ok {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	cnf := new(Confirmation)
+	if err := json.Unmarshal(data, cnf); err != nil {
+		return nil, fmt.Errorf("Invalid confirmation (cnf) claim: %v", err)
+	}
+
+	return cnf, nil
+}
+
+// SetConfirmation sets the confirmation (cnf) claim. An embedded jwk must be a public key; symmetric keys must be
+// encrypted and set as jwe.
+func (c *ClaimSet) SetConfirmation(cnf *Confirmation) error {
+	if cnf == nil {
+		delete(c.AdditionalClaims, ClaimConfirmation)
+		return nil
+	}
+
+	if cnf.Jwk != nil && (cnf.Jwk.Type == KeyTypeOct || cnf.Jwk.D != nil) {
+		return errors.New("Confirmation jwk must be a public key")
+	}
+
+	data, err := json.Marshal(cnf)
+	if err != nil {
+		return err
+	}
+	var obj map[string]interface{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	} else if len(obj) < 1 {
+		return errors.New("Confirmation must identify a proof-of-possession key")
+	}
+
+	if c.AdditionalClaims == nil {
+		c.AdditionalClaims = make(map[string]interface{})
+	}
+	c.AdditionalClaims[ClaimConfirmation] = obj
+
+	return nil
+}
+
+// DecryptKey decrypts the encrypted proof-of-possession key (jwe) as specified in
+// https://tools.ietf.org/html/rfc7800#section-3.3, using the recipient's key resolved by ks, and sets Jwk to the
+// decrypted key. VerifyKey and VerifyJws then check the presented key or JWS against it.
+func (cnf *Confirmation) DecryptKey(ks KeySource) error {
+	if cnf.Jwe == "" {
+		return errors.New("Confirmation has no encrypted key (cnf.jwe)")
+	} else if cnf.Jwk != nil {
+		return errors.New("Confirmation must not have both a key (cnf.jwk) and an encrypted key (cnf.jwe)")
+	}
+
+	jwe := new(Jwe)
+	if err := jwe.UnmarshalCompact([]byte(cnf.Jwe)); err != nil {
+		return fmt.Errorf("Invalid encrypted confirmation key (cnf.jwe): %v", err)
+	}
+	if err := jwe.DecryptWithKeySource(ks); err != nil {
+		return err
+	}
+
+	key := new(Jwk)
+	if err := json.Unmarshal(jwe.Message, key); err != nil {
+		return fmt.Errorf("Invalid encrypted confirmation key (cnf.jwe): %v", err)
+	}
+	cnf.Jwk = key
+
+	return nil
+}
+
+// VerifyKey checks that the presented proof-of-possession key matches the confirmation. Every key-identifying member
+// that is present must match: jwk and jkt by JWK Thumbprint and kid by key id. An encrypted key (jwe) must first be
+// decrypted with DecryptKey. A confirmation with only an encrypted key or a certificate thumbprint (x5t#S256, see
+// VerifyCertificate) can't be checked against a public key and is rejected.
+func (cnf *Confirmation) VerifyKey(key *Jwk) error {
+	if key == nil {
+		return errors.New("No proof-of-possession key was presented")
+	}
+
+	checked := false
+	if cnf.Jwk != nil || cnf.Jkt != "" {
+		tp, err := key.ThumbprintB64()
+		if err != nil {
+			return err
+		}
+
+		if cnf.Jwk != nil {
+			cnfTp, err := cnf.Jwk.ThumbprintB64()
+			if err != nil {
+				return err
+			} else if subtle.ConstantTimeCompare([]byte(cnfTp), []byte(tp)) != 1 {
+				return errors.New("Presented key doesn't match the confirmation key (cnf.jwk)")
+			}
+		}
+		if cnf.Jkt != "" && subtle.ConstantTimeCompare([]byte(cnf.Jkt), []byte(tp)) != 1 {
+			return errors.New("Presented key doesn't match the confirmation thumbprint (cnf.jkt)")
+		}
+		checked = true
+	}
+
+	if cnf.KeyId != "" {
+		if key.Id != cnf.KeyId {
+			return fmt.Errorf("Presented key id (%s) doesn't match the confirmation key id (cnf.kid)", key.Id)
+		}
+		checked = true
+	}
+
+	if !checked && cnf.Jwe != "" {
+		return errors.New("Confirmation key is encrypted (cnf.jwe) and must be decrypted with DecryptKey")
+	} else if !checked {
+		return errors.New("Confirmation has no key that can be matched against a presented key")
+	}
+
+	return nil
+}
+
+// VerifyJws checks that a JWS was signed with the proof-of-possession key. If the confirmation embeds the key (jwk),
+// it is used to verify the signature. Otherwise ks must resolve the presented key (e.g. from the JWS header or by key
+// id), which is then matched against the confirmation.
+func (cnf *Confirmation) VerifyJws(jws *Jws, ks KeySource, opts ...SignerOption) error {
+	if cnf.Jwk != nil {
+		return jws.VerifyWithKeySource(cnf.Jwk, opts...)
+	} else if ks == nil {
+		return errors.New("A KeySource is required to resolve the presented proof-of-possession key")
+	}
+
+	return jws.VerifyWithKeySource(KeySourceFunc(func(hdr *JwHeader) (*Jwk, error) {
+		key, err := ks.ResolveKey(hdr)
+		if err != nil {
+			return nil, err
+		}
+		if err := cnf.VerifyKey(key); err != nil {
+			return nil, err
+		}
+		return key, nil
+	}), opts...)
+}
+
+// VerifyProofKey checks that the presented key matches the claim set's confirmation (cnf) claim
+func (c *ClaimSet) VerifyProofKey(key *Jwk) error {
+	cnf, err := c.Confirmation()
+	if err != nil {
+		return err
+	} else if cnf == nil {
+		return errors.New("Claim set has no confirmation (cnf) claim")
+	}
+
+	return cnf.VerifyKey(key)
+}
@@ -0,0 +1,202 @@
+package gose
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestClaimSetConfirmation(t *testing.T) {
+	key := new(Jwk)
+	if err := json.Unmarshal(jwaSignerTestVectors[1].signKeyJson, key); err != nil {
+		t.Fatalf("Unable to unmarshal key. Err: %v\n", err)
+	}
+	pub := key.Public()
+	pub.Id = "pop-key"
+	jkt, _ := pub.ThumbprintB64()
+
+	c := new(ClaimSet)
+	if cnf, err := c.Confirmation(); cnf != nil || err != nil {
+		t.Errorf("Expected no confirmation. Got: %+v, Err: %v\n", cnf, err)
+	}
+	if err := c.SetConfirmation(&Confirmation{Jwk: key}); err == nil {
+		t.Errorf("Private key was set as confirmation key\n")
+	}
+	if err := c.SetConfirmation(&Confirmation{}); err == nil {
+		t.Errorf("Empty confirmation was set\n")
+	}
+
+	if err := c.SetConfirmation(&Confirmation{Jwk: pub, Jkt: jkt, KeyId: "pop-key"}); err != nil {
+		t.Fatalf("Unable to set confirmation. Err: %v\n", err)
+	}
+
+	// Round trip through JSON
+	data, err := json.Marshal(c)
+	if err != nil {
+		t.Fatalf("Unable to marshal claims. Err: %v\n", err)
+	}
+	parsed := new(ClaimSet)
+	if err := json.Unmarshal(data, parsed); err != nil {
+		t.Fatalf("Unable to unmarshal claims. Err: %v\n", err)
+	}
+
+	cnf, err := parsed.Confirmation()
+	if err != nil {
+		t.Fatalf("Unable to get confirmation. Err: %v\n", err)
+	}
+	if cnf.Jkt != jkt || cnf.KeyId != "pop-key" || cnf.Jwk == nil || cnf.Jwk.X.Cmp(pub.X) != 0 {
+		t.Errorf("Confirmation doesn't match. Got: %+v\n", cnf)
+	}
+
+	if err := parsed.VerifyProofKey(pub); err != nil {
+		t.Errorf("Unable to verify proof key. Err: %v\n", err)
+	}
+
+	other := new(Jwk)
+	json.Unmarshal(jwaSignerTestVectors[2].signKeyJson, other)
+	other.Id = "pop-key"
+	if err := parsed.VerifyProofKey(other.Public()); err == nil {
+		t.Errorf("Other key was accepted as proof key\n")
+	}
+}
+
+func TestConfirmationVerifyKey(t *testing.T) {
+	key := new(Jwk)
+	json.Unmarshal(jwaSignerTestVectors[1].signKeyJson, key)
+	key.Id = "pop-key"
+	jkt, _ := key.ThumbprintB64()
+
+	vectors := []struct {
+		name string
+		cnf  *Confirmation
+		ok   bool
+	}{
+		{"jkt", &Confirmation{Jkt: jkt}, true},
+		{"Wrong jkt", &Confirmation{Jkt: "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"}, false},
+		{"kid", &Confirmation{KeyId: "pop-key"}, true},
+		{"Wrong kid", &Confirmation{KeyId: "other"}, false},
+		{"jkt and wrong kid", &Confirmation{Jkt: jkt, KeyId: "other"}, false},
+		{"jwe only", &Confirmation{Jwe: "a.b.c.d.e"}, false},
+	}
+
+	for i, v := range vectors {
+		if err := v.cnf.VerifyKey(key.Public()); (err == nil) != v.ok {
+			t.Errorf("Test %d (%s). Unexpected result. Err: %v\n", i+1, v.name, err)
+		}
+	}
+}
+
+func TestConfirmationVerifyJws(t *testing.T) {
+	key := new(Jwk)
+	json.Unmarshal(jwaSignerTestVectors[1].signKeyJson, key)
+	other := new(Jwk)
+	json.Unmarshal(jwaSignerTestVectors[2].signKeyJson, other)
+
+	sign := func(k *Jwk, alg string) *Jws {
+		jws := &Jws{
+			Payload:    []byte("proof"),
+			Signatures: []*JwsSignature{{ProtectedHeader: &JwHeader{Algorithm: alg, Jwk: k.Public()}}},
+		}
+		if err := jws.Sign(k); err != nil {
+			t.Fatalf("Unable to sign jws. Err: %v\n", err)
+		}
+		compact, err := jws.MarshalCompact()
+		if err != nil {
+			t.Fatalf("Unable to marshal jws. Err: %v\n", err)
+		}
+		parsed := new(Jws)
+		if err := parsed.UnmarshalCompact(compact); err != nil {
+			t.Fatalf("Unable to unmarshal jws. Err: %v\n", err)
+		}
+		return parsed
+	}
+	headerKey := KeySourceFunc(func(hdr *JwHeader) (*Jwk, error) { return hdr.Jwk, nil })
+	jkt, _ := key.ThumbprintB64()
+
+	vectors := []struct {
+		name string
+		cnf  *Confirmation
+		jws  *Jws
+		ks   KeySource
+		ok   bool
+	}{
+		{"jwk", &Confirmation{Jwk: key.Public()}, sign(key, JwsAlgES256), nil, true},
+		{"jwk signed by other key", &Confirmation{Jwk: key.Public()}, sign(other, JwsAlgRS256), nil, false},
+		{"jkt", &Confirmation{Jkt: jkt}, sign(key, JwsAlgES256), headerKey, true},
+		{"jkt signed by other key", &Confirmation{Jkt: jkt}, sign(other, JwsAlgRS256), headerKey, false},
+		{"jkt without KeySource", &Confirmation{Jkt: jkt}, sign(key, JwsAlgES256), nil, false},
+	}
+
+	for i, v := range vectors {
+		if err := v.cnf.VerifyJws(v.jws, v.ks); (err == nil) != v.ok {
+			t.Errorf("Test %d (%s). Unexpected result. Err: %v\n", i+1, v.name, err)
+		}
+	}
+}
+
+func TestConfirmationDecryptKey(t *testing.T) {
+	popKey := new(Jwk)
+	if err := popKey.ImportKey([]byte("a 256 bit symmetric proof key!!!")); err != nil {
+		t.Fatalf("Unable to import key. Err: %v\n", err)
+	}
+	_, encKey := newTestNestedJwtKeys(t)
+
+	data, err := json.Marshal(popKey)
+	if err != nil {
+		t.Fatalf("Unable to marshal key. Err: %v\n", err)
+	}
+	jwe := &Jwe{
+		ProtectedHeader: &JwHeader{Algorithm: JweAlgRSA_OAEP_256, EncryptionAlg: JweEncAlgA256GCM, ContentType: "jwk+json"},
+		Message:         data,
+	}
+	if err := jwe.Encrypt(encKey); err != nil {
+		t.Fatalf("Unable to encrypt key. Err: %v\n", err)
+	}
+	compact, err := jwe.MarshalCompact()
+	if err != nil {
+		t.Fatalf("Unable to marshal JWE. Err: %v\n", err)
+	}
+
+	jws := &Jws{Payload: []byte("proof"), Signatures: []*JwsSignature{{ProtectedHeader: &JwHeader{Algorithm: JwsAlgHS256}}}}
+	if err := jws.Sign(popKey); err != nil {
+		t.Fatalf("Unable to sign jws. Err: %v\n", err)
+	}
+	signed, err := jws.MarshalCompact()
+	if err != nil {
+		t.Fatalf("Unable to marshal jws. Err: %v\n", err)
+	}
+	jws = new(Jws)
+	if err := jws.UnmarshalCompact(signed); err != nil {
+		t.Fatalf("Unable to unmarshal jws. Err: %v\n", err)
+	}
+
+	cnf := &Confirmation{Jwe: string(compact)}
+	if err := cnf.VerifyJws(jws, nil); err == nil {
+		t.Errorf("JWS was verified before the confirmation key was decrypted\n")
+	}
+	if err := cnf.DecryptKey(encKey); err != nil {
+		t.Fatalf("Unable to decrypt confirmation key. Err: %v\n", err)
+	}
+	if err := cnf.VerifyKey(popKey); err != nil {
+		t.Errorf("Decrypted confirmation key doesn't match. Err: %v\n", err)
+	}
+	if err := cnf.VerifyJws(jws, nil); err != nil {
+		t.Errorf("Unable to verify JWS with the decrypted confirmation key. Err: %v\n", err)
+	}
+
+	other := new(Jwk)
+	json.Unmarshal(jwaSignerTestVectors[1].signKeyJson, other)
+	if err := cnf.VerifyKey(other.Public()); err == nil {
+		t.Errorf("Other key matched the decrypted confirmation key\n")
+	}
+
+	// The encrypted key can only be decrypted with the recipient's key
+	wrongKey := new(Jwk)
+	json.Unmarshal(jwaSignerTestVectors[2].signKeyJson, wrongKey)
+	wrongKey.Algorithm = JweAlgRSA_OAEP
+	if err := (&Confirmation{Jwe: string(compact)}).DecryptKey(wrongKey); err == nil {
+		t.Errorf("Confirmation key was decrypted with a key for another algorithm\n")
+	}
+	if err := (&Confirmation{Jwe: "a.b.c.d.e"}).DecryptKey(encKey); err == nil {
+		t.Errorf("Invalid encrypted confirmation key was decrypted\n")
+	}
+}
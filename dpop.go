@@ -0,0 +1,372 @@
+package gose
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DPoP proof header type as specified in https://tools.ietf.org/html/rfc9449#section-4.2
+const DPoPType string = "dpop+jwt"
+
+// DPoP proof claim names as specified in https://tools.ietf.org/html/rfc9449#section-4.2
+const (
+	ClaimHttpMethod          string = "htm"
+	ClaimHttpUri             string = "htu"
+	ClaimDPoPAccessTokenHash string = "ath"
+)
+
+// Default time a DPoP proof is accepted after its creation
+const defaultDPoPMaxAge = time.Minute
+
+// HTTP header names used by DPoP
+const (
+	DPoPHeader      string = "DPoP"
+	DPoPNonceHeader string = "DPoP-Nonce"
+)
+
+// DPoPProofOptions configures how a DPoP proof is created
+type DPoPProofOptions struct {
+	// Algorithm is the JWS algorithm (alg). If empty, the key's algorithm is used.
+	Algorithm string
+	// AccessToken is the access token the proof is presented with. If set, its hash (ath) is included.
+	AccessToken string
+	// Nonce is the nonce provided by the server in the DPoP-Nonce header
+	Nonce string
+	// Clock returns the current time. If nil, time.Now is used.
+	Clock func() time.Time
+}
+
+// NewDPoPProof creates a DPoP proof (https://tools.ietf.org/html/rfc9449#section-4) for an HTTP request. The proof is
+// signed with the private key, whose public key is included in the header (jwk). The query and fragment of the URI
+// are not part of the proof.
+func NewDPoPProof(key *Jwk, method string, uri string, opts *DPoPProofOptions) (string, error) {
+	if key == nil || key.Type == KeyTypeOct {
+		return "", errors.New("A DPoP proof requires an RSA or EC private key")
+	}
+	if opts == nil {
+		opts = &DPoPProofOptions{}
+	}
+
+	htu, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	htu.RawQuery = ""
+	htu.Fragment = ""
+
+	now := time.Now()
+	if opts.Clock != nil {
+		now = opts.Clock()
+	}
+	jti, err := randomJti()
+	if err != nil {
+		return "", err
+	}
+
+	claims := &ClaimSet{
+		Id:       jti,
+		IssuedAt: now,
+		AdditionalClaims: map[string]interface{}{
+			ClaimHttpMethod: method,
+			ClaimHttpUri:    htu.String(),
+		},
+	}
+	if opts.AccessToken != "" {
+		claims.AdditionalClaims[ClaimDPoPAccessTokenHash] = dpopAccessTokenHash(opts.AccessToken)
+	}
+	if opts.Nonce != "" {
+		claims.AdditionalClaims[ClaimNonce] = opts.Nonce
+	}
+
+	// The proof is only bound to the embedded key, so the key id isn't included
+	signKey := *key
+	signKey.Id = ""
+	pub := signKey.Public()
+
+	return SignJwt(claims, &signKey, &JwtSignOptions{
+		Algorithm: opts.Algorithm,
+		Type:      DPoPType,
+		Header:    &JwHeader{Jwk: pub},
+	})
+}
+
+// DPoPRequest describes the HTTP request a DPoP proof is verified against
+type DPoPRequest struct {
+	// Method is the HTTP method of the request
+	Method string
+	// Uri is the HTTP URI of the request. The query and fragment are ignored.
+	Uri string
+	// AccessToken is the access token presented with the proof. If set, the proof must contain its hash (ath).
+	AccessToken string
+	// Nonce is the nonce the server provided. If set, the proof must contain it.
+	Nonce string
+	// Jkt is the base64url encoded JWK SHA-256 Thumbprint the access token is bound to (cnf.jkt, see
+	// ClaimSet.Confirmation). If set, the proof's key must match it.
+	Jkt string
+}
+
+// DPoPProof is a verified DPoP proof
+type DPoPProof struct {
+	Header *JwHeader
+	Claims *ClaimSet
+	// Jkt is the base64url encoded JWK SHA-256 Thumbprint of the proof's key, to bind or match an access token
+	Jkt string
+}
+
+// DPoPVerifier verifies DPoP proofs as specified in https://tools.ietf.org/html/rfc9449#section-4.3. The jti of
+// accepted proofs is recorded in ReplayCache until they are too old to be accepted; without a ReplayCache, the
+// verifier records them in memory and the same verifier must be used for every request.
+type DPoPVerifier struct {
+	// Algorithms are the accepted JWS algorithms. If empty, any RSA or EC algorithm is accepted.
+	Algorithms []string
+	// MaxAge is how long after its creation (iat) a proof is accepted. Defaults to 1 minute.
+	MaxAge time.Duration
+	// Leeway is the allowed clock skew when checking iat
+	Leeway time.Duration
+	// Clock returns the current time. If nil, time.Now is used.
+	Clock func() time.Time
+	// ReplayCache records the jti of accepted proofs. If nil, an in-memory cache of the verifier is used.
+	ReplayCache ReplayCache
+
+	replays MemoryReplayCache
+}
+
+// Verify verifies a DPoP proof for the request. The proof's signature is verified with the public key in its header,
+// and the key is returned as a JWK thumbprint (Jkt) so the caller can bind or match the access token.
+func (v *DPoPVerifier) Verify(proof string, req *DPoPRequest) (*DPoPProof, error) {
+	if req == nil {
+		return nil, errors.New("The request to verify the DPoP proof against is required")
+	}
+
+	var jkt string
+	ks := KeySourceFunc(func(hdr *JwHeader) (*Jwk, error) {
+		if !strings.EqualFold(hdr.Type, DPoPType) {
+			return nil, fmt.Errorf("JWT type (typ=%s) is not a DPoP proof (%s)", hdr.Type, DPoPType)
+		}
+		if err := v.checkAlg(hdr.Algorithm); err != nil {
+			return nil, err
+		}
+
+		jwk, err := dpopKey(hdr)
+		if err != nil {
+			return nil, err
+		}
+		if jkt, err = jwk.ThumbprintB64(); err != nil {
+			return nil, err
+		}
+		return jwk, nil
+	})
+
+	jwt, err := parseJwtPayload(proof, ks, nil)
+	if err != nil {
+		return nil, err
+	} else if len(jwt.Outer) > 0 {
+		return nil, errors.New("DPoP proof must not be a nested JWT")
+	}
+
+	claims := new(ClaimSet)
+	if err := claims.UnmarshalJSON(jwt.Payload); err != nil {
+		return nil, err
+	}
+
+	errs := v.validateClaims(claims, req)
+	if req.Jkt != "" && subtle.ConstantTimeCompare([]byte(req.Jkt), []byte(jkt)) != 1 {
+		errs = append(errs, &ClaimError{"jkt", errors.New("DPoP proof key doesn't match the access token's key (cnf.jkt)")})
+	}
+	if err := errs.err(); err != nil {
+		return nil, err
+	}
+
+	cache := v.ReplayCache
+	if cache == nil {
+		cache = &v.replays
+	}
+	ok, err := cache.Add(jkt+" "+claims.Id, claims.IssuedAt.Add(v.maxAge()+v.Leeway))
+	if err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, ClaimErrors{&ClaimError{ClaimId, errors.New("DPoP proof has already been used")}}
+	}
+
+	return &DPoPProof{Header: jwt.Header, Claims: claims, Jkt: jkt}, nil
+}
+
+// Validates the proof's claims against the request
+func (v *DPoPVerifier) validateClaims(c *ClaimSet, req *DPoPRequest) ClaimErrors {
+	var errs ClaimErrors
+
+	if c.Id == "" {
+		errs = append(errs, &ClaimError{ClaimId, errors.New("Required claim is missing")})
+	}
+
+	now := v.now()
+	if c.IssuedAt.IsZero() {
+		errs = append(errs, &ClaimError{ClaimIssuedAt, errors.New("Required claim is missing")})
+	} else if now.Add(v.Leeway).Before(c.IssuedAt) {
+		errs = append(errs, &ClaimError{ClaimIssuedAt, errors.New("DPoP proof was issued in the future")})
+	} else if now.Sub(c.IssuedAt) > v.maxAge()+v.Leeway {
+		errs = append(errs, &ClaimError{ClaimIssuedAt, errors.New("DPoP proof is too old")})
+	}
+
+	if htm, _, err := c.stringClaim(ClaimHttpMethod); err != nil {
+		errs = append(errs, &ClaimError{ClaimHttpMethod, err})
+	} else if htm == "" || htm != req.Method {
+		errs = append(errs, &ClaimError{ClaimHttpMethod, fmt.Errorf("HTTP method (%s) doesn't match the request", htm)})
+	}
+
+	if htu, _, err := c.stringClaim(ClaimHttpUri); err != nil {
+		errs = append(errs, &ClaimError{ClaimHttpUri, err})
+	} else if !dpopUrisMatch(htu, req.Uri) {
+		errs = append(errs, &ClaimError{ClaimHttpUri, fmt.Errorf("HTTP URI (%s) doesn't match the request", htu)})
+	}
+
+	if req.AccessToken != "" {
+		ath, _, err := c.stringClaim(ClaimDPoPAccessTokenHash)
+		if err != nil {
+			errs = append(errs, &ClaimError{ClaimDPoPAccessTokenHash, err})
+		} else if subtle.ConstantTimeCompare([]byte(ath), []byte(dpopAccessTokenHash(req.AccessToken))) != 1 {
+			errs = append(errs, &ClaimError{ClaimDPoPAccessTokenHash, errors.New("Access token hash doesn't match")})
+		}
+	}
+
+	if req.Nonce != "" {
+		nonce, _, err := c.stringClaim(ClaimNonce)
+		if err != nil {
+			errs = append(errs, &ClaimError{ClaimNonce, err})
+		} else if subtle.ConstantTimeCompare([]byte(nonce), []byte(req.Nonce)) != 1 {
+			errs = append(errs, &ClaimError{ClaimNonce, errors.New("Nonce doesn't match the server provided nonce")})
+		}
+	}
+
+	return errs
+}
+
+// Returns an error unless the algorithm is an accepted asymmetric algorithm
+func (v *DPoPVerifier) checkAlg(alg string) error {
+	if kty := GetKeyType(alg); !IsValidJwsAlg(alg) || (kty != KeyTypeRSA && kty != KeyTypeEC) {
+		return fmt.Errorf("JWS ALG: %s can not be used for DPoP proofs", alg)
+	}
+	if len(v.Algorithms) > 0 && !containsString(v.Algorithms, alg) {
+		return fmt.Errorf("JWS ALG: %s is not accepted", alg)
+	}
+	return nil
+}
+
+func (v *DPoPVerifier) maxAge() time.Duration {
+	if v.MaxAge > 0 {
+		return v.MaxAge
+	}
+	return defaultDPoPMaxAge
+}
+
+func (v *DPoPVerifier) now() time.Time {
+	if v.Clock != nil {
+		return v.Clock()
+	}
+	return time.Now()
+}
+
+// Returns the public key embedded in a DPoP proof's header
+func dpopKey(hdr *JwHeader) (*Jwk, error) {
+	if hdr.Jwk == nil {
+		return nil, errors.New("DPoP proof has no jwk header parameter")
+	} else if hdr.Jwk.D != nil || hdr.Jwk.Type == KeyTypeOct || len(hdr.Jwk.KeyValue) > 0 {
+		return nil, errors.New("DPoP proof jwk must be a public key")
+	}
+
+	jwk := hdr.Jwk.Public()
+	if jwk == nil {
+		return nil, fmt.Errorf("DPoP proof key type (kty=%v) is not supported", hdr.Jwk.Type)
+	} else if err := jwk.Validate(); err != nil {
+		return nil, err
+	} else if kty := GetKeyType(hdr.Algorithm); kty != jwk.Type {
+		return nil, fmt.Errorf("DPoP proof key type (kty=%v) doesn't match the algorithm key type (%v)", jwk.Type, kty)
+	}
+
+	return jwk, nil
+}
+
+// Returns the ath value for an access token: the base64url encoded SHA-256 hash of the token
+func dpopAccessTokenHash(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Compares two HTTP URIs after syntax-based normalization (https://tools.ietf.org/html/rfc3986#section-6.2.2) and
+// scheme-based normalization of the default port and empty path, ignoring the query and fragment.
+func dpopUrisMatch(a string, b string) bool {
+	na, err := normalizeHttpUri(a)
+	if err != nil {
+		return false
+	}
+	nb, err := normalizeHttpUri(b)
+	if err != nil {
+		return false
+	}
+	return na == nb
+}
+
+func normalizeHttpUri(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	if scheme != "http" && scheme != "https" {
+		return "", fmt.Errorf("URI (%s) is not an HTTP URI", uri)
+	}
+
+	// Keep the host as is (IPv6 literals stay bracketed), only dropping an empty or default port
+	host := strings.ToLower(u.Host)
+	if port := u.Port(); port == "" || (scheme == "http" && port == "80") || (scheme == "https" && port == "443") {
+		host = strings.TrimSuffix(host, ":"+port)
+	}
+
+	// Compare the escaped path, so that an encoded reserved character (e.g. /a%2Fb) doesn't match its decoded form
+	path := normalizePercentEncoding(u.EscapedPath())
+	if path == "" {
+		path = "/"
+	}
+
+	return scheme + "://" + host + path, nil
+}
+
+// Normalizes the percent-encoding of an escaped URI component (https://tools.ietf.org/html/rfc3986#section-6.2.2.2):
+// percent-encoded unreserved characters are decoded and the hex digits of other percent-encodings are uppercased.
+func normalizePercentEncoding(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i+2 >= len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		c, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+		if err != nil {
+			b.WriteByte(s[i])
+			continue
+		}
+		if isUnreservedUriChar(byte(c)) {
+			b.WriteByte(byte(c))
+		} else {
+			b.WriteString(strings.ToUpper(s[i : i+3]))
+		}
+		i += 2
+	}
+
+	return b.String()
+}
+
+// Returns true for the unreserved characters of https://tools.ietf.org/html/rfc3986#section-2.3
+func isUnreservedUriChar(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '.' || c == '_' ||
+		c == '~'
+}
@@ -0,0 +1,158 @@
+package gose
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDPoPUrisMatch(t *testing.T) {
+	vectors := []struct {
+		a  string
+		b  string
+		ok bool
+	}{
+		{"https://server.example.com/token", "https://server.example.com/token", true},
+		{"HTTPS://Server.Example.com:443/token", "https://server.example.com/token?a=b#c", true},
+		{"http://server.example.com:80", "http://server.example.com/", true},
+		{"https://server.example.com:8443/token", "https://server.example.com/token", false},
+		{"https://server.example.com/token", "http://server.example.com/token", false},
+		{"https://server.example.com/Token", "https://server.example.com/token", false},
+		{"ftp://server.example.com/token", "ftp://server.example.com/token", false},
+		{"https://[::1]:8443/token", "https://[::1]:8443/token", true},
+		{"https://[::1]:443/token", "https://[::1]/token", true},
+		{"https://[::1]:8443/token", "https://[::1:8443]/token", false},
+		{"https://server.example.com/a%2Fb", "https://server.example.com/a/b", false},
+		{"https://server.example.com/a%2fb", "https://server.example.com/a%2Fb", true},
+		{"https://server.example.com/%7Euser/t%6Fken", "https://server.example.com/~user/token", true},
+		{"https://server.example.com/a%3Bb", "https://server.example.com/a;b", false},
+	}
+
+	for i, v := range vectors {
+		if dpopUrisMatch(v.a, v.b) != v.ok {
+			t.Errorf("Test %d. Expected match of %s and %s to be %v\n", i+1, v.a, v.b, v.ok)
+		}
+	}
+
+	if uri, err := normalizeHttpUri("https://[::1]:8443/x"); err != nil || uri != "https://[::1]:8443/x" {
+		t.Errorf("Unexpected normalized IPv6 URI: %s. Err: %v\n", uri, err)
+	}
+}
+
+func TestDPoPProof(t *testing.T) {
+	key := new(Jwk)
+	if err := json.Unmarshal(jwaSignerTestVectors[1].signKeyJson, key); err != nil {
+		t.Fatalf("Unable to unmarshal key. Err: %v\n", err)
+	}
+	jkt, err := key.ThumbprintB64()
+	if err != nil {
+		t.Fatalf("Unable to compute thumbprint. Err: %v\n", err)
+	}
+
+	now := time.Now()
+	proof, err := NewDPoPProof(key, "GET", "https://resource.example.org/protectedresource?x=1",
+		&DPoPProofOptions{Algorithm: JwsAlgES256, AccessToken: "Kz~8mXK1EalYznwH-LC-1fBAo.4Ljp~zsPE_NeO.gxU", Nonce: "eyJ7S_zG.eyJH0-Z.HX4w-7v"})
+	if err != nil {
+		t.Fatalf("Unable to create proof. Err: %v\n", err)
+	}
+
+	jws := new(Jws)
+	if err := jws.UnmarshalCompact([]byte(proof)); err != nil {
+		t.Fatalf("Unable to unmarshal proof. Err: %v\n", err)
+	}
+	hdr := jws.Signatures[0].ProtectedHeader
+	if hdr.Type != DPoPType || hdr.Jwk == nil || hdr.Jwk.D != nil || hdr.KeyId != "" {
+		t.Errorf("Unexpected proof header: %+v\n", hdr)
+	}
+
+	req := DPoPRequest{
+		Method:      "GET",
+		Uri:         "https://resource.example.org/protectedresource",
+		AccessToken: "Kz~8mXK1EalYznwH-LC-1fBAo.4Ljp~zsPE_NeO.gxU",
+		Nonce:       "eyJ7S_zG.eyJH0-Z.HX4w-7v",
+		Jkt:         jkt,
+	}
+
+	vectors := []struct {
+		name   string
+		modify func(r *DPoPRequest, v *DPoPVerifier)
+		ok     bool
+	}{
+		{"Wrong method", func(r *DPoPRequest, v *DPoPVerifier) { r.Method = "POST" }, false},
+		{"Wrong uri", func(r *DPoPRequest, v *DPoPVerifier) { r.Uri = "https://resource.example.org/other" }, false},
+		{"Wrong access token", func(r *DPoPRequest, v *DPoPVerifier) { r.AccessToken = "other" }, false},
+		{"Wrong nonce", func(r *DPoPRequest, v *DPoPVerifier) { r.Nonce = "other" }, false},
+		{"Wrong jkt", func(r *DPoPRequest, v *DPoPVerifier) { r.Jkt = "other" }, false},
+		{"Too old", func(r *DPoPRequest, v *DPoPVerifier) {
+			v.Clock = func() time.Time { return now.Add(2 * time.Minute) }
+		}, false},
+		{"Issued in the future", func(r *DPoPRequest, v *DPoPVerifier) {
+			v.Clock = func() time.Time { return now.Add(-time.Minute) }
+		}, false},
+		{"Algorithm not accepted", func(r *DPoPRequest, v *DPoPVerifier) { v.Algorithms = []string{JwsAlgPS256} }, false},
+		{"Valid", func(r *DPoPRequest, v *DPoPVerifier) {}, true},
+	}
+
+	for i, vec := range vectors {
+		r := req
+		v := new(DPoPVerifier)
+		vec.modify(&r, v)
+
+		p, err := v.Verify(proof, &r)
+		if (err == nil) != vec.ok {
+			t.Errorf("Test %d (%s). Unexpected result. Err: %v\n", i+1, vec.name, err)
+		} else if err == nil && p.Jkt != jkt {
+			t.Errorf("Test %d (%s). Expected jkt: %s, Got: %s\n", i+1, vec.name, jkt, p.Jkt)
+		}
+	}
+
+	v := new(DPoPVerifier)
+	if _, err := v.Verify(proof, &req); err != nil {
+		t.Fatalf("Unable to verify proof. Err: %v\n", err)
+	}
+	if _, err := v.Verify(proof, &req); err == nil {
+		t.Errorf("Replayed proof was accepted\n")
+	}
+}
+
+func TestDPoPProofRejectsInvalidKeys(t *testing.T) {
+	key := new(Jwk)
+	if err := json.Unmarshal(jwaSignerTestVectors[1].signKeyJson, key); err != nil {
+		t.Fatalf("Unable to unmarshal key. Err: %v\n", err)
+	}
+	claims := &ClaimSet{Id: "1", IssuedAt: time.Now(), AdditionalClaims: map[string]interface{}{
+		ClaimHttpMethod: "GET", ClaimHttpUri: "https://server.example.com/"}}
+	req := &DPoPRequest{Method: "GET", Uri: "https://server.example.com/"}
+	okpKey := new(Jwk)
+	if err := json.Unmarshal([]byte(`{"kty":"OKP","crv":"Ed25519","x":"11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"}`), okpKey); err != nil {
+		t.Fatalf("Unable to unmarshal key. Err: %v\n", err)
+	}
+
+	vectors := []struct {
+		name string
+		opts *JwtSignOptions
+	}{
+		{"Private key in header", &JwtSignOptions{Algorithm: JwsAlgES256, Type: DPoPType, Header: &JwHeader{Jwk: key}}},
+		{"No key in header", &JwtSignOptions{Algorithm: JwsAlgES256, Type: DPoPType}},
+		{"Wrong type", &JwtSignOptions{Algorithm: JwsAlgES256, Header: &JwHeader{Jwk: key.Public()}}},
+		{"Unsupported key type in header", &JwtSignOptions{Algorithm: JwsAlgES256, Type: DPoPType, Header: &JwHeader{Jwk: okpKey}}},
+	}
+
+	for i, v := range vectors {
+		proof, err := SignJwt(claims, key, v.opts)
+		if err != nil {
+			t.Fatalf("Test %d (%s). Unable to sign proof. Err: %v\n", i+1, v.name, err)
+		}
+		verifier := new(DPoPVerifier)
+		if _, err := verifier.Verify(proof, req); err == nil {
+			t.Errorf("Test %d (%s). Invalid proof was accepted\n", i+1, v.name)
+		}
+	}
+
+	hmacKey := new(Jwk)
+	hmacKey.ImportKey([]byte(strings.Repeat("k", 32)))
+	if _, err := NewDPoPProof(hmacKey, "GET", "https://server.example.com/", nil); err == nil {
+		t.Errorf("Proof was created with a symmetric key\n")
+	}
+}
@@ -0,0 +1,153 @@
+package gose
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Maximum number of redirects followed by httpsFetcher
+const httpsFetchMaxRedirects = 5
+
+// httpsFetcher fetches documents referenced by URLs taken from tokens (e.g. jku, x5u or a status list uri). Only
+// HTTPS URLs whose host is in hosts, or which are listed in urls, are fetched, and redirects are only followed to
+// such URLs, so a token can't make the fetcher request a URL that it introduced itself.
+type httpsFetcher struct {
+	// name describes the fetched URLs in errors, e.g. "Key URL"
+	name    string
+	hosts   []string
+	urls    []string
+	client  *http.Client
+	timeout time.Duration
+	maxSize int64
+}
+
+// Returns an error unless the URL is an HTTPS URL on the allowlist
+func (f *httpsFetcher) checkAllowed(u string) error {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return err
+	}
+	if parsed.Scheme != "https" {
+		return fmt.Errorf("%s (%s) must use https", f.name, u)
+	}
+
+	for _, v := range f.urls {
+		if v == u {
+			return nil
+		}
+	}
+	for _, v := range f.hosts {
+		if strings.EqualFold(v, parsed.Host) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%s (%s) is not allowlisted", f.name, u)
+}
+
+// Performs an HTTP GET request of an allowlisted URL, enforcing the response size limit. If accept is set, it is sent
+// as the Accept header.
+func (f *httpsFetcher) fetch(u string, accept string) ([]byte, error) {
+	if err := f.checkAllowed(u); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+
+	resp, err := f.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s (%s) returned HTTP status %d", f.name, u, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, f.maxSize+1))
+	if err != nil {
+		return nil, err
+	} else if int64(len(body)) > f.maxSize {
+		return nil, fmt.Errorf("%s (%s) response exceeds the maximum size of %d bytes", f.name, u, f.maxSize)
+	}
+
+	return body, nil
+}
+
+// Returns a copy of the HTTP client, configured to only follow redirects to allowlisted URLs
+func (f *httpsFetcher) httpClient() *http.Client {
+	client := &http.Client{Timeout: f.timeout}
+	if f.client != nil {
+		c := *f.client
+		client = &c
+	}
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= httpsFetchMaxRedirects {
+			return fmt.Errorf("Stopped after %d redirects", httpsFetchMaxRedirects)
+		}
+		return f.checkAllowed(req.URL.String())
+	}
+
+	return client
+}
+
+// ttlCache is a size bounded cache of fetched values that expire. The zero value is ready to use.
+type ttlCache struct {
+	mu      sync.Mutex
+	entries map[string]*ttlCacheEntry
+}
+
+type ttlCacheEntry struct {
+	value   interface{}
+	stored  time.Time
+	expires time.Time
+}
+
+// Returns the entry for the key, including an expired entry, or nil
+func (c *ttlCache) get(key string) *ttlCacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.entries[key]
+}
+
+// Stores the value until it expires. If the cache has maxEntries entries, expired entries are evicted first and then
+// the entries closest to expiring.
+func (c *ttlCache) put(key string, value interface{}, now time.Time, expires time.Time, maxEntries int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[string]*ttlCacheEntry)
+	}
+
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= maxEntries {
+		for k, v := range c.entries {
+			if !now.Before(v.expires) {
+				delete(c.entries, k)
+			}
+		}
+		for len(c.entries) >= maxEntries {
+			var first string
+			for k, v := range c.entries {
+				if first == "" || v.expires.Before(c.entries[first].expires) {
+					first = k
+				}
+			}
+			delete(c.entries, first)
+		}
+	}
+
+	c.entries[key] = &ttlCacheEntry{value: value, stored: now, expires: expires}
+}
@@ -0,0 +1,247 @@
+package gose
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// JWT introspection response header types as specified in https://tools.ietf.org/html/rfc9701#section-5
+const (
+	IntrospectionType      string = "token-introspection+jwt"
+	IntrospectionMediaType string = "application/token-introspection+jwt"
+)
+
+// ClaimTokenIntrospection is the claim that holds the introspection result, see
+// https://tools.ietf.org/html/rfc9701#section-5
+const ClaimTokenIntrospection string = "token_introspection"
+
+// Token introspection response parameters as specified in https://tools.ietf.org/html/rfc7662#section-2.2
+const (
+	IntrospectionActive    string = "active"
+	IntrospectionUsername  string = "username"
+	IntrospectionTokenType string = "token_type"
+)
+
+// IntrospectionResult is the result of introspecting a token (https://tools.ietf.org/html/rfc7662#section-2.2). The
+// typed fields take precedence over the corresponding members in Claims.
+type IntrospectionResult struct {
+	// Active is whether the token is active. The other fields are only set for an active token.
+	Active bool
+	// Claims holds the token's registered claims (iss, sub, aud, exp, nbf, iat, jti) and any other members, such as cnf
+	Claims *ClaimSet
+	// ClientId is the client the token was issued to (client_id)
+	ClientId string
+	// Scope is the set of scopes granted (scope)
+	Scope ScopeSet
+	// Username is the human-readable identifier of the resource owner (username)
+	Username string
+	// TokenType is the type of the token, e.g. Bearer or DPoP (token_type)
+	TokenType string
+}
+
+// IntrospectionResponseOptions configures how a JWT introspection response is created
+type IntrospectionResponseOptions struct {
+	// Clock returns the current time. If nil, time.Now is used.
+	Clock func() time.Time
+	// SignOptions configures the signature. The type (typ) is always "token-introspection+jwt".
+	SignOptions *JwtSignOptions
+	// EncryptionKey, if set, is the resource server's key that the signed response is encrypted with
+	EncryptionKey *Jwk
+	// EncryptOptions configures the encryption if EncryptionKey is set. The type (typ) defaults to
+	// "token-introspection+jwt".
+	EncryptOptions *JwtEncryptOptions
+}
+
+// NewIntrospectionResponse creates a JWT introspection response (https://tools.ietf.org/html/rfc9701#section-5)
+// issued by the authorization server issuer for the resource server audience, signed with key. The response has iat
+// set to the current time and no exp. For an inactive token, only {"active": false} is included. If
+// opts.EncryptionKey is set, the signed response is then encrypted as a nested JWT.
+func NewIntrospectionResponse(issuer string, audience string, result *IntrospectionResult, key *Jwk, opts *IntrospectionResponseOptions) (string, error) {
+	if issuer == "" || audience == "" {
+		return "", errors.New("An introspection response requires an issuer and an audience")
+	} else if result == nil {
+		return "", errors.New("An introspection response requires an introspection result")
+	}
+	if opts == nil {
+		opts = &IntrospectionResponseOptions{}
+	}
+
+	now := time.Now()
+	if opts.Clock != nil {
+		now = opts.Clock()
+	}
+
+	ti, err := result.marshal()
+	if err != nil {
+		return "", err
+	}
+
+	claims := &ClaimSet{
+		Issuer:           issuer,
+		Audience:         []string{audience},
+		IssuedAt:         now,
+		AdditionalClaims: map[string]interface{}{ClaimTokenIntrospection: ti},
+	}
+
+	o := JwtSignOptions{}
+	if opts.SignOptions != nil {
+		o = *opts.SignOptions
+	}
+	o.Type = IntrospectionType
+
+	token, err := SignJwt(claims, key, &o)
+	if err != nil || opts.EncryptionKey == nil {
+		return token, err
+	}
+
+	eo := JwtEncryptOptions{}
+	if opts.EncryptOptions != nil {
+		eo = *opts.EncryptOptions
+	}
+	if eo.Type == "" {
+		eo.Type = IntrospectionType
+	}
+
+	return EncryptNestedJwt(token, opts.EncryptionKey, &eo)
+}
+
+// Returns the JSON encoded token_introspection claim
+func (r *IntrospectionResult) marshal() (json.RawMessage, error) {
+	if !r.Active {
+		return json.RawMessage(`{"active":false}`), nil
+	}
+
+	c := new(ClaimSet)
+	if r.Claims != nil {
+		*c = *r.Claims
+	}
+
+	c.AdditionalClaims = make(map[string]interface{}, len(c.AdditionalClaims)+5)
+	if r.Claims != nil {
+		for k, v := range r.Claims.AdditionalClaims {
+			c.AdditionalClaims[k] = v
+		}
+	}
+
+	c.AdditionalClaims[IntrospectionActive] = true
+	if r.ClientId != "" {
+		c.AdditionalClaims[ClaimClientId] = r.ClientId
+	}
+	if len(r.Scope) > 0 {
+		c.AdditionalClaims[ClaimScope] = r.Scope.String()
+	}
+	if r.Username != "" {
+		c.AdditionalClaims[IntrospectionUsername] = r.Username
+	}
+	if r.TokenType != "" {
+		c.AdditionalClaims[IntrospectionTokenType] = r.TokenType
+	}
+
+	return json.Marshal(c)
+}
+
+// IntrospectionValidator validates JWT introspection responses as specified in
+// https://tools.ietf.org/html/rfc9701#section-6. Issuers, Audiences and MaxAge apply to the response JWT, not to the
+// introspected token: set Issuers to the authorization server's issuer, Audiences to the resource server's
+// identifiers and MaxAge to limit how long a response is trusted. The iss, aud and iat claims are required.
+type IntrospectionValidator struct {
+	Validator
+	// DecryptionKeys resolves the resource server's keys to decrypt encrypted responses. If nil, encrypted responses
+	// are rejected.
+	DecryptionKeys KeySource
+	// RequireEncryption rejects responses that aren't encrypted
+	RequireEncryption bool
+}
+
+// ValidateClaims validates the introspection response's claims, returning ClaimErrors or nil
+func (v *IntrospectionValidator) ValidateClaims(c *ClaimSet) error {
+	if len(v.Issuers) < 1 || len(v.Audiences) < 1 {
+		return errors.New("IntrospectionValidator requires the accepted issuers and audiences")
+	}
+
+	errs := v.Validator.validate(c)
+	errs = v.requireClaims(c, errs, ClaimIssuer, ClaimAudience, ClaimIssuedAt, ClaimTokenIntrospection)
+
+	return v.checkReplay(c, errs)
+}
+
+// ParseIntrospectionResponse decrypts (if needed), verifies and validates a JWT introspection response and returns
+// the introspection result. ks resolves the authorization server's keys. Responses without the
+// "token-introspection+jwt" type (typ) are rejected.
+func ParseIntrospectionResponse(response string, ks KeySource, v *IntrospectionValidator) (*IntrospectionResult, error) {
+	if v == nil {
+		return nil, errors.New("An IntrospectionValidator is required to validate an introspection response")
+	}
+
+	token, err := decryptJwt(response, v.DecryptionKeys, v.RequireEncryption)
+	if err != nil {
+		return nil, err
+	}
+
+	jwt, err := parseJwtPayload(token, ks, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.EqualFold(jwt.Header.Type, IntrospectionType) && !strings.EqualFold(jwt.Header.Type, IntrospectionMediaType) {
+		return nil, fmt.Errorf("JWT type (typ=%s) is not an introspection response (%s)", jwt.Header.Type, IntrospectionType)
+	}
+
+	claims := new(ClaimSet)
+	if err := claims.UnmarshalJSON(jwt.Payload); err != nil {
+		return nil, err
+	}
+	if err := v.ValidateClaims(claims); err != nil {
+		return nil, err
+	}
+
+	ti, ok := claims.AdditionalClaims[ClaimTokenIntrospection].(map[string]interface{})
+	if !ok {
+		return nil, ClaimErrors{&ClaimError{ClaimTokenIntrospection, errors.New("Claim must be a JSON object")}}
+	}
+	data, err := json.Marshal(ti)
+	if err != nil {
+		return nil, err
+	}
+	tc := new(ClaimSet)
+	if err := tc.UnmarshalJSON(data); err != nil {
+		return nil, err
+	}
+
+	active, ok := tc.AdditionalClaims[IntrospectionActive].(bool)
+	if !ok {
+		return nil, ClaimErrors{&ClaimError{ClaimTokenIntrospection, errors.New("Member active is missing or not a boolean")}}
+	} else if !active {
+		return &IntrospectionResult{}, nil
+	}
+
+	result := &IntrospectionResult{Active: true, Claims: tc}
+	var errs ClaimErrors
+	for _, p := range []struct {
+		name  string
+		value *string
+	}{
+		{ClaimClientId, &result.ClientId},
+		{IntrospectionUsername, &result.Username},
+		{IntrospectionTokenType, &result.TokenType},
+	} {
+		s, _, err := tc.stringClaim(p.name)
+		if err != nil {
+			errs = append(errs, &ClaimError{ClaimTokenIntrospection, fmt.Errorf("Member %s: %v", p.name, err)})
+		}
+		*p.value = s
+	}
+	scope, _, err := tc.stringClaim(ClaimScope)
+	if err != nil {
+		errs = append(errs, &ClaimError{ClaimTokenIntrospection, fmt.Errorf("Member %s: %v", ClaimScope, err)})
+	}
+	result.Scope = ParseScope(scope)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	return result, nil
+}
@@ -0,0 +1,132 @@
+package gose
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIntrospectionResponse(t *testing.T) {
+	serverKey, resourceKey := newTestNestedJwtKeys(t)
+	opts := &IntrospectionResponseOptions{SignOptions: &JwtSignOptions{Algorithm: JwsAlgES256}}
+	v := &IntrospectionValidator{
+		Validator:      Validator{Issuers: []string{"https://as.example.com"}, Audiences: []string{"https://rs.example.com"}},
+		DecryptionKeys: resourceKey,
+	}
+
+	exp := time.Unix(1419356238, 0)
+	result := &IntrospectionResult{
+		Active:    true,
+		Claims:    &ClaimSet{Subject: "Z5O3upPC88QrAjx00dis", Expiration: exp, AdditionalClaims: map[string]interface{}{"extension_field": "twenty-seven"}},
+		ClientId:  "l238j323ds-23ij4",
+		Scope:     ParseScope("read write dolphin"),
+		Username:  "jdoe",
+		TokenType: "Bearer",
+	}
+
+	signed, err := NewIntrospectionResponse("https://as.example.com", "https://rs.example.com", result, serverKey, opts)
+	if err != nil {
+		t.Fatalf("Unable to create introspection response. Err: %v\n", err)
+	}
+	encOpts := *opts
+	encOpts.EncryptionKey = resourceKey
+	encrypted, err := NewIntrospectionResponse("https://as.example.com", "https://rs.example.com", result, serverKey, &encOpts)
+	if err != nil {
+		t.Fatalf("Unable to create encrypted introspection response. Err: %v\n", err)
+	}
+
+	for i, token := range []string{signed, encrypted} {
+		parsed, err := ParseIntrospectionResponse(token, serverKey, v)
+		if err != nil {
+			t.Errorf("Test %d. Unable to parse introspection response. Err: %v\n", i+1, err)
+			continue
+		}
+		if !parsed.Active || parsed.ClientId != result.ClientId || parsed.Scope.String() != "dolphin read write" ||
+			parsed.Username != "jdoe" || parsed.TokenType != "Bearer" {
+			t.Errorf("Test %d. Unexpected introspection result: %+v\n", i+1, parsed)
+		}
+		if parsed.Claims.Subject != result.Claims.Subject || !parsed.Claims.Expiration.Equal(exp) ||
+			parsed.Claims.AdditionalClaims["extension_field"] != "twenty-seven" {
+			t.Errorf("Test %d. Unexpected claims: %+v\n", i+1, parsed.Claims)
+		}
+	}
+
+	// Only active=false is disclosed for an inactive token
+	inactive := *result
+	inactive.Active = false
+	token, _ := NewIntrospectionResponse("https://as.example.com", "https://rs.example.com", &inactive, serverKey, opts)
+	jwt, err := ParseJwt(token, serverKey, nil)
+	if err != nil {
+		t.Fatalf("Unable to parse introspection response. Err: %v\n", err)
+	}
+	if ti, _ := jwt.Claims.AdditionalClaims[ClaimTokenIntrospection].(map[string]interface{}); len(ti) != 1 || ti["active"] != false {
+		t.Errorf("Unexpected token_introspection claim: %v\n", jwt.Claims.AdditionalClaims[ClaimTokenIntrospection])
+	}
+	if parsed, err := ParseIntrospectionResponse(token, serverKey, v); err != nil || parsed.Active || parsed.Claims != nil {
+		t.Errorf("Unexpected inactive result: %+v. Err: %v\n", parsed, err)
+	}
+}
+
+func TestParseIntrospectionResponseRejects(t *testing.T) {
+	serverKey, resourceKey := newTestNestedJwtKeys(t)
+	opts := &IntrospectionResponseOptions{SignOptions: &JwtSignOptions{Algorithm: JwsAlgES256}}
+	v := &IntrospectionValidator{
+		Validator: Validator{Issuers: []string{"https://as.example.com"}, Audiences: []string{"https://rs.example.com"}},
+	}
+	result := &IntrospectionResult{Active: true, ClientId: "client"}
+
+	signed, _ := NewIntrospectionResponse("https://as.example.com", "https://rs.example.com", result, serverKey, opts)
+	otherIss, _ := NewIntrospectionResponse("https://mallory.example.com", "https://rs.example.com", result, serverKey, opts)
+	otherAud, _ := NewIntrospectionResponse("https://as.example.com", "https://other.example.com", result, serverKey, opts)
+
+	oldOpts := *opts
+	oldOpts.Clock = func() time.Time { return time.Now().Add(-time.Hour) }
+	old, _ := NewIntrospectionResponse("https://as.example.com", "https://rs.example.com", result, serverKey, &oldOpts)
+
+	encOpts := *opts
+	encOpts.EncryptionKey = resourceKey
+	encrypted, _ := NewIntrospectionResponse("https://as.example.com", "https://rs.example.com", result, serverKey, &encOpts)
+
+	untyped, _ := SignJwt(&ClaimSet{Issuer: "https://as.example.com", Audience: []string{"https://rs.example.com"},
+		IssuedAt: time.Now(), AdditionalClaims: map[string]interface{}{ClaimTokenIntrospection: map[string]interface{}{"active": true}}},
+		serverKey, &JwtSignOptions{Algorithm: JwsAlgES256})
+	noActive, _ := SignJwt(&ClaimSet{Issuer: "https://as.example.com", Audience: []string{"https://rs.example.com"},
+		IssuedAt: time.Now(), AdditionalClaims: map[string]interface{}{ClaimTokenIntrospection: map[string]interface{}{"scope": "read"}}},
+		serverKey, &JwtSignOptions{Algorithm: JwsAlgES256, Type: IntrospectionType})
+	noIat, _ := SignJwt(&ClaimSet{Issuer: "https://as.example.com", Audience: []string{"https://rs.example.com"},
+		AdditionalClaims: map[string]interface{}{ClaimTokenIntrospection: map[string]interface{}{"active": true}}},
+		serverKey, &JwtSignOptions{Algorithm: JwsAlgES256, Type: IntrospectionType})
+	badScope, _ := SignJwt(&ClaimSet{Issuer: "https://as.example.com", Audience: []string{"https://rs.example.com"},
+		IssuedAt: time.Now(), AdditionalClaims: map[string]interface{}{ClaimTokenIntrospection: map[string]interface{}{"active": true, "scope": 42}}},
+		serverKey, &JwtSignOptions{Algorithm: JwsAlgES256, Type: IntrospectionType})
+	accessToken, _ := SignAccessToken(&AccessToken{Claims: &ClaimSet{Issuer: "https://as.example.com",
+		Audience: []string{"https://rs.example.com"}, Subject: "alice", Expiration: time.Now().Add(time.Hour)}, ClientId: "client"},
+		serverKey, &JwtSignOptions{Algorithm: JwsAlgES256})
+
+	vectors := []struct {
+		name  string
+		token string
+		v     *IntrospectionValidator
+	}{
+		{"Other issuer", otherIss, v},
+		{"Other audience", otherAud, v},
+		{"Too old", old, &IntrospectionValidator{Validator: Validator{Issuers: v.Issuers, Audiences: v.Audiences, MaxAge: time.Minute}}},
+		{"Untyped", untyped, v},
+		{"Access token", accessToken, v},
+		{"No active member", noActive, v},
+		{"No iat", noIat, v},
+		{"Scope not a string", badScope, v},
+		{"Encrypted without decryption keys", encrypted, v},
+		{"Not encrypted", signed, &IntrospectionValidator{Validator: v.Validator, DecryptionKeys: resourceKey, RequireEncryption: true}},
+		{"No audiences", signed, &IntrospectionValidator{Validator: Validator{Issuers: v.Issuers}}},
+	}
+
+	for i, vec := range vectors {
+		if _, err := ParseIntrospectionResponse(vec.token, serverKey, vec.v); err == nil {
+			t.Errorf("Test %d (%s). Introspection response was accepted\n", i+1, vec.name)
+		}
+	}
+
+	if _, err := NewIntrospectionResponse("https://as.example.com", "", result, serverKey, opts); err == nil {
+		t.Errorf("Introspection response without an audience was created\n")
+	}
+}
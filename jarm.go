@@ -0,0 +1,271 @@
+package gose
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Response modes of JWT Secured Authorization Response Mode (JARM) as specified in
+// https://openid.net/specs/oauth-v2-jarm.html#section-2.3
+const (
+	ResponseModeJwt         string = "jwt"
+	ResponseModeQueryJwt    string = "query.jwt"
+	ResponseModeFragmentJwt string = "fragment.jwt"
+	ResponseModeFormPostJwt string = "form_post.jwt"
+)
+
+// ParamResponse is the authorization response parameter that holds the response JWT
+const ParamResponse string = "response"
+
+// Authorization response parameters, see https://tools.ietf.org/html/rfc6749#section-4.1.2
+const (
+	ParamCode             string = "code"
+	ParamState            string = "state"
+	ParamError            string = "error"
+	ParamErrorDescription string = "error_description"
+	ParamErrorUri         string = "error_uri"
+)
+
+// Default lifetime of a created response JWT
+const defaultAuthorizationResponseLifetime = 10 * time.Minute
+
+// AuthorizationResponse holds the parameters of an authorization response. A successful response has a Code (or
+// other Params, e.g. for the implicit flow), an error response has an Error.
+type AuthorizationResponse struct {
+	Code             string
+	State            string
+	Error            string
+	ErrorDescription string
+	ErrorUri         string
+	// Params are any other response parameters
+	Params map[string]interface{}
+	// Header is the protected header of the verified response JWT. It is only set by the parse functions.
+	Header *JwHeader
+	// Claims is the decoded claim set of the verified response JWT. It is only set by the parse functions.
+	Claims *ClaimSet
+}
+
+// AuthorizationResponseOptions configures how a response JWT is created
+type AuthorizationResponseOptions struct {
+	// Lifetime is the time until the response JWT expires. Defaults to 10 minutes.
+	Lifetime time.Duration
+	// Clock returns the current time. If nil, time.Now is used.
+	Clock func() time.Time
+	// SignOptions configures the signature
+	SignOptions *JwtSignOptions
+	// EncryptionKey, if set, is the client's key that the signed response JWT is encrypted with
+	EncryptionKey *Jwk
+	// EncryptOptions configures the encryption if EncryptionKey is set
+	EncryptOptions *JwtEncryptOptions
+}
+
+// NewAuthorizationResponse creates a JARM response JWT (https://openid.net/specs/oauth-v2-jarm.html#section-2.1)
+// issued by the authorization server issuer for clientId, signed with key. If opts.EncryptionKey is set, the signed
+// response is then encrypted as a nested JWT.
+func NewAuthorizationResponse(issuer string, clientId string, resp *AuthorizationResponse, key *Jwk, opts *AuthorizationResponseOptions) (string, error) {
+	if issuer == "" || clientId == "" {
+		return "", errors.New("A response JWT requires an issuer and a client id")
+	} else if resp == nil || (resp.Code == "" && resp.Error == "" && len(resp.Params) == 0) {
+		return "", errors.New("A response JWT requires a code, an error or other response parameters")
+	}
+	if opts == nil {
+		opts = &AuthorizationResponseOptions{}
+	}
+
+	now := time.Now()
+	if opts.Clock != nil {
+		now = opts.Clock()
+	}
+	lifetime := opts.Lifetime
+	if lifetime <= 0 {
+		lifetime = defaultAuthorizationResponseLifetime
+	}
+
+	claims := &ClaimSet{
+		Issuer:           issuer,
+		Audience:         []string{clientId},
+		Expiration:       now.Add(lifetime),
+		AdditionalClaims: make(map[string]interface{}, len(resp.Params)+5),
+	}
+	for k, v := range resp.Params {
+		switch k {
+		case ClaimIssuer, ClaimSubject, ClaimAudience, ClaimExpiration, ClaimNotBefore, ClaimIssuedAt, ClaimId, ParamCode,
+			ParamState, ParamError, ParamErrorDescription, ParamErrorUri:
+			return "", fmt.Errorf("Parameter %s conflicts with a claim of the response JWT", k)
+		}
+		claims.AdditionalClaims[k] = v
+	}
+	for k, v := range map[string]string{ParamCode: resp.Code, ParamState: resp.State, ParamError: resp.Error,
+		ParamErrorDescription: resp.ErrorDescription, ParamErrorUri: resp.ErrorUri} {
+		if v != "" {
+			claims.AdditionalClaims[k] = v
+		}
+	}
+
+	token, err := SignJwt(claims, key, opts.SignOptions)
+	if err != nil || opts.EncryptionKey == nil {
+		return token, err
+	}
+
+	return EncryptNestedJwt(token, opts.EncryptionKey, opts.EncryptOptions)
+}
+
+// AuthorizationResponseUri returns the redirect URI that passes the response JWT to the client in the query
+// (query.jwt) or fragment (fragment.jwt) response mode. The form_post.jwt response mode isn't a redirect.
+func AuthorizationResponseUri(redirectUri string, responseMode string, response string) (string, error) {
+	u, err := url.Parse(redirectUri)
+	if err != nil {
+		return "", err
+	} else if u.Fragment != "" {
+		return "", errors.New("Redirect URI must not contain a fragment")
+	}
+
+	switch responseMode {
+	case ResponseModeQueryJwt:
+		q := u.Query()
+		q.Set(ParamResponse, response)
+		u.RawQuery = q.Encode()
+	case ResponseModeFragmentJwt:
+		return u.String() + "#" + url.Values{ParamResponse: {response}}.Encode(), nil
+	default:
+		return "", fmt.Errorf("Response mode %s doesn't redirect with the response in the URI", responseMode)
+	}
+
+	return u.String(), nil
+}
+
+// AuthorizationResponseValidator validates the response JWTs received by a client, as required by
+// https://openid.net/specs/oauth-v2-jarm.html#section-2.4: set Issuers to the issuer identifier of the authorization
+// server the request was sent to, which prevents mix-up attacks, and Audiences to the client id. The iss, aud and exp
+// claims are required.
+type AuthorizationResponseValidator struct {
+	Validator
+	// DecryptionKeys resolves the client's keys to decrypt encrypted response JWTs. If nil, encrypted response JWTs
+	// are rejected.
+	DecryptionKeys KeySource
+	// RequireEncryption rejects response JWTs that aren't encrypted
+	RequireEncryption bool
+	// State, if set, is the state value of the authorization request that the response must contain
+	State string
+}
+
+// ValidateClaims validates the response JWT's claims, returning ClaimErrors or nil
+func (v *AuthorizationResponseValidator) ValidateClaims(c *ClaimSet) error {
+	if len(v.Issuers) < 1 || len(v.Audiences) < 1 {
+		return errors.New("AuthorizationResponseValidator requires the accepted issuers and audiences")
+	}
+
+	errs := v.Validator.validate(c)
+	errs = v.requireClaims(c, errs, ClaimIssuer, ClaimAudience, ClaimExpiration)
+
+	if v.State != "" {
+		if state, _, err := c.stringClaim(ParamState); err != nil || state != v.State {
+			errs = append(errs, &ClaimError{ParamState, errors.New("State doesn't match the authorization request")})
+		}
+	}
+
+	return v.checkReplay(c, errs)
+}
+
+// ParseAuthorizationResponse decrypts (if needed), verifies and validates a response JWT. ks resolves the
+// authorization server's keys. An error response is returned with Error set, not as an error.
+func ParseAuthorizationResponse(response string, ks KeySource, v *AuthorizationResponseValidator) (*AuthorizationResponse, error) {
+	if v == nil {
+		return nil, errors.New("An AuthorizationResponseValidator is required to validate a response JWT")
+	}
+
+	token, err := decryptJwt(response, v.DecryptionKeys, v.RequireEncryption)
+	if err != nil {
+		return nil, err
+	}
+
+	jwt, err := ParseJwt(token, ks, v)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &AuthorizationResponse{Header: jwt.Header, Claims: jwt.Claims}
+	for _, p := range []struct {
+		name  string
+		value *string
+	}{
+		{ParamCode, &resp.Code},
+		{ParamState, &resp.State},
+		{ParamError, &resp.Error},
+		{ParamErrorDescription, &resp.ErrorDescription},
+		{ParamErrorUri, &resp.ErrorUri},
+	} {
+		s, _, err := jwt.Claims.stringClaim(p.name)
+		if err != nil {
+			return nil, ClaimErrors{&ClaimError{p.name, err}}
+		}
+		*p.value = s
+	}
+	for k, val := range jwt.Claims.AdditionalClaims {
+		switch k {
+		case ParamCode, ParamState, ParamError, ParamErrorDescription, ParamErrorUri:
+			continue
+		}
+		if resp.Params == nil {
+			resp.Params = make(map[string]interface{})
+		}
+		resp.Params[k] = val
+	}
+
+	if resp.Code == "" && resp.Error == "" && len(resp.Params) == 0 {
+		return nil, errors.New("Response JWT has neither a code nor an error")
+	}
+
+	return resp, nil
+}
+
+// ParseAuthorizationResponseUri extracts the response parameter from the URI the client was redirected to and parses
+// it with ParseAuthorizationResponse. With the query.jwt or fragment.jwt response mode, the parameter must be in the
+// query or fragment respectively. With the jwt response mode either is accepted.
+func ParseAuthorizationResponseUri(uri string, responseMode string, ks KeySource, v *AuthorizationResponseValidator) (*AuthorizationResponse, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	fragment, err := url.ParseQuery(u.EscapedFragment())
+	if err != nil {
+		return nil, err
+	}
+
+	var response string
+	switch responseMode {
+	case ResponseModeQueryJwt:
+		response = u.Query().Get(ParamResponse)
+	case ResponseModeFragmentJwt:
+		response = fragment.Get(ParamResponse)
+	case ResponseModeJwt:
+		if response = u.Query().Get(ParamResponse); response == "" {
+			response = fragment.Get(ParamResponse)
+		}
+	default:
+		return nil, fmt.Errorf("Response mode %s doesn't pass the response in the URI", responseMode)
+	}
+	if response == "" {
+		return nil, errors.New("No response parameter found")
+	}
+
+	return ParseAuthorizationResponse(response, ks, v)
+}
+
+// ParseAuthorizationResponseForm extracts the response parameter from a form_post.jwt request body and parses it with
+// ParseAuthorizationResponse
+func ParseAuthorizationResponseForm(r *http.Request, ks KeySource, v *AuthorizationResponseValidator) (*AuthorizationResponse, error) {
+	if r.Method != http.MethodPost {
+		return nil, fmt.Errorf("The form_post.jwt response mode requires a POST request, not %s", r.Method)
+	}
+
+	response := r.PostFormValue(ParamResponse)
+	if response == "" {
+		return nil, errors.New("No response parameter found")
+	}
+
+	return ParseAuthorizationResponse(response, ks, v)
+}
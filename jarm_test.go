@@ -0,0 +1,163 @@
+package gose
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuthorizationResponse(t *testing.T) {
+	serverKey, clientKey := newTestNestedJwtKeys(t)
+	opts := &AuthorizationResponseOptions{SignOptions: &JwtSignOptions{Algorithm: JwsAlgES256}}
+	v := &AuthorizationResponseValidator{
+		Validator:      Validator{Issuers: []string{"https://accounts.example.com"}, Audiences: []string{"s6BhdRkqt3"}},
+		DecryptionKeys: clientKey,
+		State:          "S8NJ7uqk5fY4EjNvP_G_FtyJu6pUsvH9jsYni9dMAJw",
+	}
+
+	resp := &AuthorizationResponse{Code: "PyyFaux2o7Q0YfXBU32jhw.5FXSQpvr8akv9CeRDSd0QA", State: v.State}
+	signed, err := NewAuthorizationResponse("https://accounts.example.com", "s6BhdRkqt3", resp, serverKey, opts)
+	if err != nil {
+		t.Fatalf("Unable to create response JWT. Err: %v\n", err)
+	}
+	encOpts := *opts
+	encOpts.EncryptionKey = clientKey
+	encrypted, err := NewAuthorizationResponse("https://accounts.example.com", "s6BhdRkqt3", resp, serverKey, &encOpts)
+	if err != nil {
+		t.Fatalf("Unable to create encrypted response JWT. Err: %v\n", err)
+	}
+
+	for i, token := range []string{signed, encrypted} {
+		parsed, err := ParseAuthorizationResponse(token, serverKey, v)
+		if err != nil {
+			t.Errorf("Test %d. Unable to parse response JWT. Err: %v\n", i+1, err)
+			continue
+		}
+		if parsed.Code != resp.Code || parsed.State != resp.State || parsed.Error != "" || parsed.Params != nil {
+			t.Errorf("Test %d. Unexpected response: %+v\n", i+1, parsed)
+		}
+	}
+
+	errResp := &AuthorizationResponse{Error: "access_denied", ErrorDescription: "User denied access", State: v.State}
+	token, _ := NewAuthorizationResponse("https://accounts.example.com", "s6BhdRkqt3", errResp, serverKey, opts)
+	parsed, err := ParseAuthorizationResponse(token, serverKey, v)
+	if err != nil || parsed.Error != "access_denied" || parsed.ErrorDescription != "User denied access" || parsed.Code != "" {
+		t.Errorf("Unexpected error response: %+v. Err: %v\n", parsed, err)
+	}
+
+	implicit := &AuthorizationResponse{Params: map[string]interface{}{"access_token": "2YotnFZFEjr1zCsicMWpAA"}}
+	token, _ = NewAuthorizationResponse("https://accounts.example.com", "s6BhdRkqt3", implicit, serverKey, opts)
+	parsed, err = ParseAuthorizationResponse(token, serverKey, &AuthorizationResponseValidator{Validator: v.Validator})
+	if err != nil || parsed.Params["access_token"] != "2YotnFZFEjr1zCsicMWpAA" {
+		t.Errorf("Unexpected response: %+v. Err: %v\n", parsed, err)
+	}
+
+	invalid := []*AuthorizationResponse{nil, {State: "abc"}, {Code: "abc", Params: map[string]interface{}{"iss": "mallory"}}}
+	for i, r := range invalid {
+		if _, err := NewAuthorizationResponse("https://accounts.example.com", "s6BhdRkqt3", r, serverKey, opts); err == nil {
+			t.Errorf("Test %d. Response JWT was created for %+v\n", i+1, r)
+		}
+	}
+}
+
+func TestParseAuthorizationResponseRejects(t *testing.T) {
+	serverKey, clientKey := newTestNestedJwtKeys(t)
+	opts := &AuthorizationResponseOptions{SignOptions: &JwtSignOptions{Algorithm: JwsAlgES256}}
+	v := &AuthorizationResponseValidator{
+		Validator: Validator{Issuers: []string{"https://accounts.example.com"}, Audiences: []string{"s6BhdRkqt3"}},
+	}
+	resp := &AuthorizationResponse{Code: "abc", State: "xyz"}
+
+	signed, _ := NewAuthorizationResponse("https://accounts.example.com", "s6BhdRkqt3", resp, serverKey, opts)
+	otherIss, _ := NewAuthorizationResponse("https://mallory.example.com", "s6BhdRkqt3", resp, serverKey, opts)
+	otherAud, _ := NewAuthorizationResponse("https://accounts.example.com", "other", resp, serverKey, opts)
+
+	oldOpts := *opts
+	oldOpts.Clock = func() time.Time { return time.Now().Add(-time.Hour) }
+	expired, _ := NewAuthorizationResponse("https://accounts.example.com", "s6BhdRkqt3", resp, serverKey, &oldOpts)
+
+	encOpts := *opts
+	encOpts.EncryptionKey = clientKey
+	encrypted, _ := NewAuthorizationResponse("https://accounts.example.com", "s6BhdRkqt3", resp, serverKey, &encOpts)
+
+	noExp, _ := SignJwt(&ClaimSet{Issuer: "https://accounts.example.com", Audience: []string{"s6BhdRkqt3"},
+		AdditionalClaims: map[string]interface{}{"code": "abc"}}, serverKey, &JwtSignOptions{Algorithm: JwsAlgES256})
+	noCode, _ := SignJwt(&ClaimSet{Issuer: "https://accounts.example.com", Audience: []string{"s6BhdRkqt3"},
+		Expiration: time.Now().Add(time.Minute)}, serverKey, &JwtSignOptions{Algorithm: JwsAlgES256})
+
+	vectors := []struct {
+		name  string
+		token string
+		v     *AuthorizationResponseValidator
+	}{
+		{"Other issuer", otherIss, v},
+		{"Other audience", otherAud, v},
+		{"Expired", expired, v},
+		{"No expiration", noExp, v},
+		{"No code or error", noCode, v},
+		{"Other state", signed, &AuthorizationResponseValidator{Validator: v.Validator, State: "other"}},
+		{"Encrypted without decryption keys", encrypted, v},
+		{"Not encrypted", signed, &AuthorizationResponseValidator{Validator: v.Validator, DecryptionKeys: clientKey, RequireEncryption: true}},
+		{"No issuers", signed, &AuthorizationResponseValidator{Validator: Validator{Audiences: []string{"s6BhdRkqt3"}}}},
+		{"Tampered", signed[:len(signed)-4] + "AAAA", v},
+	}
+
+	for i, vec := range vectors {
+		if _, err := ParseAuthorizationResponse(vec.token, serverKey, vec.v); err == nil {
+			t.Errorf("Test %d (%s). Response JWT was accepted\n", i+1, vec.name)
+		}
+	}
+}
+
+func TestAuthorizationResponseUri(t *testing.T) {
+	serverKey, _ := newTestNestedJwtKeys(t)
+	v := &AuthorizationResponseValidator{
+		Validator: Validator{Issuers: []string{"https://accounts.example.com"}, Audiences: []string{"s6BhdRkqt3"}},
+	}
+	token, err := NewAuthorizationResponse("https://accounts.example.com", "s6BhdRkqt3", &AuthorizationResponse{Code: "abc"},
+		serverKey, &AuthorizationResponseOptions{SignOptions: &JwtSignOptions{Algorithm: JwsAlgES256}})
+	if err != nil {
+		t.Fatalf("Unable to create response JWT. Err: %v\n", err)
+	}
+
+	vectors := []struct {
+		mode   string
+		prefix string
+	}{
+		{ResponseModeQueryJwt, "https://client.example.com/cb?foo=bar&response="},
+		{ResponseModeFragmentJwt, "https://client.example.com/cb?foo=bar#response="},
+	}
+	for i, vec := range vectors {
+		uri, err := AuthorizationResponseUri("https://client.example.com/cb?foo=bar", vec.mode, token)
+		if err != nil || !strings.HasPrefix(uri, vec.prefix) {
+			t.Errorf("Test %d (%s). Unexpected redirect URI: %s. Err: %v\n", i+1, vec.mode, uri, err)
+			continue
+		}
+		for _, mode := range []string{vec.mode, ResponseModeJwt} {
+			if resp, err := ParseAuthorizationResponseUri(uri, mode, serverKey, v); err != nil || resp.Code != "abc" {
+				t.Errorf("Test %d (%s). Unable to parse response. Err: %v\n", i+1, mode, err)
+			}
+		}
+	}
+
+	query, _ := AuthorizationResponseUri("https://client.example.com/cb", ResponseModeQueryJwt, token)
+	if _, err := ParseAuthorizationResponseUri(query, ResponseModeFragmentJwt, serverKey, v); err == nil {
+		t.Errorf("Response in the query was accepted for the fragment.jwt response mode\n")
+	}
+	if _, err := AuthorizationResponseUri("https://client.example.com/cb", ResponseModeFormPostJwt, token); err == nil {
+		t.Errorf("Redirect URI was created for the form_post.jwt response mode\n")
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "https://client.example.com/cb",
+		strings.NewReader(url.Values{ParamResponse: {token}}.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if resp, err := ParseAuthorizationResponseForm(r, serverKey, v); err != nil || resp.Code != "abc" {
+		t.Errorf("Unable to parse form_post response. Err: %v\n", err)
+	}
+	if _, err := ParseAuthorizationResponseForm(httptest.NewRequest(http.MethodGet, query, nil), serverKey, v); err == nil {
+		t.Errorf("GET request was accepted for the form_post.jwt response mode\n")
+	}
+}
@@ -1 +1,340 @@
 package gose
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// JwaCrypter is the interface implemented by types that encrypt and decrypt JWE content with a content encryption
+// key (CEK), as specified in https://tools.ietf.org/html/rfc7518#section-5
+type JwaCrypter interface {
+	// KeySize returns the size of the content encryption key in bytes
+	KeySize() int
+	Encrypt(cek, plaintext, aad []byte) (iv, ciphertext, tag []byte, err error)
+	Decrypt(cek, iv, ciphertext, tag, aad []byte) ([]byte, error)
+}
+
+// GCMCrypter implements the AES GCM content encryption algorithms (A128GCM, A192GCM and A256GCM)
+type GCMCrypter struct {
+	KeyLen int
+}
+
+// CBCHMACCrypter implements the AES CBC HMAC SHA-2 content encryption algorithms (A128CBC-HS256, A192CBC-HS384 and
+// A256CBC-HS512). The key is the MAC key followed by the encryption key, each KeyLen/2 bytes.
+type CBCHMACCrypter struct {
+	KeyLen int
+	H      crypto.Hash
+}
+
+// NewJwaCrypter returns a crypter for a JWE content encryption algorithm (enc). An error is returned for an invalid
+// algorithm.
+func NewJwaCrypter(enc string) (JwaCrypter, error) {
+	switch enc {
+	case JweEncAlgA128GCM:
+		return &GCMCrypter{KeyLen: 16}, nil
+	case JweEncAlgA192GCM:
+		return &GCMCrypter{KeyLen: 24}, nil
+	case JweEncAlgA256GCM:
+		return &GCMCrypter{KeyLen: 32}, nil
+	case JweEncAlgA128CBC_HS256:
+		return &CBCHMACCrypter{KeyLen: 32, H: crypto.SHA256}, nil
+	case JweEncAlgA192CBC_HS384:
+		return &CBCHMACCrypter{KeyLen: 48, H: crypto.SHA384}, nil
+	case JweEncAlgA256CBC_HS512:
+		return &CBCHMACCrypter{KeyLen: 64, H: crypto.SHA512}, nil
+	default:
+		return nil, fmt.Errorf("JWE ENC: %s is not a recognized JWE enc.", enc)
+	}
+}
+
+func (gc *GCMCrypter) KeySize() int {
+	return gc.KeyLen
+}
+
+func (gc *GCMCrypter) Encrypt(cek, plaintext, aad []byte) (iv, ciphertext, tag []byte, err error) {
+	aead, err := gc.aead(cek)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	iv = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		return nil, nil, nil, err
+	}
+
+	sealed := aead.Seal(nil, iv, plaintext, aad)
+	split := len(sealed) - aead.Overhead()
+
+	return iv, sealed[:split], sealed[split:], nil
+}
+
+func (gc *GCMCrypter) Decrypt(cek, iv, ciphertext, tag, aad []byte) ([]byte, error) {
+	aead, err := gc.aead(cek)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != aead.NonceSize() || len(tag) != aead.Overhead() {
+		return nil, errors.New("Invalid JWE initialization vector or authentication tag length")
+	}
+
+	sealed := make([]byte, 0, len(ciphertext)+len(tag))
+	sealed = append(sealed, ciphertext...)
+	sealed = append(sealed, tag...)
+
+	plaintext, err := aead.Open(nil, iv, sealed, aad)
+	if err != nil {
+		return nil, errors.New("JWE decryption failed")
+	}
+	return plaintext, nil
+}
+
+func (gc *GCMCrypter) aead(cek []byte) (cipher.AEAD, error) {
+	if len(cek) != gc.KeyLen {
+		return nil, fmt.Errorf("Content encryption key must be %d bytes", gc.KeyLen)
+	}
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (cc *CBCHMACCrypter) KeySize() int {
+	return cc.KeyLen
+}
+
+func (cc *CBCHMACCrypter) Encrypt(cek, plaintext, aad []byte) (iv, ciphertext, tag []byte, err error) {
+	if len(cek) != cc.KeyLen {
+		return nil, nil, nil, fmt.Errorf("Content encryption key must be %d bytes", cc.KeyLen)
+	}
+	block, err := aes.NewCipher(cek[cc.KeyLen/2:])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	iv = make([]byte, aes.BlockSize)
+	if _, err := rand.Read(iv); err != nil {
+		return nil, nil, nil, err
+	}
+
+	// PKCS #7 padding
+	pad := aes.BlockSize - len(plaintext)%aes.BlockSize
+	ciphertext = make([]byte, len(plaintext)+pad)
+	copy(ciphertext, plaintext)
+	for i := len(plaintext); i < len(ciphertext); i++ {
+		ciphertext[i] = byte(pad)
+	}
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, ciphertext)
+
+	return iv, ciphertext, cc.tag(cek, aad, iv, ciphertext), nil
+}
+
+func (cc *CBCHMACCrypter) Decrypt(cek, iv, ciphertext, tag, aad []byte) ([]byte, error) {
+	if len(cek) != cc.KeyLen {
+		return nil, fmt.Errorf("Content encryption key must be %d bytes", cc.KeyLen)
+	}
+	if len(iv) != aes.BlockSize || len(ciphertext) < aes.BlockSize || len(ciphertext)%aes.BlockSize != 0 {
+		return nil, errors.New("Invalid JWE initialization vector or ciphertext length")
+	}
+
+	// The tag is checked before decrypting, so that padding errors can't be used as an oracle
+	if subtle.ConstantTimeCompare(tag, cc.tag(cek, aad, iv, ciphertext)) != 1 {
+		return nil, errors.New("JWE decryption failed")
+	}
+
+	block, err := aes.NewCipher(cek[cc.KeyLen/2:])
+	if err != nil {
+		return nil, err
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, ciphertext)
+
+	pad := int(plaintext[len(plaintext)-1])
+	if pad < 1 || pad > aes.BlockSize {
+		return nil, errors.New("JWE decryption failed")
+	}
+	for _, b := range plaintext[len(plaintext)-pad:] {
+		if int(b) != pad {
+			return nil, errors.New("JWE decryption failed")
+		}
+	}
+
+	return plaintext[:len(plaintext)-pad], nil
+}
+
+// Computes the authentication tag as specified in https://tools.ietf.org/html/rfc7518#section-5.2.2.1
+func (cc *CBCHMACCrypter) tag(cek, aad, iv, ciphertext []byte) []byte {
+	al := make([]byte, 8)
+	binary.BigEndian.PutUint64(al, uint64(len(aad))*8)
+
+	mac := hmac.New(cc.H.New, cek[:cc.KeyLen/2])
+	mac.Write(aad)
+	mac.Write(iv)
+	mac.Write(ciphertext)
+	mac.Write(al)
+
+	return mac.Sum(nil)[:cc.KeyLen/2]
+}
+
+// Encrypts the content encryption key with a key management algorithm. The dir algorithm returns an empty encrypted
+// key, as the key is used directly as the content encryption key.
+func encryptKey(alg string, jwk *Jwk, cek []byte) ([]byte, error) {
+	if err := checkKeyManagementKey(alg, jwk); err != nil {
+		return nil, err
+	}
+
+	switch alg {
+	case JweAlgDir:
+		return nil, nil
+	case JweAlgRSA_OAEP, JweAlgRSA_OAEP_256:
+		if jwk.N == nil {
+			return nil, errors.New("Key is not an RSA public key")
+		}
+		return rsa.EncryptOAEP(oaepHash(alg).New(), rand.Reader, jwk.RsaPubKey(), cek, nil)
+	case JweAlgA128KW, JweAlgA192KW, JweAlgA256KW:
+		return aesKeyWrap(jwk.KeyValue, cek)
+	default:
+		return nil, fmt.Errorf("JWE ALG: %s is not a supported key management algorithm", alg)
+	}
+}
+
+// Decrypts the content encryption key with a key management algorithm. For dir, the key is the content encryption key.
+func decryptKey(alg string, jwk *Jwk, encryptedKey []byte) ([]byte, error) {
+	if err := checkKeyManagementKey(alg, jwk); err != nil {
+		return nil, err
+	}
+
+	switch alg {
+	case JweAlgDir:
+		if len(encryptedKey) > 0 {
+			return nil, errors.New("JWE encrypted key must be empty for direct encryption (dir)")
+		}
+		return jwk.KeyValue, nil
+	case JweAlgRSA_OAEP, JweAlgRSA_OAEP_256:
+		if jwk.N == nil || jwk.D == nil {
+			return nil, errors.New("Key is not an RSA private key")
+		}
+		priv := jwk.RsaPrivKey()
+		priv.Precompute()
+		cek, err := rsa.DecryptOAEP(oaepHash(alg).New(), nil, priv, encryptedKey, nil)
+		if err != nil {
+			return nil, errors.New("JWE decryption failed")
+		}
+		return cek, nil
+	case JweAlgA128KW, JweAlgA192KW, JweAlgA256KW:
+		return aesKeyUnwrap(jwk.KeyValue, encryptedKey)
+	default:
+		return nil, fmt.Errorf("JWE ALG: %s is not a supported key management algorithm", alg)
+	}
+}
+
+// Checks that the key's type and size match the key management algorithm
+func checkKeyManagementKey(alg string, jwk *Jwk) error {
+	if jwk == nil {
+		return errors.New("A key is required to encrypt or decrypt a JWE")
+	} else if kty := GetKeyType(alg); kty != "" && jwk.Type != kty {
+		return fmt.Errorf("Key type (kty=%s) doesn't match the JWE algorithm (%s)", jwk.Type, alg)
+	}
+
+	size := 0
+	switch alg {
+	case JweAlgA128KW:
+		size = 16
+	case JweAlgA192KW:
+		size = 24
+	case JweAlgA256KW:
+		size = 32
+	}
+	if size > 0 && len(jwk.KeyValue) != size {
+		return fmt.Errorf("%s requires a %d byte key", alg, size)
+	}
+
+	return nil
+}
+
+func oaepHash(alg string) crypto.Hash {
+	if alg == JweAlgRSA_OAEP_256 {
+		return crypto.SHA256
+	}
+	return crypto.SHA1
+}
+
+// Default initial value of the AES Key Wrap algorithm (https://tools.ietf.org/html/rfc3394#section-2.2.3.1)
+var aesKeyWrapIV = []byte{0xA6, 0xA6, 0xA6, 0xA6, 0xA6, 0xA6, 0xA6, 0xA6}
+
+// Wraps a key with the AES Key Wrap algorithm specified in https://tools.ietf.org/html/rfc3394#section-2.2.1
+func aesKeyWrap(kek, key []byte) ([]byte, error) {
+	if len(key) < 16 || len(key)%8 != 0 {
+		return nil, errors.New("AES Key Wrap requires a key of at least 16 bytes and a multiple of 8 bytes")
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+
+	n := len(key) / 8
+	r := make([]byte, len(key))
+	copy(r, key)
+	a := make([]byte, 8)
+	copy(a, aesKeyWrapIV)
+
+	b := make([]byte, 16)
+	for j := 0; j < 6; j++ {
+		for i := 0; i < n; i++ {
+			copy(b, a)
+			copy(b[8:], r[i*8:i*8+8])
+			block.Encrypt(b, b)
+
+			t := uint64(n*j + i + 1)
+			binary.BigEndian.PutUint64(a, binary.BigEndian.Uint64(b[:8])^t)
+			copy(r[i*8:], b[8:])
+		}
+	}
+
+	return append(a, r...), nil
+}
+
+// Unwraps a key with the AES Key Wrap algorithm specified in https://tools.ietf.org/html/rfc3394#section-2.2.2
+func aesKeyUnwrap(kek, wrapped []byte) ([]byte, error) {
+	if len(wrapped) < 24 || len(wrapped)%8 != 0 {
+		return nil, errors.New("Invalid AES wrapped key length")
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+
+	n := len(wrapped)/8 - 1
+	a := make([]byte, 8)
+	copy(a, wrapped[:8])
+	r := make([]byte, n*8)
+	copy(r, wrapped[8:])
+
+	b := make([]byte, 16)
+	for j := 5; j >= 0; j-- {
+		for i := n - 1; i >= 0; i-- {
+			t := uint64(n*j + i + 1)
+			binary.BigEndian.PutUint64(b, binary.BigEndian.Uint64(a)^t)
+			copy(b[8:], r[i*8:i*8+8])
+			block.Decrypt(b, b)
+
+			copy(a, b[:8])
+			copy(r[i*8:], b[8:])
+		}
+	}
+
+	if subtle.ConstantTimeCompare(a, aesKeyWrapIV) != 1 {
+		return nil, errors.New("JWE decryption failed")
+	}
+	return r, nil
+}
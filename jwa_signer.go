@@ -10,6 +10,8 @@ import (
 	_ "crypto/sha512"
 	"errors"
 	"fmt"
+	"hash"
+	"io"
 	"math/big"
 )
 
@@ -21,8 +23,22 @@ type JwaSigner interface {
 	SetVerifyKey(jwk *Jwk) error
 }
 
+// JwaHashSigner is implemented by JwaSigners that sign and verify a message written incrementally to a hash.Hash.
+// It allows large payloads to be signed and verified without holding the whole signing input in memory.
+type JwaHashSigner interface {
+	JwaSigner
+	// NewHash returns the hash.Hash the signing input must be written to
+	NewHash() hash.Hash
+	SignHash(h hash.Hash) ([]byte, error)
+	VerifyHash(h hash.Hash, sig []byte) error
+}
+
 type ESSigner struct {
-	H       crypto.Hash
+	H crypto.Hash
+	// Deterministic enables RFC 6979 deterministic nonces instead of reading the nonce from crypto/rand
+	Deterministic bool
+	// Hedge is an optional source of randomness mixed into deterministic nonces (only used if Deterministic is set)
+	Hedge   io.Reader
 	pubKey  *ecdsa.PublicKey
 	privKey *ecdsa.PrivateKey
 }
@@ -33,9 +49,13 @@ type HSSigner struct {
 }
 
 type PSSigner struct {
-	H       crypto.Hash
-	pubKey  *rsa.PublicKey
-	privKey *rsa.PrivateKey
+	H crypto.Hash
+	// SignOptions are used when signing. If nil, the salt length equals the hash length as mandated by RFC 7518
+	SignOptions *rsa.PSSOptions
+	// VerifyOptions are used when verifying. If nil, any salt length is accepted
+	VerifyOptions *rsa.PSSOptions
+	pubKey        *rsa.PublicKey
+	privKey       *rsa.PrivateKey
 }
 
 type RSSigner struct {
@@ -49,6 +69,44 @@ type ECPoint struct {
 	S *big.Int
 }
 
+// SignerOption configures a JwaSigner after it has been created for a JWS signature and before it is used
+type SignerOption func(signer JwaSigner) error
+
+// WithDeterministicSigning returns a SignerOption that makes ES256, ES384 and ES512 signatures use RFC 6979
+// deterministic nonces. If hedge is not nil, random bytes read from it are mixed into each nonce. The option
+// has no effect on other algorithms.
+func WithDeterministicSigning(hedge io.Reader) SignerOption {
+	return func(signer JwaSigner) error {
+		if es, ok := signer.(*ESSigner); ok {
+			es.Deterministic = true
+			es.Hedge = hedge
+		}
+		return nil
+	}
+}
+
+// WithPSSOptions returns a SignerOption that sets the rsa.PSSOptions used by PS256, PS384 and PS512 signers. A nil
+// value keeps the signer's default. The option has no effect on other algorithms.
+func WithPSSOptions(sign, verify *rsa.PSSOptions) SignerOption {
+	return func(signer JwaSigner) error {
+		if ps, ok := signer.(*PSSigner); ok {
+			if sign != nil {
+				ps.SignOptions = sign
+			}
+			if verify != nil {
+				ps.VerifyOptions = verify
+			}
+		}
+		return nil
+	}
+}
+
+// WithStrictPSSVerify returns a SignerOption that only accepts PS256, PS384 and PS512 signatures whose salt length
+// equals the hash length, as mandated by https://tools.ietf.org/html/rfc7518#section-3.5
+func WithStrictPSSVerify() SignerOption {
+	return WithPSSOptions(nil, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+}
+
 // Returnes a signer a particular JWS Algorithm. An error is returned for an invalid algorithm.
 func NewJwaSigner(jwsAlg string) (JwaSigner, error) {
 	switch jwsAlg {
@@ -84,76 +142,129 @@ func NewJwaSigner(jwsAlg string) (JwaSigner, error) {
 }
 
 func (es *ESSigner) Sign(msg []byte) ([]byte, error) {
+	h := es.NewHash()
+	h.Write(msg)
+	return es.SignHash(h)
+}
+
+func (hs *HSSigner) Sign(msg []byte) ([]byte, error) {
+	h := hs.NewHash()
+	h.Write(msg)
+	return hs.SignHash(h)
+}
 
+func (ps *PSSigner) Sign(msg []byte) ([]byte, error) {
+	h := ps.NewHash()
+	h.Write(msg)
+	return ps.SignHash(h)
+}
+
+func (rs *RSSigner) Sign(msg []byte) ([]byte, error) {
+	h := rs.NewHash()
+	h.Write(msg)
+	return rs.SignHash(h)
+}
+
+func (es *ESSigner) Verify(msg, sig []byte) error {
+	h := es.NewHash()
+	h.Write(msg)
+	return es.VerifyHash(h, sig)
+}
+
+func (hs *HSSigner) Verify(msg, sig []byte) error {
+	h := hs.NewHash()
+	h.Write(msg)
+	return hs.VerifyHash(h, sig)
+}
+
+func (ps *PSSigner) Verify(msg, sig []byte) error {
+	h := ps.NewHash()
+	h.Write(msg)
+	return ps.VerifyHash(h, sig)
+}
+
+func (rs *RSSigner) Verify(msg, sig []byte) error {
+	h := rs.NewHash()
+	h.Write(msg)
+	return rs.VerifyHash(h, sig)
+}
+
+func (es *ESSigner) NewHash() hash.Hash {
+	return es.H.New()
+}
+
+// Note: the signing (or verifying) key must be set before calling NewHash as it keys the HMAC
+func (hs *HSSigner) NewHash() hash.Hash {
+	return hmac.New(hs.H.New, hs.key)
+}
+
+func (ps *PSSigner) NewHash() hash.Hash {
+	return ps.H.New()
+}
+
+func (rs *RSSigner) NewHash() hash.Hash {
+	return rs.H.New()
+}
+
+func (es *ESSigner) SignHash(h hash.Hash) ([]byte, error) {
 	if (es.privKey) == nil {
 		return nil, errors.New("Signer's signing key was not set")
 	}
 
-	h := es.H.New()
-	h.Write(msg)
 	hashed := h.Sum(nil)
 
-	r, s, err := ecdsa.Sign(rand.Reader, es.privKey, hashed)
+	var r, s *big.Int
+	var err error
+	if es.Deterministic {
+		r, s, err = signRfc6979(es.privKey, es.H, hashed, es.Hedge)
+	} else {
+		r, s, err = ecdsa.Sign(rand.Reader, es.privKey, hashed)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	rB := r.Bytes()
-	sB := s.Bytes()
-
-	sig := make([]byte, len(rB)+len(sB))
-	copy(sig[:len(rB)], rB)
-	copy(sig[len(rB):], sB)
-
-	return sig, nil
+	// R and S are padded to the curve's byte size so every signature is exactly 2 * byte size long
+	return ecdsaSigBytes(r, s, ecdsaCurveByteSize(es.privKey.Curve))
 }
 
-func (hs *HSSigner) Sign(msg []byte) ([]byte, error) {
+func (hs *HSSigner) SignHash(h hash.Hash) ([]byte, error) {
 	if len(hs.key) < 1 {
 		return nil, errors.New("Signer's signing key was not set")
 	}
 
-	h := hmac.New(hs.H.New, hs.key)
-	h.Write(msg)
 	return h.Sum(nil), nil
 }
 
-func (ps *PSSigner) Sign(msg []byte) ([]byte, error) {
+func (ps *PSSigner) SignHash(h hash.Hash) ([]byte, error) {
 	if (ps.privKey) == nil {
 		return nil, errors.New("Signer's signing key was not set")
 	}
 
-	h := ps.H.New()
-	h.Write(msg)
-	hashed := h.Sum(nil)
+	opts := ps.SignOptions
+	if opts == nil {
+		opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}
+	}
 
-	return rsa.SignPSS(rand.Reader, ps.privKey, ps.H, hashed, &rsa.PSSOptions{
-		SaltLength: rsa.PSSSaltLengthAuto,
-	})
+	return rsa.SignPSS(rand.Reader, ps.privKey, ps.H, h.Sum(nil), opts)
 }
 
-func (rs *RSSigner) Sign(msg []byte) ([]byte, error) {
+func (rs *RSSigner) SignHash(h hash.Hash) ([]byte, error) {
 	if (rs.privKey) == nil {
 		return nil, errors.New("Signer's signing key was not set")
 	}
 
-	h := rs.H.New()
-	h.Write(msg)
-	hashed := h.Sum(nil)
-
-	return rsa.SignPKCS1v15(rand.Reader, rs.privKey, crypto.SHA256, hashed[:])
+	return rsa.SignPKCS1v15(rand.Reader, rs.privKey, rs.H, h.Sum(nil))
 }
 
-func (es *ESSigner) Verify(msg, sig []byte) error {
+func (es *ESSigner) VerifyHash(h hash.Hash, sig []byte) error {
 	if (es.pubKey) == nil {
 		return errors.New("Signer's verifying key was not set")
 	}
 
-	h := es.H.New()
-	h.Write(msg)
 	hashed := h.Sum(nil)
 
-	byteSize := int((es.pubKey.Curve.Params().BitSize) / 8)
+	byteSize := ecdsaCurveByteSize(es.pubKey.Curve)
 
 	if len(sig) != (2 * byteSize) {
 		return errors.New("Signature size incorrect. The signature must match the # of bits of the E-Curve")
@@ -171,12 +282,12 @@ func (es *ESSigner) Verify(msg, sig []byte) error {
 	return nil
 }
 
-func (hs *HSSigner) Verify(msg, sig []byte) error {
+func (hs *HSSigner) VerifyHash(h hash.Hash, sig []byte) error {
 	if len(hs.key) < 1 {
 		return errors.New("Signer's verifying key was not set")
 	}
 
-	expectedSig, _ := hs.Sign(msg)
+	expectedSig, _ := hs.SignHash(h)
 	if eq := hmac.Equal(sig, expectedSig); !eq {
 		return errors.New("HMAC Signatures do not match")
 	}
@@ -184,28 +295,20 @@ func (hs *HSSigner) Verify(msg, sig []byte) error {
 	return nil
 }
 
-func (ps *PSSigner) Verify(msg, sig []byte) error {
+func (ps *PSSigner) VerifyHash(h hash.Hash, sig []byte) error {
 	if (ps.pubKey) == nil {
 		return errors.New("Signer's verifying key was not set")
 	}
 
-	h := ps.H.New()
-	h.Write(msg)
-	hashed := h.Sum(nil)
-
-	return rsa.VerifyPSS(ps.pubKey, ps.H, hashed, sig, nil)
+	return rsa.VerifyPSS(ps.pubKey, ps.H, h.Sum(nil), sig, ps.VerifyOptions)
 }
 
-func (rs *RSSigner) Verify(msg, sig []byte) error {
+func (rs *RSSigner) VerifyHash(h hash.Hash, sig []byte) error {
 	if (rs.pubKey) == nil {
 		return errors.New("Signer's verifying key was not set")
 	}
 
-	h := rs.H.New()
-	h.Write(msg)
-	hashed := h.Sum(nil)
-
-	return rsa.VerifyPKCS1v15(rs.pubKey, rs.H, hashed, sig)
+	return rsa.VerifyPKCS1v15(rs.pubKey, rs.H, h.Sum(nil), sig)
 }
 
 func (es *ESSigner) SetSignKey(jwk *Jwk) error {
@@ -0,0 +1,216 @@
+package gose
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	ec "crypto/elliptic"
+	"crypto/hmac"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// EcdsaSigToDER converts a JOSE ECDSA signature (the fixed width R || S octet sequence used by ES256, ES384 and
+// ES512, see https://tools.ietf.org/html/rfc7518#section-3.4) into an ASN.1 DER encoded ECDSA-Sig-Value as used
+// by X.509 tooling and most KMS APIs.
+func EcdsaSigToDER(jwsAlg string, sig []byte) ([]byte, error) {
+	byteSize, err := ecdsaAlgByteSize(jwsAlg)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sig) != 2*byteSize {
+		return nil, fmt.Errorf("Signature size incorrect. A %s signature must be exactly %d bytes", jwsAlg, 2*byteSize)
+	}
+
+	return asn1.Marshal(ECPoint{
+		R: new(big.Int).SetBytes(sig[:byteSize]),
+		S: new(big.Int).SetBytes(sig[byteSize:]),
+	})
+}
+
+// EcdsaSigFromDER converts an ASN.1 DER encoded ECDSA-Sig-Value into the JOSE R || S octet sequence for the passed
+// JWS algorithm. R and S are left padded with zeros to the byte size of the algorithm's curve.
+func EcdsaSigFromDER(jwsAlg string, der []byte) ([]byte, error) {
+	byteSize, err := ecdsaAlgByteSize(jwsAlg)
+	if err != nil {
+		return nil, err
+	}
+
+	var p ECPoint
+	rest, err := asn1.Unmarshal(der, &p)
+	if err != nil {
+		return nil, err
+	} else if len(rest) > 0 {
+		return nil, errors.New("Trailing data found after the DER encoded ECDSA signature")
+	}
+
+	if p.R == nil || p.S == nil || p.R.Sign() <= 0 || p.S.Sign() <= 0 {
+		return nil, errors.New("DER encoded ECDSA signature values (R, S) must be positive integers")
+	}
+
+	return ecdsaSigBytes(p.R, p.S, byteSize)
+}
+
+// Returns the number of bytes needed to represent a scalar of the passed curve
+func ecdsaCurveByteSize(curve ec.Curve) int {
+	return (curve.Params().BitSize + 7) / 8
+}
+
+// Returns the byte size of R and S for an ECDSA JWS algorithm
+func ecdsaAlgByteSize(jwsAlg string) (int, error) {
+	switch jwsAlg {
+	case JwsAlgES256:
+		return ecdsaCurveByteSize(ec.P256()), nil
+	case JwsAlgES384:
+		return ecdsaCurveByteSize(ec.P384()), nil
+	case JwsAlgES512:
+		return ecdsaCurveByteSize(ec.P521()), nil
+	default:
+		return 0, fmt.Errorf("JWS ALG: %s is not an ECDSA JWS alg.", jwsAlg)
+	}
+}
+
+// Encodes R and S as the fixed width R || S octet sequence, each value being left padded to byteSize
+func ecdsaSigBytes(r, s *big.Int, byteSize int) ([]byte, error) {
+	if r.BitLen() > 8*byteSize || s.BitLen() > 8*byteSize {
+		return nil, errors.New("ECDSA signature values (R, S) are larger than the curve's byte size")
+	}
+
+	sig := make([]byte, 2*byteSize)
+	r.FillBytes(sig[:byteSize])
+	s.FillBytes(sig[byteSize:])
+
+	return sig, nil
+}
+
+// Signs the hashed message with a nonce derived as specified in https://tools.ietf.org/html/rfc6979#section-3.2.
+// If hedge is not nil, random bytes read from it are passed to the nonce derivation as the additional data (k')
+// described in https://tools.ietf.org/html/rfc6979#section-3.6.
+// Note: the arithmetic is performed with math/big and is therefore not constant time.
+func signRfc6979(priv *ecdsa.PrivateKey, h crypto.Hash, hashed []byte, hedge io.Reader) (r, s *big.Int, err error) {
+	if priv.D == nil || priv.Curve == nil {
+		return nil, nil, errors.New("Signer's signing key is not a valid ECDSA private key")
+	}
+
+	params := priv.Curve.Params()
+	n := params.N
+	byteSize := ecdsaCurveByteSize(priv.Curve)
+
+	var extra []byte
+	if hedge != nil {
+		extra = make([]byte, h.Size())
+		if _, err := io.ReadFull(hedge, extra); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	e := rfc6979Bits2Int(hashed, n)
+	nonces := newRfc6979Nonces(h, priv.D, hashed, n, extra)
+
+	for {
+		k := nonces.next()
+
+		x, _ := priv.Curve.ScalarBaseMult(k.FillBytes(make([]byte, byteSize)))
+		r = new(big.Int).Mod(x, n)
+		if r.Sign() == 0 {
+			continue
+		}
+
+		// s = k^-1 * (e + r * d) mod n
+		s = new(big.Int).Mul(r, priv.D)
+		s.Add(s, e)
+		s.Mul(s, new(big.Int).ModInverse(k, n))
+		s.Mod(s, n)
+		if s.Sign() == 0 {
+			continue
+		}
+
+		return r, s, nil
+	}
+}
+
+// The HMAC_DRBG state used to generate RFC 6979 nonces
+type rfc6979Nonces struct {
+	h crypto.Hash
+	n *big.Int
+	k []byte
+	v []byte
+}
+
+// Initializes the nonce generator as described in https://tools.ietf.org/html/rfc6979#section-3.2 steps b. to g.
+func newRfc6979Nonces(h crypto.Hash, x *big.Int, hashed []byte, n *big.Int, extra []byte) *rfc6979Nonces {
+	rlen := (n.BitLen() + 7) / 8
+
+	// bits2octets(h1): convert the hash to an integer, reduce it modulo n and encode it as rlen octets
+	z := rfc6979Bits2Int(hashed, n)
+	if z.Cmp(n) >= 0 {
+		z.Sub(z, n)
+	}
+
+	seed := make([]byte, 0, 2*rlen+len(extra))
+	seed = append(seed, x.FillBytes(make([]byte, rlen))...)
+	seed = append(seed, z.FillBytes(make([]byte, rlen))...)
+	seed = append(seed, extra...)
+
+	g := &rfc6979Nonces{
+		h: h,
+		n: n,
+		k: make([]byte, h.Size()),
+		v: make([]byte, h.Size()),
+	}
+	for i := range g.v {
+		g.v[i] = 0x01
+	}
+
+	g.k = g.mac(g.v, []byte{0x00}, seed)
+	g.v = g.mac(g.v)
+	g.k = g.mac(g.v, []byte{0x01}, seed)
+	g.v = g.mac(g.v)
+
+	return g
+}
+
+// Returns the next nonce candidate in the range [1, n-1] as described in
+// https://tools.ietf.org/html/rfc6979#section-3.2 step h.
+func (g *rfc6979Nonces) next() *big.Int {
+	qlen := g.n.BitLen()
+	for {
+		t := make([]byte, 0, (qlen+7)/8)
+		for len(t)*8 < qlen {
+			g.v = g.mac(g.v)
+			t = append(t, g.v...)
+		}
+
+		k := rfc6979Bits2Int(t, g.n)
+
+		// Update the state so a subsequent call (e.g. if r or s was zero) produces a new candidate
+		g.k = g.mac(g.v, []byte{0x00})
+		g.v = g.mac(g.v)
+
+		if k.Sign() > 0 && k.Cmp(g.n) < 0 {
+			return k
+		}
+	}
+}
+
+// Computes HMAC_K(data[0] || data[1] || ...)
+func (g *rfc6979Nonces) mac(data ...[]byte) []byte {
+	m := hmac.New(g.h.New, g.k)
+	for _, d := range data {
+		m.Write(d)
+	}
+	return m.Sum(nil)
+}
+
+// Implements bits2int from https://tools.ietf.org/html/rfc6979#section-2.3.2. The leftmost qlen bits of b are
+// converted to an integer.
+func rfc6979Bits2Int(b []byte, n *big.Int) *big.Int {
+	i := new(big.Int).SetBytes(b)
+	if excess := len(b)*8 - n.BitLen(); excess > 0 {
+		i.Rsh(i, uint(excess))
+	}
+	return i
+}
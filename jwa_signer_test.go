@@ -1,9 +1,15 @@
 package gose
 
 import (
-	//"bytes"
+	"bytes"
 	"crypto"
+	"crypto/ecdsa"
+	ec "crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
 	"encoding/json"
+	"math/big"
 	//"fmt"
 	"testing"
 )
@@ -132,3 +138,227 @@ func TestJwaSignerVerify(t *testing.T) {
 
 	}
 }
+
+var ecdsaDERTestVectors = []struct {
+	alg  string
+	sig  []byte
+	size int
+}{
+	// ES256 signature from https://tools.ietf.org/html/rfc7515#appendix-A.3
+	{JwsAlgES256, jwaSignerTestVectors[1].signature, 64},
+	// R and S with leading zero bytes must be padded back to the curve's byte size
+	{JwsAlgES256, append(append(make([]byte, 31), 1), append(make([]byte, 30), 2, 3)...), 64},
+	{JwsAlgES512, append(append(make([]byte, 65), 7), append([]byte{1}, make([]byte, 65)...)...), 132},
+}
+
+// Convert JOSE signatures to DER and back again
+func TestEcdsaSigDER(t *testing.T) {
+	for i, v := range ecdsaDERTestVectors {
+		der, err := EcdsaSigToDER(v.alg, v.sig)
+		if err != nil {
+			t.Errorf("Unable to convert signature %d to DER. Err: %v\n", i+1, err)
+		}
+
+		sig, err := EcdsaSigFromDER(v.alg, der)
+		if err != nil {
+			t.Errorf("Unable to convert signature %d from DER. Err: %v\n", i+1, err)
+		}
+
+		if len(sig) != v.size {
+			t.Errorf("Signature %d has the wrong size. Expected: %d Got: %d\n", i+1, v.size, len(sig))
+		}
+		if !bytes.Equal(sig, v.sig) {
+			t.Errorf("Signature %d. \nExpected:\n%v \nGot:\n%v\n", i+1, v.sig, sig)
+		}
+	}
+
+	if _, err := EcdsaSigToDER(JwsAlgES384, jwaSignerTestVectors[1].signature); err == nil {
+		t.Errorf("Expected an error converting an ES256 sized signature as ES384\n")
+	}
+}
+
+// A DER signature created from a JOSE signature must verify with crypto/ecdsa
+func TestEcdsaSigDERVerify(t *testing.T) {
+	v := jwaSignerTestVectors[1]
+	jwk := new(Jwk)
+	if err := json.Unmarshal(v.verifyKeyJson, &jwk); err != nil {
+		t.Fatalf("Unable to unmarshal verifying key. Err: %v\n", err)
+	}
+
+	der, err := EcdsaSigToDER(JwsAlgES256, v.signature)
+	if err != nil {
+		t.Fatalf("Unable to convert signature to DER. Err: %v\n", err)
+	}
+
+	h := crypto.SHA256.New()
+	h.Write(v.payload)
+	if !ecdsa.VerifyASN1(jwk.EcdsaPubKey(), h.Sum(nil), der) {
+		t.Errorf("DER signature failed verification\n")
+	}
+}
+
+// From https://tools.ietf.org/html/rfc6979#appendix-A.2.5, A.2.6 and A.2.7
+var rfc6979TestVectors = []struct {
+	curve ec.Curve
+	h     crypto.Hash
+	x     string
+	msg   string
+	r     string
+	s     string
+}{
+	{
+		ec.P256(), crypto.SHA256,
+		"C9AFA9D845BA75166B5C215767B1D6934E50C3DB36E89B127B8A622B120F6721",
+		"sample",
+		"EFD48B2AACB6A8FD1140DD9CD45E81D69D2C877B56AAF991C34D0EA84EAF3716",
+		"F7CB1C942D657C41D436C7A1B6E29F65F3E900DBB9AFF4064DC4AB2F843ACDA8",
+	},
+	{
+		ec.P256(), crypto.SHA256,
+		"C9AFA9D845BA75166B5C215767B1D6934E50C3DB36E89B127B8A622B120F6721",
+		"test",
+		"F1ABB023518351CD71D881567B1EA663ED3EFCF6C5132B354F28D3B0B7D38367",
+		"019F4113742A2B14BD25926B49C649155F267E60D3814B4C0CC84250E46F0083",
+	},
+	{
+		ec.P384(), crypto.SHA384,
+		"6B9D3DAD2E1B8C1C05B19875B6659F4DE23C3B667BF297BA9AA47740787137D896D5724E4C70A825F872C9EA60D2EDF5",
+		"sample",
+		"94EDBB92A5ECB8AAD4736E56C691916B3F88140666CE9FA73D64C4EA95AD133C81A648152E44ACF96E36DD1E80FABE46",
+		"99EF4AEB15F178CEA1FE40DB2603138F130E740A19624526203B6351D0A3A94FA329C145786E679E7B82C71A38628AC8",
+	},
+	{
+		ec.P521(), crypto.SHA512,
+		"00FAD06DAA62BA3B25D2FB40133DA757205DE67F5BB0018FEE8C86E1B68C7E75CAA896EB32F1F47C70855836A6D16FCC1466F6D8FBEC67DB89EC0C08B0E996B83538",
+		"sample",
+		"00C328FAFCBD79DD77850370C46325D987CB525569FB63C5D3BC53950E6D4C5F174E25A1EE9017B5D450606ADD152B534931D7D4E8455CC91F9B15BF05EC36E377FA",
+		"00617CCE7CF5064806C467F678D3B4080D6F1CC50AF26CA209417308281B68AF282623EAA63E5B5C0723D8B8C37FF0777B1A20F8CCB1DCCC43997F1EE0E44DA4A67A",
+	},
+}
+
+// Returns an EC Jwk for the hex encoded private scalar x
+func rfc6979TestKey(curve ec.Curve, x string) *Jwk {
+	d, _ := new(big.Int).SetString(x, 16)
+	pubX, pubY := curve.ScalarBaseMult(d.FillBytes(make([]byte, (curve.Params().BitSize+7)/8)))
+	return &Jwk{Type: KeyTypeEC, Curve: curve, X: pubX, Y: pubY, D: d}
+}
+
+func TestESSignerDeterministic(t *testing.T) {
+	for i, v := range rfc6979TestVectors {
+		jwk := rfc6979TestKey(v.curve, v.x)
+		signer := &ESSigner{H: v.h, Deterministic: true}
+		signer.SetSignKey(jwk)
+		signer.SetVerifyKey(jwk)
+
+		sig, err := signer.Sign([]byte(v.msg))
+		if err != nil {
+			t.Errorf("Unable to sign test vector %d. Err: %v\n", i+1, err)
+			continue
+		}
+
+		expected, _ := hex.DecodeString(v.r + v.s)
+		if !bytes.Equal(sig, expected) {
+			t.Errorf("Test vector %d. \nExpected:\n%X \nGot:\n%X\n", i+1, expected, sig)
+		}
+
+		if err := signer.Verify([]byte(v.msg), sig); err != nil {
+			t.Errorf("Unable to verify test vector %d. Err: %v\n", i+1, err)
+		}
+	}
+}
+
+func TestESSignerHedged(t *testing.T) {
+	v := rfc6979TestVectors[0]
+	jwk := rfc6979TestKey(v.curve, v.x)
+	signer := &ESSigner{H: v.h, Deterministic: true, Hedge: rand.Reader}
+	signer.SetSignKey(jwk)
+	signer.SetVerifyKey(jwk)
+
+	sig1, err := signer.Sign([]byte(v.msg))
+	if err != nil {
+		t.Fatalf("Unable to sign. Err: %v\n", err)
+	}
+	sig2, err := signer.Sign([]byte(v.msg))
+	if err != nil {
+		t.Fatalf("Unable to sign. Err: %v\n", err)
+	}
+
+	if bytes.Equal(sig1, sig2) {
+		t.Errorf("Hedged signatures must not be identical\n")
+	}
+	if err := signer.Verify([]byte(v.msg), sig1); err != nil {
+		t.Errorf("Unable to verify hedged signature. Err: %v\n", err)
+	}
+}
+
+// Signing a JWS with the deterministic option must produce byte stable tokens
+func TestJwsSignDeterministic(t *testing.T) {
+	v := rfc6979TestVectors[0]
+	jwk := rfc6979TestKey(v.curve, v.x)
+
+	var tokens [][]byte
+	for i := 0; i < 2; i++ {
+		jws := &Jws{
+			Payload:    []byte(`{"iss":"joe"}`),
+			Signatures: []*JwsSignature{&JwsSignature{ProtectedHeader: &JwHeader{Algorithm: JwsAlgES256}}},
+		}
+		if err := jws.Sign(jwk, WithDeterministicSigning(nil)); err != nil {
+			t.Fatalf("Unable to sign jws. Err: %v\n", err)
+		}
+		token, err := jws.MarshalCompact()
+		if err != nil {
+			t.Fatalf("Unable to marshal jws. Err: %v\n", err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	if !bytes.Equal(tokens[0], tokens[1]) {
+		t.Errorf("Deterministic tokens differ. \nFirst:\n%s \nSecond:\n%s\n", tokens[0], tokens[1])
+	}
+}
+
+var pssSaltTestVectors = []struct {
+	signOpts   *rsa.PSSOptions
+	verifyOpts []SignerOption
+	valid      bool
+}{
+	// Default signing uses salt length == hash length, which passes strict verification
+	{nil, []SignerOption{WithStrictPSSVerify()}, true},
+	{nil, nil, true},
+	// A salt length different from the hash length is only accepted by lenient verification
+	{&rsa.PSSOptions{SaltLength: 10}, nil, true},
+	{&rsa.PSSOptions{SaltLength: 10}, []SignerOption{WithStrictPSSVerify()}, false},
+	{&rsa.PSSOptions{SaltLength: 10}, []SignerOption{WithPSSOptions(nil, &rsa.PSSOptions{SaltLength: 10})}, true},
+}
+
+func TestPSSignerSaltLength(t *testing.T) {
+	// Re-use the RSA key from https://tools.ietf.org/html/rfc7515#appendix-A.2
+	jwk := new(Jwk)
+	if err := json.Unmarshal(jwaSignerTestVectors[2].signKeyJson, &jwk); err != nil {
+		t.Fatalf("Unable to unmarshal signing key. Err: %v\n", err)
+	}
+	msg := jwaSignerTestVectors[2].payload
+
+	for i, v := range pssSaltTestVectors {
+		signer := &PSSigner{H: crypto.SHA256, SignOptions: v.signOpts}
+		signer.SetSignKey(jwk)
+		sig, err := signer.Sign(msg)
+		if err != nil {
+			t.Errorf("Unable to sign test vector %d. Err: %v\n", i+1, err)
+			continue
+		}
+
+		verifier := &PSSigner{H: crypto.SHA256}
+		verifier.SetVerifyKey(jwk)
+		for _, opt := range v.verifyOpts {
+			opt(verifier)
+		}
+
+		err = verifier.Verify(msg, sig)
+		if v.valid && err != nil {
+			t.Errorf("Unable to verify test vector %d. Err: %v\n", i+1, err)
+		} else if !v.valid && err == nil {
+			t.Errorf("Test vector %d verified but was expected to fail\n", i+1)
+		}
+	}
+}
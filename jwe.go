@@ -1,5 +1,24 @@
 package gose
 
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// JweZipDeflate is the DEFLATE compression algorithm (zip) as specified in
+// https://tools.ietf.org/html/rfc7516#section-4.1.3
+const JweZipDeflate string = "DEF"
+
+// Maximum size of a decompressed JWE plaintext
+const jweMaxInflatedSize = 16 << 20
+
+// Jwe represents a JSON Web Encryption (JWE) object as specified in https://tools.ietf.org/html/rfc7516. The
+// key management (alg) and content encryption (enc) algorithms are taken from the protected header.
 type Jwe struct {
 	ProtectedHeader       *JwHeader
 	UnprotectedHeader     *JwHeader
@@ -23,22 +42,176 @@ type JweRecipient struct {
 	b64URLEncKeyCache []byte
 }
 
-func (jwe *Jwe) Encrypt(jwk *Jwk) {
+// Encrypt encrypts the Message for a single recipient with jwk. A random content encryption key is generated, unless
+// the key management algorithm is direct encryption (dir). If the protected header's zip is "DEF", the Message is
+// compressed before it is encrypted.
+func (jwe *Jwe) Encrypt(jwk *Jwk) error {
+	if jwe.ProtectedHeader == nil {
+		return errors.New("The JWE must have a protected header")
+	}
+	alg := jwe.ProtectedHeader.Algorithm
+	crypter, err := NewJwaCrypter(jwe.ProtectedHeader.EncryptionAlg)
+	if err != nil {
+		return err
+	}
+
+	if alg == JweAlgDir {
+		if jwk == nil || len(jwk.KeyValue) != crypter.KeySize() {
+			return fmt.Errorf("Direct encryption with %s requires a %d byte key", jwe.ProtectedHeader.EncryptionAlg,
+				crypter.KeySize())
+		}
+		jwe.contentEncryptionKey = jwk.KeyValue
+	} else {
+		jwe.contentEncryptionKey = make([]byte, crypter.KeySize())
+		if _, err := rand.Read(jwe.contentEncryptionKey); err != nil {
+			return err
+		}
+	}
+
+	jRecip := new(JweRecipient)
+	if err := jRecip.Encrypt(jwe, jwk); err != nil {
+		return err
+	}
 
+	plaintext, err := jwe.compress(jwe.Message)
+	if err != nil {
+		return err
+	}
+
+	protHdrJson, err := jwe.ProtectedHeader.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	jwe.b64URLProtHdrCache = []byte(base64.URLEncoding.WithPadding(base64.NoPadding).EncodeToString(protHdrJson))
+
+	iv, cipherText, tag, err := crypter.Encrypt(jwe.contentEncryptionKey, plaintext, jwe.aad())
+	if err != nil {
+		return err
+	}
+
+	jwe.Recipients = []*JweRecipient{jRecip}
+	jwe.InitializationVector = iv
+	jwe.cipherText = cipherText
+	jwe.Tag = tag
+
+	return nil
 }
 
-func (jwe *Jwe) Decrypt(jwk *Jwk) {
+// Decrypt decrypts a JWE that has a single recipient with jwk and sets its Message. JWEs with critical header
+// parameters (crit) are rejected, as none are supported.
+func (jwe *Jwe) Decrypt(jwk *Jwk) error {
+	if len(jwe.Recipients) > 1 {
+		return errors.New("More than one recipient found.")
+	} else if len(jwe.Recipients) < 1 {
+		return errors.New("The JWE must have at least one recipient")
+	}
+	if jwe.ProtectedHeader == nil {
+		return errors.New("The JWE must have a protected header")
+	} else if len(jwe.ProtectedHeader.Critical) > 0 {
+		return fmt.Errorf("Critical header parameters (%v) are not supported", jwe.ProtectedHeader.Critical)
+	}
+
+	crypter, err := NewJwaCrypter(jwe.ProtectedHeader.EncryptionAlg)
+	if err != nil {
+		return err
+	}
+	if err := jwe.Recipients[0].Decrypt(jwe, jwk); err != nil {
+		return err
+	}
 
+	plaintext, err := crypter.Decrypt(jwe.contentEncryptionKey, jwe.InitializationVector, jwe.cipherText, jwe.Tag,
+		jwe.aad())
+	if err != nil {
+		return err
+	}
+
+	message, err := jwe.decompress(plaintext)
+	if err != nil {
+		return err
+	}
+	jwe.Message = message
+
+	return nil
 }
 
-func (jwe *Jwe) EncryptMultiple(jwks *JwkSet) {
+// EncryptMultiple is not supported, as only the compact serialization (with a single recipient) is implemented
+func (jwe *Jwe) EncryptMultiple(jwks *JwkSet) error {
+	return errors.New("Encrypting a JWE for multiple recipients is not supported")
+}
+
+// Encrypt encrypts the JWE's content encryption key for the recipient with the key management algorithm (alg) of the
+// JWE's protected header
+func (jRecip *JweRecipient) Encrypt(jwe *Jwe, jwk *Jwk) error {
+	encryptedKey, err := encryptKey(jwe.ProtectedHeader.Algorithm, jwk, jwe.contentEncryptionKey)
+	if err != nil {
+		return err
+	}
+
+	jRecip.encryptedKey = encryptedKey
+	jRecip.b64URLEncKeyCache = []byte(base64.URLEncoding.WithPadding(base64.NoPadding).EncodeToString(encryptedKey))
 
+	return nil
 }
 
-func (jRecip *JweRecipient) Encrypt(jwe *Jwe, jwk *Jwk) {
+// Decrypt decrypts the recipient's encrypted key and sets it as the JWE's content encryption key
+func (jRecip *JweRecipient) Decrypt(jwe *Jwe, jwk *Jwk) error {
+	cek, err := decryptKey(jwe.ProtectedHeader.Algorithm, jwk, jRecip.encryptedKey)
+	if err != nil {
+		return err
+	}
 
+	jwe.contentEncryptionKey = cek
+
+	return nil
+}
+
+// Returns the additional authenticated data as specified in https://tools.ietf.org/html/rfc7516#section-5.1
+func (jwe *Jwe) aad() []byte {
+	aad := append([]byte{}, jwe.b64URLProtHdrCache...)
+	if len(jwe.AdditionalAuthData) > 0 {
+		aad = append(aad, '.')
+		aad = append(aad, base64.URLEncoding.WithPadding(base64.NoPadding).EncodeToString(jwe.AdditionalAuthData)...)
+	}
+	return aad
 }
 
-func (jRecip *JweRecipient) Decrypt(jwe *Jwe, jwk *Jwk) {
+func (jwe *Jwe) compress(data []byte) ([]byte, error) {
+	switch jwe.ProtectedHeader.Compression {
+	case "":
+		return data, nil
+	case JweZipDeflate:
+		var buf bytes.Buffer
+		w, err := flate.NewWriter(&buf, flate.DefaultCompression)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("JWE compression algorithm (zip=%s) is not supported", jwe.ProtectedHeader.Compression)
+	}
+}
 
+func (jwe *Jwe) decompress(data []byte) ([]byte, error) {
+	switch jwe.ProtectedHeader.Compression {
+	case "":
+		return data, nil
+	case JweZipDeflate:
+		r := flate.NewReader(bytes.NewReader(data))
+		defer r.Close()
+		out, err := io.ReadAll(io.LimitReader(r, jweMaxInflatedSize+1))
+		if err != nil {
+			return nil, err
+		} else if len(out) > jweMaxInflatedSize {
+			return nil, fmt.Errorf("Decompressed JWE plaintext exceeds %d bytes", jweMaxInflatedSize)
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("JWE compression algorithm (zip=%s) is not supported", jwe.ProtectedHeader.Compression)
+	}
 }
@@ -0,0 +1,74 @@
+package gose
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// UnmarshalCompact parses a compact serialized JWE as specified in https://tools.ietf.org/html/rfc7516#section-7.1
+func (jwe *Jwe) UnmarshalCompact(data []byte) error {
+	// Convert byte array to string and trim starting/ending whitespace
+	jStr := strings.TrimSpace(string(data))
+
+	// Split the string by the dots ".". A compact JWE has exactly 5 elements
+	jSplit := strings.Split(jStr, ".")
+	if len(jSplit) != 5 {
+		return errors.New("Invalid Compact JWE. The number of jwe segments must be exactly 5")
+	}
+
+	segments := make([][]byte, len(jSplit))
+	for i, s := range jSplit {
+		b, err := base64.URLEncoding.WithPadding(base64.NoPadding).DecodeString(s)
+		if err != nil {
+			return err
+		}
+		segments[i] = b
+	}
+
+	// Parse Protected Header
+	pHdr := new(JwHeader)
+	if err := pHdr.UnmarshalJSON(segments[0]); err != nil {
+		return err
+	}
+
+	jRecip := new(JweRecipient)
+	jRecip.encryptedKey = segments[1]
+	jRecip.b64URLEncKeyCache = []byte(jSplit[1])
+
+	// Set fields for JWE object
+	jwe.ProtectedHeader = pHdr
+	jwe.UnprotectedHeader = nil
+	jwe.Recipients = []*JweRecipient{jRecip}
+	jwe.InitializationVector = segments[2]
+	jwe.cipherText = segments[3]
+	jwe.Tag = segments[4]
+	jwe.AdditionalAuthData = nil
+	jwe.b64URLProtHdrCache = []byte(jSplit[0])
+	jwe.b64URLIVCache = []byte(jSplit[2])
+	jwe.b64URLCipherTextCache = []byte(jSplit[3])
+
+	return nil
+}
+
+// MarshalCompact returns the compact serialization of an encrypted JWE. Unprotected headers and additional
+// authenticated data can't be represented in the compact serialization.
+func (jwe *Jwe) MarshalCompact() ([]byte, error) {
+	if len(jwe.Recipients) > 1 {
+		return nil, errors.New("Only one recipient is supported with JWE Compact serialization")
+	} else if len(jwe.Recipients) < 1 || len(jwe.b64URLProtHdrCache) == 0 {
+		return nil, errors.New("The JWE must be encrypted before it is serialized")
+	} else if jwe.UnprotectedHeader != nil || jwe.Recipients[0].Header != nil || len(jwe.AdditionalAuthData) > 0 {
+		return nil, errors.New("Unprotected headers and additional authenticated data are not supported with JWE Compact serialization")
+	}
+
+	enc := base64.URLEncoding.WithPadding(base64.NoPadding)
+	return bytes.Join([][]byte{
+		jwe.b64URLProtHdrCache,
+		[]byte(enc.EncodeToString(jwe.Recipients[0].encryptedKey)),
+		[]byte(enc.EncodeToString(jwe.InitializationVector)),
+		[]byte(enc.EncodeToString(jwe.cipherText)),
+		[]byte(enc.EncodeToString(jwe.Tag)),
+	}, []byte(".")), nil
+}
@@ -0,0 +1,195 @@
+package gose
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestAesKeyWrap(t *testing.T) {
+	// https://tools.ietf.org/html/rfc3394#section-4.1
+	kek, _ := hex.DecodeString("000102030405060708090A0B0C0D0E0F")
+	key, _ := hex.DecodeString("00112233445566778899AABBCCDDEEFF")
+	expected, _ := hex.DecodeString("1FA68B0A8112B447AEF34BD8FB5A7B829D3E862371D2CFE5")
+
+	wrapped, err := aesKeyWrap(kek, key)
+	if err != nil || !bytes.Equal(wrapped, expected) {
+		t.Fatalf("Expected wrapped key %x, got %x. Err: %v\n", expected, wrapped, err)
+	}
+	unwrapped, err := aesKeyUnwrap(kek, wrapped)
+	if err != nil || !bytes.Equal(unwrapped, key) {
+		t.Errorf("Expected unwrapped key %x, got %x. Err: %v\n", key, unwrapped, err)
+	}
+
+	wrapped[3] ^= 1
+	if _, err := aesKeyUnwrap(kek, wrapped); err == nil {
+		t.Errorf("Tampered wrapped key was unwrapped\n")
+	}
+}
+
+func TestJweDecryptCompact(t *testing.T) {
+	// https://tools.ietf.org/html/rfc7516#appendix-A.3
+	key := new(Jwk)
+	if err := json.Unmarshal([]byte(`{"kty":"oct","k":"GawgguFyGrWKav7AX4VKUg"}`), key); err != nil {
+		t.Fatalf("Unable to unmarshal key. Err: %v\n", err)
+	}
+	compact := "eyJhbGciOiJBMTI4S1ciLCJlbmMiOiJBMTI4Q0JDLUhTMjU2In0." +
+		"6KB707dM9YTIgHtLvtgWQ8mKwboJW3of9locizkDTHzBC2IlrT1oOQ." +
+		"AxY8DCtDaGlsbGljb3RoZQ." +
+		"KDlTtXchhZTGufMYmOYGS4HffxPSUrfmqCHXaI9wOGY." +
+		"U0m_YmjN04DJvceFICbCVQ"
+
+	jwe := new(Jwe)
+	if err := jwe.UnmarshalCompact([]byte(compact)); err != nil {
+		t.Fatalf("Unable to unmarshal JWE. Err: %v\n", err)
+	}
+	if err := jwe.Decrypt(key); err != nil {
+		t.Fatalf("Unable to decrypt JWE. Err: %v\n", err)
+	}
+	if string(jwe.Message) != "Live long and prosper." {
+		t.Errorf("Unexpected plaintext: %s\n", jwe.Message)
+	}
+
+	out, err := jwe.MarshalCompact()
+	if err != nil || string(out) != compact {
+		t.Errorf("JWE doesn't round trip: %s. Err: %v\n", out, err)
+	}
+
+	// Tampered ciphertext
+	tampered := strings.Replace(compact, ".KDlT", ".KDlU", 1)
+	if err := jwe.UnmarshalCompact([]byte(tampered)); err != nil {
+		t.Fatalf("Unable to unmarshal JWE. Err: %v\n", err)
+	}
+	if err := jwe.Decrypt(key); err == nil {
+		t.Errorf("Tampered JWE was decrypted\n")
+	}
+}
+
+func TestJweEncryptDecrypt(t *testing.T) {
+	rsaKey := new(Jwk)
+	if err := json.Unmarshal(jwaSignerTestVectors[2].signKeyJson, rsaKey); err != nil {
+		t.Fatalf("Unable to unmarshal key. Err: %v\n", err)
+	}
+	rsaKey.Algorithm = ""
+
+	octKey := func(size int) *Jwk {
+		k := new(Jwk)
+		if err := k.ImportKey(bytes.Repeat([]byte{0x42}, size)); err != nil {
+			t.Fatalf("Unable to import key. Err: %v\n", err)
+		}
+		return k
+	}
+
+	vectors := []struct {
+		alg string
+		enc string
+		zip string
+		key *Jwk
+	}{
+		{JweAlgRSA_OAEP, JweEncAlgA128GCM, "", rsaKey},
+		{JweAlgRSA_OAEP_256, JweEncAlgA256GCM, JweZipDeflate, rsaKey},
+		{JweAlgRSA_OAEP_256, JweEncAlgA256CBC_HS512, "", rsaKey},
+		{JweAlgA128KW, JweEncAlgA128CBC_HS256, "", octKey(16)},
+		{JweAlgA192KW, JweEncAlgA192CBC_HS384, JweZipDeflate, octKey(24)},
+		{JweAlgA256KW, JweEncAlgA192GCM, "", octKey(32)},
+		{JweAlgDir, JweEncAlgA256GCM, "", octKey(32)},
+		{JweAlgDir, JweEncAlgA128CBC_HS256, "", octKey(32)},
+	}
+
+	message := []byte(strings.Repeat("The true sign of intelligence is not knowledge but imagination. ", 8))
+	for i, v := range vectors {
+		jwe := &Jwe{
+			ProtectedHeader: &JwHeader{Algorithm: v.alg, EncryptionAlg: v.enc, Compression: v.zip},
+			Message:         message,
+		}
+		if err := jwe.Encrypt(v.key); err != nil {
+			t.Errorf("Test %d (%s %s). Unable to encrypt JWE. Err: %v\n", i+1, v.alg, v.enc, err)
+			continue
+		}
+		compact, err := jwe.MarshalCompact()
+		if err != nil {
+			t.Errorf("Test %d (%s %s). Unable to marshal JWE. Err: %v\n", i+1, v.alg, v.enc, err)
+			continue
+		}
+
+		parsed := new(Jwe)
+		if err := parsed.UnmarshalCompact(compact); err != nil {
+			t.Errorf("Test %d (%s %s). Unable to unmarshal JWE. Err: %v\n", i+1, v.alg, v.enc, err)
+			continue
+		}
+		if err := parsed.DecryptWithKeySource(v.key); err != nil {
+			t.Errorf("Test %d (%s %s). Unable to decrypt JWE. Err: %v\n", i+1, v.alg, v.enc, err)
+			continue
+		}
+		if !bytes.Equal(parsed.Message, message) {
+			t.Errorf("Test %d (%s %s). Unexpected plaintext: %s\n", i+1, v.alg, v.enc, parsed.Message)
+		}
+	}
+
+	invalid := []struct {
+		name string
+		hdr  *JwHeader
+		key  *Jwk
+	}{
+		{"RSA1_5", &JwHeader{Algorithm: JweAlgRSA1_5, EncryptionAlg: JweEncAlgA128GCM}, rsaKey},
+		{"Unknown enc", &JwHeader{Algorithm: JweAlgA128KW, EncryptionAlg: "A128CTR"}, octKey(16)},
+		{"Wrong key size", &JwHeader{Algorithm: JweAlgA256KW, EncryptionAlg: JweEncAlgA128GCM}, octKey(16)},
+		{"Wrong key type", &JwHeader{Algorithm: JweAlgRSA_OAEP, EncryptionAlg: JweEncAlgA128GCM}, octKey(16)},
+		{"Wrong direct key size", &JwHeader{Algorithm: JweAlgDir, EncryptionAlg: JweEncAlgA128GCM}, octKey(32)},
+		{"Unknown zip", &JwHeader{Algorithm: JweAlgA128KW, EncryptionAlg: JweEncAlgA128GCM, Compression: "GZ"}, octKey(16)},
+	}
+	for i, v := range invalid {
+		if err := (&Jwe{ProtectedHeader: v.hdr, Message: message}).Encrypt(v.key); err == nil {
+			t.Errorf("Test %d (%s). JWE was encrypted\n", i+1, v.name)
+		}
+	}
+}
+
+// Returns an EC signing key and an RSA-OAEP-256 encryption key, for signed and then encrypted JWTs
+func newTestNestedJwtKeys(t *testing.T) (*Jwk, *Jwk) {
+	signKey := new(Jwk)
+	if err := json.Unmarshal(jwaSignerTestVectors[1].signKeyJson, signKey); err != nil {
+		t.Fatalf("Unable to unmarshal key. Err: %v\n", err)
+	}
+	encKey := new(Jwk)
+	if err := json.Unmarshal(jwaSignerTestVectors[2].signKeyJson, encKey); err != nil {
+		t.Fatalf("Unable to unmarshal key. Err: %v\n", err)
+	}
+	encKey.Algorithm = JweAlgRSA_OAEP_256
+
+	return signKey, encKey
+}
+
+func TestEncryptNestedJwt(t *testing.T) {
+	signKey, encKey := newTestNestedJwtKeys(t)
+
+	token, err := SignJwt(&ClaimSet{Subject: "alice"}, signKey, &JwtSignOptions{Algorithm: JwsAlgES256})
+	if err != nil {
+		t.Fatalf("Unable to sign JWT. Err: %v\n", err)
+	}
+	encrypted, err := EncryptNestedJwt(token, encKey, nil)
+	if err != nil {
+		t.Fatalf("Unable to encrypt JWT. Err: %v\n", err)
+	}
+
+	inner, hdr, err := DecryptNestedJwt(encrypted, encKey)
+	if err != nil {
+		t.Fatalf("Unable to decrypt JWT. Err: %v\n", err)
+	}
+	if inner != token || hdr.ContentType != JwtContentType || hdr.EncryptionAlg != JweEncAlgA256GCM {
+		t.Errorf("Unexpected nested JWT: %s, header: %+v\n", inner, hdr)
+	}
+
+	if _, _, err := DecryptNestedJwt(token, encKey); err == nil {
+		t.Errorf("JWS was decrypted as a JWE\n")
+	}
+
+	// The key's algorithm must match the header
+	other := *encKey
+	other.Algorithm = JweAlgRSA_OAEP
+	if _, _, err := DecryptNestedJwt(encrypted, &other); err == nil {
+		t.Errorf("JWE was decrypted with a key for another algorithm\n")
+	}
+}
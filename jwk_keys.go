@@ -163,3 +163,30 @@ func (jwk *Jwk) ClearTypeParams() {
 	jwk.E = -1
 	jwk.KeyValue = nil
 }
+
+// Public returns a copy of the JWK without any private key parameters. Symmetric (oct) keys have no public part,
+// so nil is returned for them.
+func (jwk *Jwk) Public() *Jwk {
+	pub := &Jwk{
+		Type:              jwk.Type,
+		Id:                jwk.Id,
+		Algorithm:         jwk.Algorithm,
+		Use:               jwk.Use,
+		Operations:        jwk.Operations,
+		AdditionalMembers: jwk.AdditionalMembers,
+	}
+
+	switch jwk.Type {
+	case KeyTypeEC:
+		pub.Curve = jwk.Curve
+		pub.X = jwk.X
+		pub.Y = jwk.Y
+	case KeyTypeRSA:
+		pub.N = jwk.N
+		pub.E = jwk.E
+	default:
+		return nil
+	}
+
+	return pub
+}
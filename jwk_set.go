@@ -57,7 +57,7 @@ func (jwks *JwkSet) UnmarshalJSON(data []byte) error {
 
 	// Check if there are JWK's contained in this JWK set. If there are, unmarshal them
 	if v, ok := obj["keys"]; ok {
-		err = json.Unmarshal(v, jwks.Keys)
+		err = json.Unmarshal(v, &jwks.Keys)
 		if err != nil {
 			return err
 		}
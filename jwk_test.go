@@ -2,6 +2,7 @@ package gose
 
 import (
 	"bytes"
+	"crypto"
 	ec "crypto/elliptic"
 	"crypto/rsa"
 	"encoding/json"
@@ -113,3 +114,36 @@ func TestJwkUnmarshal(t *testing.T) {
 		}
 	}
 }
+
+var jwkThumbprintTestVectors = []struct {
+	jJson      []byte
+	thumbprint string
+}{
+	// From https://tools.ietf.org/html/rfc7638#section-3.1
+	{
+		[]byte(`{"kty":"RSA","n":"0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw","e":"AQAB","alg":"RS256","kid":"2011-04-29"}`),
+		"NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs",
+	},
+}
+
+func TestJwkThumbprint(t *testing.T) {
+	for i, v := range jwkThumbprintTestVectors {
+		jwk := new(Jwk)
+		if err := json.Unmarshal(v.jJson, jwk); err != nil {
+			t.Errorf("Unable to Unmarshal jJson %d. Err: %v\n", i+1, err)
+		}
+
+		tp, err := jwk.ThumbprintB64()
+		if err != nil {
+			t.Errorf("Unable to compute thumbprint %d. Err: %v\n", i+1, err)
+		}
+		if tp != v.thumbprint {
+			t.Errorf("Thumbprint %d. \nExpected:\n%s \nGot:\n%s\n", i+1, v.thumbprint, tp)
+		}
+
+		// The thumbprint only depends on the public members
+		if pubTp, _ := jwk.Public().Thumbprint(crypto.SHA256); (&Base64UrlOctets{Octets: pubTp}).Encoded() != tp {
+			t.Errorf("Public key thumbprint %d doesn't match\n", i+1)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package gose
+
+import (
+	"crypto"
+	_ "crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+)
+
+// Thumbprint computes the JWK Thumbprint of the key using the hash function h as specified in
+// https://tools.ietf.org/html/rfc7638. Only the required public members of the key are hashed.
+func (jwk *Jwk) Thumbprint(h crypto.Hash) ([]byte, error) {
+	if !h.Available() {
+		return nil, errors.New("Thumbprint hash function is not available")
+	}
+
+	data, err := jwk.thumbprintJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	hh := h.New()
+	hh.Write(data)
+	return hh.Sum(nil), nil
+}
+
+// ThumbprintB64 returns the base64url-encoded SHA-256 JWK Thumbprint of the key. This is the form used by
+// "jkt" confirmation claims and thumbprint URIs.
+func (jwk *Jwk) ThumbprintB64() (string, error) {
+	tp, err := jwk.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(tp), nil
+}
+
+// Returns the JSON object that is hashed to form the thumbprint. The members are in lexicographic order, without
+// whitespace, as required by https://tools.ietf.org/html/rfc7638#section-3.2
+func (jwk *Jwk) thumbprintJSON() ([]byte, error) {
+	type member struct {
+		name  string
+		value string
+	}
+
+	var members []member
+
+	switch jwk.Type {
+	case KeyTypeEC:
+		if err := jwk.validateECParams(); err != nil {
+			return nil, err
+		}
+		// The coordinates must be the full size of the curve's field elements
+		size := ecdsaCurveByteSize(jwk.Curve)
+		members = []member{
+			{"crv", jwk.Curve.Params().Name},
+			{"kty", jwk.Type},
+			{"x", base64.RawURLEncoding.EncodeToString(jwk.X.FillBytes(make([]byte, size)))},
+			{"y", base64.RawURLEncoding.EncodeToString(jwk.Y.FillBytes(make([]byte, size)))},
+		}
+	case KeyTypeRSA:
+		if jwk.N == nil || jwk.E < 1 {
+			return nil, errors.New("RSA Required Params (N, E) are missing")
+		}
+		members = []member{
+			{"e", (&Base64UrlUInt{UInt: big.NewInt(int64(jwk.E))}).Encoded()},
+			{"kty", jwk.Type},
+			{"n", (&Base64UrlUInt{UInt: jwk.N}).Encoded()},
+		}
+	case KeyTypeOct:
+		if err := jwk.validateOctParams(); err != nil {
+			return nil, err
+		}
+		members = []member{
+			{"k", (&Base64UrlOctets{Octets: jwk.KeyValue}).Encoded()},
+			{"kty", jwk.Type},
+		}
+	default:
+		return nil, errors.New("KeyType (kty) must be EC, RSA or Oct")
+	}
+
+	out := []byte("{")
+	for i, m := range members {
+		if i > 0 {
+			out = append(out, ',')
+		}
+		name, _ := json.Marshal(m.name)
+		value, err := json.Marshal(m.value)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, name...)
+		out = append(out, ':')
+		out = append(out, value...)
+	}
+	out = append(out, '}')
+
+	return out, nil
+}
@@ -29,8 +29,9 @@ type JwsSignature struct {
 	b64URLProtHdrCache []byte
 }
 
-// Sign attempts to cryptographically sign the passed Base64URLEncoded payload using the configured Signature value
-func (jws *Jws) Sign(jwk *Jwk) error {
+// Sign attempts to cryptographically sign the passed Base64URLEncoded payload using the configured Signature value.
+// Options (e.g. WithDeterministicSigning) are applied to the signer before signing.
+func (jws *Jws) Sign(jwk *Jwk, opts ...SignerOption) error {
 
 	// Check if Jws has one or multiple signatures
 	if len(jws.Signatures) > 1 {
@@ -41,11 +42,11 @@ func (jws *Jws) Sign(jwk *Jwk) error {
 		return nil
 	}
 
-	return jws.Signatures[0].Sign(jws, jwk)
+	return jws.Signatures[0].Sign(jws, jwk, opts...)
 }
 
-// Verfies a JWS that has a single signature
-func (jws *Jws) Verify(jwk *Jwk) error {
+// Verfies a JWS that has a single signature. Options (e.g. WithStrictPSSVerify) are applied to the verifier.
+func (jws *Jws) Verify(jwk *Jwk, opts ...SignerOption) error {
 	// Check if Jws has one or multiple signatures
 	if len(jws.Signatures) > 1 {
 		return errors.New("More than one signature structure found.")
@@ -55,12 +56,12 @@ func (jws *Jws) Verify(jwk *Jwk) error {
 		return nil
 	}
 
-	return jws.Signatures[0].Verify(jws, jwk)
+	return jws.Signatures[0].Verify(jws, jwk, opts...)
 
 }
 
 // Private function, verifies a JwsSignature object
-func (jSig *JwsSignature) Verify(jws *Jws, jwk *Jwk) error {
+func (jSig *JwsSignature) Verify(jws *Jws, jwk *Jwk, opts ...SignerOption) error {
 	sigAlg, err := jSig.GetAlg()
 	if err != nil {
 		return err
@@ -82,6 +83,12 @@ func (jSig *JwsSignature) Verify(jws *Jws, jwk *Jwk) error {
 		return err
 	}
 
+	for _, opt := range opts {
+		if err := opt(signer); err != nil {
+			return err
+		}
+	}
+
 	p := make([]byte, len(jSig.b64URLProtHdrCache)+len(jws.b64URLPayloadCache)+1)
 
 	copy(p[:len(jSig.b64URLProtHdrCache)], jSig.b64URLProtHdrCache)
@@ -92,7 +99,7 @@ func (jSig *JwsSignature) Verify(jws *Jws, jwk *Jwk) error {
 	return signer.Verify(p, jSig.signature)
 }
 
-func (jSig *JwsSignature) Sign(jws *Jws, jwk *Jwk) error {
+func (jSig *JwsSignature) Sign(jws *Jws, jwk *Jwk, opts ...SignerOption) error {
 	if err := jSig.Validate(); err != nil {
 		return err
 	}
@@ -115,6 +122,12 @@ func (jSig *JwsSignature) Sign(jws *Jws, jwk *Jwk) error {
 		return err
 	}
 
+	for _, opt := range opts {
+		if err := opt(signer); err != nil {
+			return err
+		}
+	}
+
 	// Export the header to Json and then B64 Encode.
 	// Append separation dot "."
 	// Append b64 URL encoded body
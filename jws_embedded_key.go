@@ -0,0 +1,183 @@
+package gose
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// EmbeddedKeyPolicy is a KeySource that takes the verification key from the JWS header itself, either from an
+// embedded JWK ("jwk") or from the leaf of an X.509 certificate chain ("x5c"). The key is only returned if it is
+// trusted by the policy:
+//   - An x5c chain must validate against Roots and the leaf must be usable for digital signatures.
+//   - A jwk must have a SHA-256 JWK Thumbprint (https://tools.ietf.org/html/rfc7638) listed in JwkThumbprints.
+//
+// Only the protected header is used, as unprotected parameters could be replaced without invalidating the signature.
+type EmbeddedKeyPolicy struct {
+	// Roots are the trust anchors for x5c certificate chains. If nil, x5c is not accepted.
+	Roots *x509.CertPool
+	// Intermediates are additional intermediate certificates used to build the chain (optional)
+	Intermediates *x509.CertPool
+	// KeyUsages are the extended key usages the leaf certificate must be valid for. If empty, any is accepted.
+	KeyUsages []x509.ExtKeyUsage
+	// DNSName, if set, must match the leaf certificate
+	DNSName string
+	// CurrentTime is the time the chain is validated at. If zero, the current time is used.
+	CurrentTime time.Time
+	// JwkThumbprints is the allowlist of base64url-encoded SHA-256 JWK Thumbprints. If empty, jwk is not accepted.
+	JwkThumbprints []string
+}
+
+// ResolveKey implements the KeySource interface, returning the public key embedded in the header if it is trusted.
+func (p *EmbeddedKeyPolicy) ResolveKey(hdr *JwHeader) (*Jwk, error) {
+	var jwk *Jwk
+	var err error
+
+	switch {
+	case len(hdr.X509CertChain) > 0:
+		if jwk, err = p.resolveX509(hdr); err != nil {
+			return nil, err
+		}
+		// If both are present, the embedded JWK must be the leaf certificate's key
+		if hdr.Jwk != nil {
+			if err := matchThumbprints(hdr.Jwk, jwk); err != nil {
+				return nil, err
+			}
+		}
+	case hdr.Jwk != nil:
+		if jwk, err = p.resolveJwk(hdr); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("Header has no embedded key (jwk or x5c)")
+	}
+
+	// The key must be usable with the header's algorithm
+	if kty := GetKeyType(hdr.Algorithm); kty != jwk.Type {
+		return nil, fmt.Errorf("Embedded key type (kty=%v) doesn't match the algorithm key type (%v)", jwk.Type, kty)
+	}
+
+	return jwk, nil
+}
+
+func (p *EmbeddedKeyPolicy) resolveJwk(hdr *JwHeader) (*Jwk, error) {
+	if len(p.JwkThumbprints) < 1 {
+		return nil, errors.New("Embedded jwk keys are not accepted by the policy")
+	}
+
+	// A symmetric key in a header would let anyone forge signatures
+	jwk := hdr.Jwk.Public()
+	if jwk == nil {
+		return nil, errors.New("Embedded jwk must be an asymmetric (EC or RSA) public key")
+	} else if err := jwk.Validate(); err != nil {
+		return nil, err
+	}
+
+	tp, err := jwk.ThumbprintB64()
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range p.JwkThumbprints {
+		if subtle.ConstantTimeCompare([]byte(v), []byte(tp)) == 1 {
+			return jwk, nil
+		}
+	}
+
+	return nil, fmt.Errorf("Embedded jwk thumbprint (%s) is not in the policy's allowlist", tp)
+}
+
+func (p *EmbeddedKeyPolicy) resolveX509(hdr *JwHeader) (*Jwk, error) {
+	if p.Roots == nil {
+		return nil, errors.New("Embedded x5c certificate chains are not accepted by the policy")
+	}
+
+	certs := make([]*x509.Certificate, len(hdr.X509CertChain))
+	for i, der := range hdr.X509CertChain {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse x5c certificate at index=%d: %v", i, err)
+		}
+		certs[i] = cert
+	}
+
+	leaf, err := p.verifyChain(certs)
+	if err != nil {
+		return nil, err
+	}
+
+	// If the header also carries thumbprints of the certificate, they must match the leaf
+	if len(hdr.X509Sha256Thumbprint) > 0 {
+		if tp := sha256.Sum256(leaf.Raw); !bytes.Equal(tp[:], hdr.X509Sha256Thumbprint) {
+			return nil, errors.New("x5t#S256 doesn't match the x5c leaf certificate")
+		}
+	}
+	if len(hdr.X509Thumbprint) > 0 {
+		if tp := sha1.Sum(leaf.Raw); !bytes.Equal(tp[:], hdr.X509Thumbprint) {
+			return nil, errors.New("x5t doesn't match the x5c leaf certificate")
+		}
+	}
+
+	jwk := new(Jwk)
+	if err := jwk.ImportKey(leaf.PublicKey); err != nil {
+		return nil, err
+	}
+
+	return jwk, nil
+}
+
+// Validates a certificate chain (leaf first) against the policy and returns the leaf certificate
+func (p *EmbeddedKeyPolicy) verifyChain(certs []*x509.Certificate) (*x509.Certificate, error) {
+	leaf := certs[0]
+
+	intermediates := x509.NewCertPool()
+	if p.Intermediates != nil {
+		intermediates = p.Intermediates.Clone()
+	}
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	keyUsages := p.KeyUsages
+	if len(keyUsages) < 1 {
+		keyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageAny}
+	}
+
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         p.Roots,
+		Intermediates: intermediates,
+		DNSName:       p.DNSName,
+		CurrentTime:   p.CurrentTime,
+		KeyUsages:     keyUsages,
+	}); err != nil {
+		return nil, err
+	}
+
+	// If the key usage extension is present, it must allow digital signatures
+	if leaf.KeyUsage != 0 && leaf.KeyUsage&x509.KeyUsageDigitalSignature == 0 {
+		return nil, errors.New("x5c leaf certificate key usage doesn't permit digital signatures")
+	}
+
+	return leaf, nil
+}
+
+// Returns an error if the two keys don't have the same JWK Thumbprint
+func matchThumbprints(a, b *Jwk) error {
+	tpA, err := a.ThumbprintB64()
+	if err != nil {
+		return err
+	}
+	tpB, err := b.ThumbprintB64()
+	if err != nil {
+		return err
+	}
+	if tpA != tpB {
+		return errors.New("Embedded jwk doesn't match the x5c leaf certificate key")
+	}
+
+	return nil
+}
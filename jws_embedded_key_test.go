@@ -0,0 +1,169 @@
+package gose
+
+import (
+	"crypto/ecdsa"
+	ec "crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// Creates a certificate for key signed by parent (or self-signed if parent is nil)
+func createTestCert(t *testing.T, cn string, key *ecdsa.PrivateKey, parent *x509.Certificate,
+	parentKey *ecdsa.PrivateKey, isCA bool, usage x509.KeyUsage) *x509.Certificate {
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              usage,
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	if !isCA {
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("Unable to create certificate. Err: %v\n", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Unable to parse certificate. Err: %v\n", err)
+	}
+
+	return cert
+}
+
+// Signs a compact JWS with the header and key and returns the parsed JWS
+func signTestJws(t *testing.T, hdr *JwHeader, key *Jwk) *Jws {
+	jws := &Jws{
+		Payload:    []byte(`{"iss":"joe"}`),
+		Signatures: []*JwsSignature{&JwsSignature{ProtectedHeader: hdr}},
+	}
+	if err := jws.Sign(key); err != nil {
+		t.Fatalf("Unable to sign jws. Err: %v\n", err)
+	}
+	compact, err := jws.MarshalCompact()
+	if err != nil {
+		t.Fatalf("Unable to marshal jws. Err: %v\n", err)
+	}
+
+	jwsRecv := new(Jws)
+	if err := jwsRecv.UnmarshalCompact(compact); err != nil {
+		t.Fatalf("Unable to unmarshal jws. Err: %v\n", err)
+	}
+
+	return jwsRecv
+}
+
+func TestEmbeddedKeyX5c(t *testing.T) {
+	caKey, _ := ecdsa.GenerateKey(ec.P256(), rand.Reader)
+	ca := createTestCert(t, "Test CA", caKey, nil, nil, true, x509.KeyUsageCertSign)
+	otherCaKey, _ := ecdsa.GenerateKey(ec.P256(), rand.Reader)
+	otherCa := createTestCert(t, "Other CA", otherCaKey, nil, nil, true, x509.KeyUsageCertSign)
+
+	leafKey, _ := ecdsa.GenerateKey(ec.P256(), rand.Reader)
+	leaf := createTestCert(t, "Signer", leafKey, ca, caKey, false, x509.KeyUsageDigitalSignature)
+	encLeaf := createTestCert(t, "Encrypter", leafKey, ca, caKey, false, x509.KeyUsageKeyAgreement)
+
+	signKey := new(Jwk)
+	signKey.ImportKey(leafKey)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	otherRoots := x509.NewCertPool()
+	otherRoots.AddCert(otherCa)
+
+	vectors := []struct {
+		name   string
+		chain  [][]byte
+		policy *EmbeddedKeyPolicy
+		valid  bool
+	}{
+		{"Trusted chain", [][]byte{leaf.Raw}, &EmbeddedKeyPolicy{Roots: roots}, true},
+		{"Trusted chain with EKU", [][]byte{leaf.Raw, ca.Raw},
+			&EmbeddedKeyPolicy{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}, true},
+		{"Wrong EKU", [][]byte{leaf.Raw},
+			&EmbeddedKeyPolicy{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning}}, false},
+		{"Untrusted root", [][]byte{leaf.Raw}, &EmbeddedKeyPolicy{Roots: otherRoots}, false},
+		{"No roots configured", [][]byte{leaf.Raw}, &EmbeddedKeyPolicy{}, false},
+		{"No digital signature usage", [][]byte{encLeaf.Raw}, &EmbeddedKeyPolicy{Roots: roots}, false},
+	}
+
+	for i, v := range vectors {
+		jws := signTestJws(t, &JwHeader{Algorithm: JwsAlgES256, X509CertChain: v.chain}, signKey)
+
+		err := jws.VerifyWithKeySource(v.policy)
+		if v.valid && err != nil {
+			t.Errorf("Test %d (%s). Unable to verify. Err: %v\n", i+1, v.name, err)
+		} else if !v.valid && err == nil {
+			t.Errorf("Test %d (%s). Verification was expected to fail\n", i+1, v.name)
+		}
+	}
+}
+
+func TestEmbeddedKeyJwk(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(ec.P256(), rand.Reader)
+	signKey := new(Jwk)
+	signKey.ImportKey(key)
+	tp, err := signKey.ThumbprintB64()
+	if err != nil {
+		t.Fatalf("Unable to compute thumbprint. Err: %v\n", err)
+	}
+
+	vectors := []struct {
+		name   string
+		hdr    *JwHeader
+		policy *EmbeddedKeyPolicy
+		valid  bool
+	}{
+		{"Allowlisted jwk", &JwHeader{Algorithm: JwsAlgES256, Jwk: signKey.Public()},
+			&EmbeddedKeyPolicy{JwkThumbprints: []string{"other", tp}}, true},
+		{"Not allowlisted", &JwHeader{Algorithm: JwsAlgES256, Jwk: signKey.Public()},
+			&EmbeddedKeyPolicy{JwkThumbprints: []string{"other"}}, false},
+		{"No allowlist", &JwHeader{Algorithm: JwsAlgES256, Jwk: signKey.Public()}, &EmbeddedKeyPolicy{}, false},
+		{"No embedded key", &JwHeader{Algorithm: JwsAlgES256},
+			&EmbeddedKeyPolicy{JwkThumbprints: []string{tp}}, false},
+	}
+
+	for i, v := range vectors {
+		jws := signTestJws(t, v.hdr, signKey)
+
+		err := jws.VerifyWithKeySource(v.policy)
+		if v.valid && err != nil {
+			t.Errorf("Test %d (%s). Unable to verify. Err: %v\n", i+1, v.name, err)
+		} else if !v.valid && err == nil {
+			t.Errorf("Test %d (%s). Verification was expected to fail\n", i+1, v.name)
+		}
+	}
+}
+
+func TestVerifyWithKeySourceKeyType(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(ec.P256(), rand.Reader)
+	signKey := new(Jwk)
+	signKey.ImportKey(key)
+	jws := signTestJws(t, &JwHeader{Algorithm: JwsAlgES256}, signKey)
+
+	// The header's algorithm chooses the verifier, so a key of another type must be rejected rather than used
+	rsaKey := new(Jwk)
+	if err := json.Unmarshal(jwaSignerTestVectors[2].signKeyJson, rsaKey); err != nil {
+		t.Fatalf("Unable to unmarshal key. Err: %v\n", err)
+	}
+	if err := jws.VerifyWithKeySource(rsaKey.Public()); err == nil {
+		t.Errorf("JWS was verified with a key of the wrong type\n")
+	}
+
+	if err := jws.VerifyWithKeySource(signKey.Public()); err != nil {
+		t.Errorf("Unable to verify. Err: %v\n", err)
+	}
+}
@@ -0,0 +1,273 @@
+package gose
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Maximum size of the protected header and signature segments read by VerifyCompactStream. Only the payload
+// segment is streamed, so the other segments are bounded to keep memory use constant.
+const (
+	jwsStreamMaxHeaderSize    = 64 * 1024
+	jwsStreamMaxSignatureSize = 16 * 1024
+)
+
+// SignCompactStream signs a payload read from an io.Reader and writes the compact serialized JWS to w. The payload
+// is base64url-encoded and hashed in a single pass, so it never has to be held in memory. If detached is true the
+// payload segment is left empty (see https://tools.ietf.org/html/rfc7515#appendix-F) and only the header and
+// signature are written. The signature is also stored in the JwsSignature.
+func (jSig *JwsSignature) SignCompactStream(w io.Writer, payload io.Reader, jwk *Jwk, detached bool,
+	opts ...SignerOption) error {
+
+	if err := jSig.Validate(); err != nil {
+		return err
+	}
+	if jSig.ProtectedHeader == nil {
+		return errors.New("A protected header is required for JWS Compact serialization")
+	}
+
+	sigAlg, _ := jSig.GetAlg()
+	signer, err := newJwaHashSigner(sigAlg)
+	if err != nil {
+		return err
+	}
+
+	// Set the signing key to the key passed into this function
+	if err := signer.SetSignKey(jwk); err != nil {
+		return err
+	}
+
+	for _, opt := range opts {
+		if err := opt(signer); err != nil {
+			return err
+		}
+	}
+
+	protHdrJson, err := jSig.ProtectedHeader.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	protHdrB64Url := []byte(base64.RawURLEncoding.EncodeToString(protHdrJson))
+
+	h := signer.NewHash()
+	h.Write(protHdrB64Url)
+	h.Write([]byte("."))
+
+	if _, err := w.Write(protHdrB64Url); err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte(".")); err != nil {
+		return err
+	}
+
+	// Encode the payload into the hash, and into the output unless the payload is detached
+	var dst io.Writer = h
+	if !detached {
+		dst = io.MultiWriter(w, h)
+	}
+	enc := base64.NewEncoder(base64.RawURLEncoding, dst)
+	if _, err := io.Copy(enc, payload); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+
+	sig, err := signer.SignHash(h)
+	if err != nil {
+		return err
+	}
+	jSig.signature = sig
+	jSig.b64URLProtHdrCache = protHdrB64Url
+
+	if _, err := w.Write([]byte(".")); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, base64.RawURLEncoding.EncodeToString(sig))
+
+	return err
+}
+
+// VerifyCompactStream reads a compact serialized JWS from r and verifies its signature with jwk. The payload segment
+// is hashed and base64url-decoded in a single pass, and the decoded payload is written to payload (which may be nil).
+// The data written to payload must not be trusted unless VerifyCompactStream returns a nil error.
+//
+// If detachedPayload is not nil, the JWS must have an empty payload segment and the payload is read from
+// detachedPayload instead (see https://tools.ietf.org/html/rfc7515#appendix-F).
+//
+// The parsed signature, including its protected header, is returned.
+func VerifyCompactStream(r io.Reader, payload io.Writer, detachedPayload io.Reader, jwk *Jwk,
+	opts ...SignerOption) (*JwsSignature, error) {
+
+	br := bufio.NewReader(r)
+
+	// Parse the protected header
+	hdrSeg := &jwsSegmentReader{r: br}
+	protHdrB64Url, err := io.ReadAll(io.LimitReader(hdrSeg, jwsStreamMaxHeaderSize+1))
+	if err != nil {
+		return nil, err
+	} else if !hdrSeg.found {
+		return nil, errors.New("Invalid Compact JWS. The number of jws segments must be exactly 3")
+	} else if len(protHdrB64Url) > jwsStreamMaxHeaderSize {
+		return nil, fmt.Errorf("JWS protected header exceeds the maximum size of %d bytes", jwsStreamMaxHeaderSize)
+	}
+	protHdrB64Url = bytes.TrimSpace(protHdrB64Url)
+
+	pHdrJson, err := base64.RawURLEncoding.DecodeString(string(protHdrB64Url))
+	if err != nil {
+		return nil, err
+	}
+	pHdr := new(JwHeader)
+	if err := pHdr.UnmarshalJSON(pHdrJson); err != nil {
+		return nil, err
+	}
+
+	jSig := &JwsSignature{ProtectedHeader: pHdr, b64URLProtHdrCache: protHdrB64Url}
+	if err := jSig.Validate(); err != nil {
+		return nil, err
+	}
+
+	sigAlg, _ := jSig.GetAlg()
+	if err := checkKeyType(jwk, sigAlg); err != nil {
+		return nil, err
+	}
+	signer, err := newJwaHashSigner(sigAlg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Try to set the verification key
+	if err := signer.SetVerifyKey(jwk); err != nil {
+		return nil, err
+	}
+
+	for _, opt := range opts {
+		if err := opt(signer); err != nil {
+			return nil, err
+		}
+	}
+
+	h := signer.NewHash()
+	h.Write(protHdrB64Url)
+	h.Write([]byte("."))
+
+	if payload == nil {
+		payload = io.Discard
+	}
+
+	// Hash and decode the payload segment
+	paySeg := &jwsSegmentReader{r: br}
+	if detachedPayload != nil {
+		if n, err := io.Copy(io.Discard, paySeg); err != nil {
+			return nil, err
+		} else if n > 0 {
+			return nil, errors.New("A JWS with a detached payload must have an empty payload segment")
+		}
+
+		enc := base64.NewEncoder(base64.RawURLEncoding, h)
+		if _, err := io.Copy(io.MultiWriter(enc, payload), detachedPayload); err != nil {
+			return nil, err
+		}
+		if err := enc.Close(); err != nil {
+			return nil, err
+		}
+	} else {
+		dec := base64.NewDecoder(base64.RawURLEncoding, io.TeeReader(paySeg, h))
+		if _, err := io.Copy(payload, dec); err != nil {
+			return nil, err
+		}
+	}
+	if !paySeg.found {
+		return nil, errors.New("Invalid Compact JWS. The number of jws segments must be exactly 3")
+	}
+
+	// Parse the signature, which is the remainder of the stream
+	sigB64Url, err := io.ReadAll(io.LimitReader(br, jwsStreamMaxSignatureSize+1))
+	if err != nil {
+		return nil, err
+	} else if len(sigB64Url) > jwsStreamMaxSignatureSize {
+		return nil, fmt.Errorf("JWS signature exceeds the maximum size of %d bytes", jwsStreamMaxSignatureSize)
+	}
+	sigB64Url = bytes.TrimSpace(sigB64Url)
+	if bytes.IndexByte(sigB64Url, '.') >= 0 {
+		return nil, errors.New("Invalid Compact JWS. The number of jws segments must be exactly 3")
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(string(sigB64Url))
+	if err != nil {
+		return nil, err
+	}
+	jSig.signature = sig
+
+	// Perform verification
+	if err := signer.VerifyHash(h, sig); err != nil {
+		return nil, err
+	}
+
+	return jSig, nil
+}
+
+// Returns a JwaHashSigner for the JWS algorithm. Unsecured JWS's (alg=none) can't be streamed as there is nothing
+// to verify.
+func newJwaHashSigner(jwsAlg string) (JwaHashSigner, error) {
+	if jwsAlg == JwsAlgNone {
+		return nil, errors.New("Unsecured JWS (alg=none) can not be signed or verified as a stream")
+	}
+
+	signer, err := NewJwaSigner(jwsAlg)
+	if err != nil {
+		return nil, err
+	}
+
+	hashSigner, ok := signer.(JwaHashSigner)
+	if !ok {
+		return nil, fmt.Errorf("JWS ALG: %s does not support streaming", jwsAlg)
+	}
+
+	return hashSigner, nil
+}
+
+// jwsSegmentReader reads a single "." separated segment of a compact serialized JWS. It returns io.EOF after the
+// separator has been consumed, or when the underlying reader is exhausted; found reports which of these occurred.
+type jwsSegmentReader struct {
+	r     *bufio.Reader
+	done  bool
+	found bool
+}
+
+func (s *jwsSegmentReader) Read(p []byte) (int, error) {
+	if s.done {
+		return 0, io.EOF
+	} else if len(p) == 0 {
+		return 0, nil
+	}
+
+	// Make sure there is buffered data to search for the separator
+	if _, err := s.r.Peek(1); err != nil {
+		s.done = true
+		return 0, err
+	}
+
+	n := s.r.Buffered()
+	if n > len(p) {
+		n = len(p)
+	}
+	buf, _ := s.r.Peek(n)
+
+	if i := bytes.IndexByte(buf, '.'); i >= 0 {
+		copy(p, buf[:i])
+		s.r.Discard(i + 1)
+		s.done = true
+		s.found = true
+		return i, nil
+	}
+
+	copy(p, buf)
+	s.r.Discard(n)
+
+	return n, nil
+}
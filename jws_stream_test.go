@@ -0,0 +1,144 @@
+package gose
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+var jwsStreamTestVectors = []struct {
+	alg     string
+	keyJson []byte
+}{
+	{JwsAlgHS256, jwaSignerTestVectors[0].signKeyJson},
+	{JwsAlgES256, jwaSignerTestVectors[1].signKeyJson},
+	{JwsAlgRS384, jwaSignerTestVectors[2].signKeyJson},
+	{JwsAlgPS512, jwaSignerTestVectors[2].signKeyJson},
+}
+
+// Sign a payload as a stream, then verify with both the in-memory and the streaming verifiers
+func TestJwsStreamCompact(t *testing.T) {
+	payload := make([]byte, 1<<20+7)
+	rand.Read(payload)
+
+	for i, v := range jwsStreamTestVectors {
+		jwk := new(Jwk)
+		if err := json.Unmarshal(v.keyJson, &jwk); err != nil {
+			t.Fatalf("Unable to unmarshal key %d. Err: %v\n", i+1, err)
+		}
+
+		jSig := &JwsSignature{ProtectedHeader: &JwHeader{Algorithm: v.alg}}
+		out := new(bytes.Buffer)
+		if err := jSig.SignCompactStream(out, bytes.NewReader(payload), jwk, false); err != nil {
+			t.Errorf("Unable to stream sign jws %d. Err: %v\n", i+1, err)
+			continue
+		}
+
+		jws := new(Jws)
+		if err := jws.UnmarshalCompact(out.Bytes()); err != nil {
+			t.Errorf("Unable to unmarshal jws %d. Err: %v\n", i+1, err)
+		} else if err := jws.Verify(jwk); err != nil {
+			t.Errorf("Unable to verify stream signed jws %d. Err: %v\n", i+1, err)
+		}
+
+		decoded := new(bytes.Buffer)
+		if _, err := VerifyCompactStream(bytes.NewReader(out.Bytes()), decoded, nil, jwk); err != nil {
+			t.Errorf("Unable to stream verify jws %d. Err: %v\n", i+1, err)
+		}
+		if !bytes.Equal(decoded.Bytes(), payload) {
+			t.Errorf("Stream verified payload %d doesn't match the signed payload\n", i+1)
+		}
+
+		// Tamper with the payload
+		tampered := out.Bytes()
+		tampered[len(tampered)/2] ^= 0x01
+		if _, err := VerifyCompactStream(bytes.NewReader(tampered), nil, nil, jwk); err == nil {
+			t.Errorf("Tampered jws %d was verified\n", i+1)
+		}
+	}
+}
+
+func TestJwsStreamDetached(t *testing.T) {
+	payload := []byte(`{"iss":"joe","exp":1300819380,"http://example.com/is_root":true}`)
+
+	for i, v := range jwsStreamTestVectors {
+		jwk := new(Jwk)
+		if err := json.Unmarshal(v.keyJson, &jwk); err != nil {
+			t.Fatalf("Unable to unmarshal key %d. Err: %v\n", i+1, err)
+		}
+
+		jSig := &JwsSignature{ProtectedHeader: &JwHeader{Algorithm: v.alg}}
+		out := new(bytes.Buffer)
+		if err := jSig.SignCompactStream(out, bytes.NewReader(payload), jwk, true); err != nil {
+			t.Errorf("Unable to stream sign jws %d. Err: %v\n", i+1, err)
+			continue
+		}
+		if strings.Count(out.String(), "..") != 1 {
+			t.Errorf("Detached jws %d must have an empty payload segment. Got: %s\n", i+1, out.String())
+		}
+
+		if _, err := VerifyCompactStream(bytes.NewReader(out.Bytes()), nil, bytes.NewReader(payload), jwk); err != nil {
+			t.Errorf("Unable to verify detached jws %d. Err: %v\n", i+1, err)
+		}
+		if _, err := VerifyCompactStream(bytes.NewReader(out.Bytes()), nil, strings.NewReader("other"), jwk); err == nil {
+			t.Errorf("Detached jws %d was verified with a different payload\n", i+1)
+		}
+	}
+}
+
+// A streamed HMAC signature must be identical to the in-memory one
+func TestJwsStreamMatchesSign(t *testing.T) {
+	jwk := new(Jwk)
+	if err := json.Unmarshal(jwaSignerTestVectors[0].signKeyJson, &jwk); err != nil {
+		t.Fatalf("Unable to unmarshal key. Err: %v\n", err)
+	}
+
+	payload := []byte(`{"iss":"joe","exp":1300819380,"http://example.com/is_root":true}`)
+	jws := &Jws{
+		Payload:    payload,
+		Signatures: []*JwsSignature{&JwsSignature{ProtectedHeader: &JwHeader{Algorithm: JwsAlgHS256, Type: "JWT"}}},
+	}
+	if err := jws.Sign(jwk); err != nil {
+		t.Fatalf("Unable to sign jws. Err: %v\n", err)
+	}
+	expected, err := jws.MarshalCompact()
+	if err != nil {
+		t.Fatalf("Unable to marshal jws. Err: %v\n", err)
+	}
+
+	jSig := &JwsSignature{ProtectedHeader: &JwHeader{Algorithm: JwsAlgHS256, Type: "JWT"}}
+	out := new(bytes.Buffer)
+	if err := jSig.SignCompactStream(out, bytes.NewReader(payload), jwk, false); err != nil {
+		t.Fatalf("Unable to stream sign jws. Err: %v\n", err)
+	}
+
+	if !bytes.Equal(out.Bytes(), expected) {
+		t.Errorf("\nExpected:\n%s \nGot:\n%s\n", expected, out.Bytes())
+	}
+}
+
+// The header's algorithm must not be used with a key of another type
+func TestJwsStreamKeyType(t *testing.T) {
+	ecKey, rsaKey := new(Jwk), new(Jwk)
+	if err := json.Unmarshal(jwaSignerTestVectors[1].signKeyJson, ecKey); err != nil {
+		t.Fatalf("Unable to unmarshal key. Err: %v\n", err)
+	}
+	if err := json.Unmarshal(jwaSignerTestVectors[2].signKeyJson, rsaKey); err != nil {
+		t.Fatalf("Unable to unmarshal key. Err: %v\n", err)
+	}
+
+	jSig := &JwsSignature{ProtectedHeader: &JwHeader{Algorithm: JwsAlgES256}}
+	out := new(bytes.Buffer)
+	if err := jSig.SignCompactStream(out, strings.NewReader("payload"), ecKey, false); err != nil {
+		t.Fatalf("Unable to stream sign jws. Err: %v\n", err)
+	}
+
+	if _, err := VerifyCompactStream(bytes.NewReader(out.Bytes()), nil, nil, rsaKey.Public()); err == nil {
+		t.Errorf("JWS was verified with a key of the wrong type\n")
+	}
+	if _, err := VerifyCompactStream(bytes.NewReader(out.Bytes()), nil, nil, ecKey.Public()); err != nil {
+		t.Errorf("Unable to stream verify jws. Err: %v\n", err)
+	}
+}
@@ -0,0 +1,300 @@
+package gose
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// JWT header type (typ) and content type (cty) values as specified in:
+// https://tools.ietf.org/html/rfc7519#section-5
+const (
+	JwtType        string = "JWT"
+	JwtContentType string = "JWT"
+)
+
+// Maximum number of nested JWTs (cty=JWT) that are followed when parsing
+const jwtMaxNestingDepth = 4
+
+// Jwt is a signed JSON Web Token (https://tools.ietf.org/html/rfc7519) whose signature has been verified
+type Jwt struct {
+	// Header is the protected header of the JWT. For nested JWTs this is the header of the innermost JWT.
+	Header *JwHeader
+	// Claims is the decoded claim set
+	Claims *ClaimSet
+	// Payload is the raw JSON claim set
+	Payload []byte
+	// Outer holds the headers of any enclosing JWTs (cty=JWT), outermost first
+	Outer []*JwHeader
+}
+
+// ClaimValidator validates the claims of a JWT after its signature has been verified
+type ClaimValidator interface {
+	ValidateClaims(c *ClaimSet) error
+}
+
+// ClaimValidatorFunc is an adapter to allow the use of an ordinary function as a ClaimValidator
+type ClaimValidatorFunc func(c *ClaimSet) error
+
+func (f ClaimValidatorFunc) ValidateClaims(c *ClaimSet) error {
+	return f(c)
+}
+
+// JwtSignOptions configures how a JWT is signed
+type JwtSignOptions struct {
+	// Algorithm is the JWS algorithm (alg). If empty, the key's algorithm is used.
+	Algorithm string
+	// KeyId is the key id (kid) put in the header. If empty, the key's id is used.
+	KeyId string
+	// Type is the header type (typ). Defaults to "JWT".
+	Type string
+	// ContentType is the header content type (cty). It must only be set for nested JWTs, see SignNestedJwt.
+	ContentType string
+	// Header provides additional header parameters. The fields above take precedence over its values.
+	Header *JwHeader
+	// SignerOptions are applied to the signer, e.g. WithDeterministicSigning
+	SignerOptions []SignerOption
+}
+
+// SignJwt marshals the claims, signs them with key and returns the compact serialized JWT
+func SignJwt(claims *ClaimSet, key *Jwk, opts *JwtSignOptions) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	return signJwtPayload(payload, key, opts)
+}
+
+// SignNestedJwt signs a compact serialized JWT (e.g. to add a signature from another party), setting the content
+// type (cty) to "JWT" as described in https://tools.ietf.org/html/rfc7519#section-5.2
+func SignNestedJwt(token string, key *Jwk, opts *JwtSignOptions) (string, error) {
+	o := JwtSignOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	o.ContentType = JwtContentType
+
+	return signJwtPayload([]byte(strings.TrimSpace(token)), key, &o)
+}
+
+// JwtEncryptOptions configures how a JWT is encrypted
+type JwtEncryptOptions struct {
+	// Algorithm is the JWE key management algorithm (alg). If empty, the key's algorithm is used.
+	Algorithm string
+	// Encryption is the JWE content encryption algorithm (enc). Defaults to A256GCM.
+	Encryption string
+	// KeyId is the key id (kid) put in the header. If empty, the key's id is used.
+	KeyId string
+	// Type is the header type (typ). If empty, no type is set.
+	Type string
+}
+
+// EncryptNestedJwt encrypts a compact serialized (signed) JWT for the holder of key, returning a compact serialized
+// JWE with the content type (cty) "JWT" as described in https://tools.ietf.org/html/rfc7519#section-5.2
+func EncryptNestedJwt(token string, key *Jwk, opts *JwtEncryptOptions) (string, error) {
+	if key == nil {
+		return "", errors.New("A key is required to encrypt a JWT")
+	}
+	if opts == nil {
+		opts = &JwtEncryptOptions{}
+	}
+
+	hdr := &JwHeader{
+		Algorithm:     opts.Algorithm,
+		EncryptionAlg: opts.Encryption,
+		KeyId:         opts.KeyId,
+		Type:          opts.Type,
+		ContentType:   JwtContentType,
+	}
+	if hdr.Algorithm == "" {
+		hdr.Algorithm = key.Algorithm
+	}
+	if hdr.Algorithm == "" {
+		return "", errors.New("No JWE algorithm (alg) set in the options or the key")
+	}
+	if hdr.EncryptionAlg == "" {
+		hdr.EncryptionAlg = JweEncAlgA256GCM
+	}
+	if hdr.KeyId == "" {
+		hdr.KeyId = key.Id
+	}
+
+	jwe := &Jwe{ProtectedHeader: hdr, Message: []byte(strings.TrimSpace(token))}
+	if err := jwe.Encrypt(key); err != nil {
+		return "", err
+	}
+
+	compact, err := jwe.MarshalCompact()
+	if err != nil {
+		return "", err
+	}
+
+	return string(compact), nil
+}
+
+// DecryptNestedJwt decrypts a compact serialized JWE with the key resolved by ks and returns the enclosed JWT, which
+// must still be verified (e.g. with ParseJwt), and the JWE header
+func DecryptNestedJwt(token string, ks KeySource) (string, *JwHeader, error) {
+	if ks == nil {
+		return "", nil, errors.New("A KeySource is required to decrypt a JWT")
+	}
+
+	jwe := new(Jwe)
+	if err := jwe.UnmarshalCompact([]byte(token)); err != nil {
+		return "", nil, err
+	}
+	if err := jwe.DecryptWithKeySource(ks); err != nil {
+		return "", nil, err
+	}
+
+	return string(jwe.Message), jwe.ProtectedHeader, nil
+}
+
+// Decrypts the token if it is a compact serialized JWE and returns the enclosed JWT. Encrypted tokens are rejected if
+// keys is nil, and tokens that aren't encrypted if required is set.
+func decryptJwt(token string, keys KeySource, required bool) (string, error) {
+	token = strings.TrimSpace(token)
+	if strings.Count(token, ".") != 4 {
+		if required {
+			return "", errors.New("JWT must be encrypted")
+		}
+		return token, nil
+	} else if keys == nil {
+		return "", errors.New("Encrypted JWTs are not accepted")
+	}
+
+	inner, _, err := DecryptNestedJwt(token, keys)
+	return inner, err
+}
+
+// ParseAndVerifyJwt parses a compact serialized JWT, verifies its signature with the key resolved by ks and
+// validates the claims with validator (if not nil). The verified claims are returned.
+func ParseAndVerifyJwt(token string, ks KeySource, validator ClaimValidator) (*ClaimSet, error) {
+	jwt, err := ParseJwt(token, ks, validator)
+	if err != nil {
+		return nil, err
+	}
+
+	return jwt.Claims, nil
+}
+
+// ParseJwt is like ParseAndVerifyJwt, but returns the verified JWT including its header. Nested JWTs (cty=JWT) are
+// verified with the same KeySource. Options are applied to every signature verifier.
+func ParseJwt(token string, ks KeySource, validator ClaimValidator, opts ...SignerOption) (*Jwt, error) {
+	jwt, err := parseJwtPayload(token, ks, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := new(ClaimSet)
+	if err := json.Unmarshal(jwt.Payload, claims); err != nil {
+		return nil, err
+	}
+	jwt.Claims = claims
+
+	if validator != nil {
+		if err := validator.ValidateClaims(claims); err != nil {
+			return nil, err
+		}
+	}
+
+	return jwt, nil
+}
+
+// Signs the payload as a compact serialized JWS with a header built from opts
+func signJwtPayload(payload []byte, key *Jwk, opts *JwtSignOptions) (string, error) {
+	if key == nil {
+		return "", errors.New("A key is required to sign a JWT")
+	}
+	if opts == nil {
+		opts = &JwtSignOptions{}
+	}
+
+	hdr := new(JwHeader)
+	if opts.Header != nil {
+		*hdr = *opts.Header
+	}
+
+	hdr.Algorithm = opts.Algorithm
+	if hdr.Algorithm == "" {
+		hdr.Algorithm = key.Algorithm
+	}
+	if hdr.Algorithm == "" {
+		return "", errors.New("No JWS algorithm (alg) set in the options or the key")
+	} else if !IsValidJwsAlg(hdr.Algorithm) {
+		return "", fmt.Errorf("JWS ALG: %s can not be used to sign a JWT", hdr.Algorithm)
+	}
+
+	if opts.KeyId != "" {
+		hdr.KeyId = opts.KeyId
+	} else if hdr.KeyId == "" {
+		hdr.KeyId = key.Id
+	}
+
+	if opts.Type != "" {
+		hdr.Type = opts.Type
+	} else if hdr.Type == "" {
+		hdr.Type = JwtType
+	}
+
+	if opts.ContentType != "" {
+		hdr.ContentType = opts.ContentType
+	}
+
+	jws := &Jws{
+		Payload:    payload,
+		Signatures: []*JwsSignature{&JwsSignature{ProtectedHeader: hdr}},
+	}
+	if err := jws.Sign(key, opts.SignerOptions...); err != nil {
+		return "", err
+	}
+
+	compact, err := jws.MarshalCompact()
+	if err != nil {
+		return "", err
+	}
+
+	return string(compact), nil
+}
+
+// Parses and verifies a compact serialized JWT, following nested JWTs. The claims are not decoded.
+func parseJwtPayload(token string, ks KeySource, opts []SignerOption) (*Jwt, error) {
+	if ks == nil {
+		return nil, errors.New("A KeySource is required to verify a JWT")
+	}
+
+	jwt := new(Jwt)
+	token = strings.TrimSpace(token)
+
+	for depth := 0; ; depth++ {
+		if depth > jwtMaxNestingDepth {
+			return nil, fmt.Errorf("JWT is nested more than %d levels deep", jwtMaxNestingDepth)
+		}
+
+		if strings.Count(token, ".") != 2 {
+			return nil, errors.New("Invalid JWT. Only compact serialized JWS's with exactly 3 segments are supported")
+		}
+
+		jws := new(Jws)
+		if err := jws.UnmarshalCompact([]byte(token)); err != nil {
+			return nil, err
+		}
+		if err := jws.VerifyWithKeySource(ks, opts...); err != nil {
+			return nil, err
+		}
+
+		hdr := jws.Signatures[0].ProtectedHeader
+		if strings.EqualFold(hdr.ContentType, JwtContentType) {
+			jwt.Outer = append(jwt.Outer, hdr)
+			token = string(jws.Payload)
+			continue
+		}
+
+		jwt.Header = hdr
+		jwt.Payload = jws.Payload
+
+		return jwt, nil
+	}
+}
@@ -0,0 +1,120 @@
+package gose
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+var jwtTestVectors = []struct {
+	name    string
+	keyJson []byte
+	opts    *JwtSignOptions
+}{
+	{"HS256", jwaSignerTestVectors[0].signKeyJson, &JwtSignOptions{Algorithm: JwsAlgHS256, KeyId: "hmac"}},
+	{"ES256", jwaSignerTestVectors[1].signKeyJson, &JwtSignOptions{Algorithm: JwsAlgES256}},
+	{"RS256 with header", jwaSignerTestVectors[2].signKeyJson,
+		&JwtSignOptions{Algorithm: JwsAlgRS256, Header: &JwHeader{AdditionalMembers: map[string]interface{}{"b": "c"}}}},
+}
+
+func TestJwtSignAndParse(t *testing.T) {
+	claims := &ClaimSet{
+		Issuer:           "joe",
+		Subject:          "alice",
+		Expiration:       time.Unix(1300819380, 0),
+		AdditionalClaims: map[string]interface{}{"http://example.com/is_root": true},
+	}
+
+	for i, v := range jwtTestVectors {
+		key := new(Jwk)
+		if err := json.Unmarshal(v.keyJson, key); err != nil {
+			t.Fatalf("Unable to unmarshal key %d. Err: %v\n", i+1, err)
+		}
+
+		token, err := SignJwt(claims, key, v.opts)
+		if err != nil {
+			t.Errorf("Test %d (%s). Unable to sign jwt. Err: %v\n", i+1, v.name, err)
+			continue
+		}
+
+		validated := false
+		jwt, err := ParseJwt(token, key, ClaimValidatorFunc(func(c *ClaimSet) error {
+			validated = true
+			return nil
+		}))
+		if err != nil {
+			t.Errorf("Test %d (%s). Unable to parse jwt. Err: %v\n", i+1, v.name, err)
+			continue
+		}
+
+		if !validated {
+			t.Errorf("Test %d (%s). Validator was not called\n", i+1, v.name)
+		}
+		if jwt.Header.Type != JwtType || jwt.Header.KeyId != v.opts.KeyId {
+			t.Errorf("Test %d (%s). Unexpected header: %+v\n", i+1, v.name, jwt.Header)
+		}
+		if jwt.Claims.Issuer != claims.Issuer || !jwt.Claims.Expiration.Equal(claims.Expiration) {
+			t.Errorf("Test %d (%s). Claims don't match. Got: %+v\n", i+1, v.name, jwt.Claims)
+		}
+	}
+}
+
+func TestJwtParseErrors(t *testing.T) {
+	key := new(Jwk)
+	json.Unmarshal(jwaSignerTestVectors[0].signKeyJson, key)
+	otherKey := &Jwk{Type: KeyTypeOct, KeyValue: []byte("another key")}
+
+	token, err := SignJwt(&ClaimSet{Issuer: "joe"}, key, &JwtSignOptions{Algorithm: JwsAlgHS256})
+	if err != nil {
+		t.Fatalf("Unable to sign jwt. Err: %v\n", err)
+	}
+	parts := strings.Split(token, ".")
+
+	vectors := []struct {
+		name      string
+		token     string
+		ks        KeySource
+		validator ClaimValidator
+	}{
+		{"Wrong key", token, otherKey, nil},
+		{"Unsecured", "eyJhbGciOiJub25lIn0." + parts[1] + ".", key, nil},
+		{"Tampered payload", parts[0] + ".eyJpc3MiOiJldmUifQ." + parts[2], key, nil},
+		{"Key algorithm mismatch", token, &Jwk{Type: KeyTypeOct, KeyValue: key.KeyValue, Algorithm: JwsAlgHS512}, nil},
+		{"Encrypted", "a.b.c.d.e", key, nil},
+		{"Invalid claims", token, key, ClaimValidatorFunc(func(c *ClaimSet) error { return errors.New("invalid") })},
+	}
+
+	for i, v := range vectors {
+		if _, err := ParseAndVerifyJwt(v.token, v.ks, v.validator); err == nil {
+			t.Errorf("Test %d (%s). Parsing was expected to fail\n", i+1, v.name)
+		}
+	}
+}
+
+func TestJwtNested(t *testing.T) {
+	key := new(Jwk)
+	json.Unmarshal(jwaSignerTestVectors[0].signKeyJson, key)
+
+	inner, err := SignJwt(&ClaimSet{Issuer: "joe"}, key, &JwtSignOptions{Algorithm: JwsAlgHS256})
+	if err != nil {
+		t.Fatalf("Unable to sign inner jwt. Err: %v\n", err)
+	}
+	outer, err := SignNestedJwt(inner, key, &JwtSignOptions{Algorithm: JwsAlgHS512})
+	if err != nil {
+		t.Fatalf("Unable to sign outer jwt. Err: %v\n", err)
+	}
+
+	jwt, err := ParseJwt(outer, key, nil)
+	if err != nil {
+		t.Fatalf("Unable to parse nested jwt. Err: %v\n", err)
+	}
+
+	if len(jwt.Outer) != 1 || jwt.Outer[0].ContentType != JwtContentType || jwt.Outer[0].Algorithm != JwsAlgHS512 {
+		t.Errorf("Unexpected outer headers: %+v\n", jwt.Outer)
+	}
+	if jwt.Header.Algorithm != JwsAlgHS256 || jwt.Claims.Issuer != "joe" {
+		t.Errorf("Unexpected inner jwt. Header: %+v Claims: %+v\n", jwt.Header, jwt.Claims)
+	}
+}
@@ -0,0 +1,139 @@
+package gose
+
+import (
+	"errors"
+	"fmt"
+)
+
+// KeySource resolves the key used to verify a JWS (or decrypt a JWE) from the object's header. Implementations
+// include a single *Jwk, a *JwkSet and an *EmbeddedKeyPolicy.
+type KeySource interface {
+	ResolveKey(hdr *JwHeader) (*Jwk, error)
+}
+
+// KeySourceFunc is an adapter to allow the use of an ordinary function as a KeySource
+type KeySourceFunc func(hdr *JwHeader) (*Jwk, error)
+
+func (f KeySourceFunc) ResolveKey(hdr *JwHeader) (*Jwk, error) {
+	return f(hdr)
+}
+
+// ResolveKey implements the KeySource interface. The JWK is returned regardless of the header.
+func (jwk *Jwk) ResolveKey(hdr *JwHeader) (*Jwk, error) {
+	return jwk, nil
+}
+
+// ResolveKey implements the KeySource interface. The key is selected by the header's key id (kid) and the key type
+// of its algorithm (alg). If the header has no kid, the set must contain exactly one key of the algorithm's type.
+func (jwks *JwkSet) ResolveKey(hdr *JwHeader) (*Jwk, error) {
+	kty := GetKeyType(hdr.Algorithm)
+
+	if hdr.KeyId != "" {
+		var jwk *Jwk
+		if kty != "" {
+			jwk = jwks.GetKeyByIdAndType(hdr.KeyId, kty)
+		} else {
+			jwk = jwks.GetKeyById(hdr.KeyId)
+		}
+		if jwk == nil {
+			return nil, fmt.Errorf("No key found in JWK Set with key id (kid): %s", hdr.KeyId)
+		}
+		return jwk, nil
+	}
+
+	var found *Jwk
+	for _, v := range jwks.Keys {
+		if kty != "" && v.Type != kty {
+			continue
+		}
+		if found != nil {
+			return nil, errors.New("Header has no key id (kid) and the JWK Set contains more than one candidate key")
+		}
+		found = v
+	}
+	if found == nil {
+		return nil, errors.New("No key found in JWK Set for the header's algorithm")
+	}
+
+	return found, nil
+}
+
+// VerifyWithKeySource verifies a JWS that has a single signature using the key resolved by ks. Unlike Verify, an
+// unsecured (alg=none) or unsigned JWS is rejected.
+func (jws *Jws) VerifyWithKeySource(ks KeySource, opts ...SignerOption) error {
+	if len(jws.Signatures) > 1 {
+		return errors.New("More than one signature structure found.")
+	} else if len(jws.Signatures) < 1 {
+		return errors.New("The JWS must have at least one signature")
+	}
+
+	jSig := jws.Signatures[0]
+	sigAlg, err := jSig.GetAlg()
+	if err != nil {
+		return err
+	} else if sigAlg == JwsAlgNone {
+		return errors.New("Unsecured JWS (alg=none) is not accepted")
+	}
+
+	jwk, err := ks.ResolveKey(jSig.keyHeader())
+	if err != nil {
+		return err
+	} else if jwk == nil {
+		return errors.New("No key was resolved to verify the JWS")
+	} else if jwk.Algorithm != "" && jwk.Algorithm != sigAlg {
+		return fmt.Errorf("Key algorithm (%s) doesn't match the JWS algorithm (%s)", jwk.Algorithm, sigAlg)
+	} else if err := checkKeyType(jwk, sigAlg); err != nil {
+		return err
+	}
+
+	return jSig.Verify(jws, jwk, opts...)
+}
+
+// Returns an error if the key's type (kty) doesn't match the key type of the JWS algorithm. The algorithm is taken
+// from the (untrusted) header, so the check must be made before the key is given to the algorithm's signer.
+func checkKeyType(jwk *Jwk, sigAlg string) error {
+	if kty := GetKeyType(sigAlg); kty != "" && jwk.Type != kty {
+		return fmt.Errorf("Key type (kty=%s) doesn't match the JWS algorithm (%s)", jwk.Type, sigAlg)
+	}
+	return nil
+}
+
+// Returns the header used to resolve the signature's key. This is the protected header, with the algorithm and key id
+// filled in from the unprotected header if they are only present there. Other unprotected parameters (e.g. jwk, x5c)
+// are not integrity protected and are ignored.
+func (jSig *JwsSignature) keyHeader() *JwHeader {
+	hdr := new(JwHeader)
+	if jSig.ProtectedHeader != nil {
+		*hdr = *jSig.ProtectedHeader
+	}
+
+	if alg, err := jSig.GetAlg(); err == nil {
+		hdr.Algorithm = alg
+	}
+	if hdr.KeyId == "" && jSig.UnprotectedHeader != nil {
+		hdr.KeyId = jSig.UnprotectedHeader.KeyId
+	}
+
+	return hdr
+}
+
+// DecryptWithKeySource decrypts a JWE that has a single recipient using the key resolved by ks from its protected
+// header. ks must resolve the recipient's private keys, e.g. a *JwkSet; a KeyUrlResolver only supplies public keys and
+// rejects JWE headers.
+func (jwe *Jwe) DecryptWithKeySource(ks KeySource) error {
+	if jwe.ProtectedHeader == nil {
+		return errors.New("The JWE must have a protected header")
+	}
+
+	alg := jwe.ProtectedHeader.Algorithm
+	jwk, err := ks.ResolveKey(jwe.ProtectedHeader)
+	if err != nil {
+		return err
+	} else if jwk == nil {
+		return errors.New("No key was resolved to decrypt the JWE")
+	} else if jwk.Algorithm != "" && jwk.Algorithm != alg {
+		return fmt.Errorf("Key algorithm (%s) doesn't match the JWE algorithm (%s)", jwk.Algorithm, alg)
+	}
+
+	return jwe.Decrypt(jwk)
+}
@@ -0,0 +1,255 @@
+package gose
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Defaults used by KeyUrlResolver when the corresponding field is not set
+const (
+	defaultKeyUrlCacheTTL           = 5 * time.Minute
+	defaultKeyUrlMinRefresh         = 30 * time.Second
+	defaultKeyUrlMaxCacheEntries    = 100
+	defaultKeyUrlMaxResponseSize    = 1 << 20
+	defaultKeyUrlHttpRequestTimeout = 10 * time.Second
+)
+
+// KeyUrlResolver is a KeySource that fetches the key referenced by a header's "jku" (JWK Set URL) or "x5u" (X.509
+// URL) parameter over HTTPS. It is opt-in: only URLs whose host is in AllowedHosts, or which are listed in
+// AllowedUrls, are ever fetched, so a token can't make the resolver follow a URL that it introduced itself.
+// Redirects are only followed to allowlisted URLs.
+//
+// Only public keys are taken from fetched documents, so the resolver can only supply keys to verify signatures (e.g.
+// with Jws.VerifyWithKeySource). It rejects JWE headers: a key to decrypt a JWE is the recipient's own private key,
+// which must come from local configuration, never from a URL in the JWE's header.
+//
+// Fetched JWK Sets and certificate chains are cached for CacheTTL. If a key id isn't found in a cached JWK Set, the
+// set is fetched again (at most once every MinRefreshInterval) to pick up rotated keys.
+type KeyUrlResolver struct {
+	// AllowedHosts are the hosts (host or host:port, case-insensitive) keys may be fetched from
+	AllowedHosts []string
+	// AllowedUrls are individual URLs keys may be fetched from
+	AllowedUrls []string
+	// X5uPolicy validates certificate chains fetched from x5u URLs. If nil, x5u is not accepted.
+	X5uPolicy *EmbeddedKeyPolicy
+	// Client is the HTTP client used for requests. If nil, a client with a 10 second timeout is used.
+	Client *http.Client
+	// CacheTTL is how long fetched keys are cached. Defaults to 5 minutes.
+	CacheTTL time.Duration
+	// MinRefreshInterval is the minimum time between fetches of the same URL. Defaults to 30 seconds.
+	MinRefreshInterval time.Duration
+	// MaxCacheEntries is the maximum number of cached URLs. Defaults to 100.
+	MaxCacheEntries int
+	// MaxResponseSize is the maximum size of a fetched document in bytes. Defaults to 1 MiB.
+	MaxResponseSize int64
+
+	cache ttlCache
+}
+
+type keyUrlCacheEntry struct {
+	jwks  *JwkSet
+	certs []*x509.Certificate
+}
+
+// NewKeyUrlResolver returns a KeyUrlResolver that fetches keys from the allowed hosts
+func NewKeyUrlResolver(allowedHosts ...string) *KeyUrlResolver {
+	return &KeyUrlResolver{AllowedHosts: allowedHosts}
+}
+
+// ResolveKey implements the KeySource interface. If the header has a jku, the key is selected from the fetched JWK
+// Set by key id and algorithm. Otherwise, if the header has an x5u, the fetched certificate chain is validated
+// against X5uPolicy and the leaf certificate's key is returned.
+func (r *KeyUrlResolver) ResolveKey(hdr *JwHeader) (*Jwk, error) {
+	switch {
+	case hdr.EncryptionAlg != "":
+		return nil, errors.New("Key URLs can only be used to verify signatures, not to decrypt a JWE")
+	case hdr.JwkUrl != "":
+		return r.resolveJku(hdr)
+	case hdr.X509Url != "":
+		return r.resolveX5u(hdr)
+	default:
+		return nil, errors.New("Header has no key URL (jku or x5u)")
+	}
+}
+
+// JwkSet returns the JWK Set at the URL, fetching it if it isn't cached
+func (r *KeyUrlResolver) JwkSet(u string) (*JwkSet, error) {
+	entry, err := r.get(u, false, r.fetchJwkSet)
+	if err != nil {
+		return nil, err
+	}
+	return entry.jwks, nil
+}
+
+// X509Chain returns the PEM encoded certificate chain at the URL, fetching it if it isn't cached. The chain is not
+// validated.
+func (r *KeyUrlResolver) X509Chain(u string) ([]*x509.Certificate, error) {
+	entry, err := r.get(u, false, r.fetchX509Chain)
+	if err != nil {
+		return nil, err
+	}
+	return entry.certs, nil
+}
+
+func (r *KeyUrlResolver) resolveJku(hdr *JwHeader) (*Jwk, error) {
+	entry, err := r.get(hdr.JwkUrl, false, r.fetchJwkSet)
+	if err != nil {
+		return nil, err
+	}
+
+	jwk, err := entry.jwks.ResolveKey(hdr)
+	if err != nil {
+		// The key may have been rotated since the set was cached
+		if entry, err = r.get(hdr.JwkUrl, true, r.fetchJwkSet); err != nil {
+			return nil, err
+		}
+		if jwk, err = entry.jwks.ResolveKey(hdr); err != nil {
+			return nil, err
+		}
+	}
+
+	return jwk, nil
+}
+
+func (r *KeyUrlResolver) resolveX5u(hdr *JwHeader) (*Jwk, error) {
+	if r.X5uPolicy == nil || r.X5uPolicy.Roots == nil {
+		return nil, errors.New("x5u certificate chains are not accepted by the resolver")
+	}
+
+	certs, err := r.X509Chain(hdr.X509Url)
+	if err != nil {
+		return nil, err
+	}
+
+	leaf, err := r.X5uPolicy.verifyChain(certs)
+	if err != nil {
+		return nil, err
+	}
+
+	jwk := new(Jwk)
+	if err := jwk.ImportKey(leaf.PublicKey); err != nil {
+		return nil, err
+	}
+	if kty := GetKeyType(hdr.Algorithm); kty != jwk.Type {
+		return nil, fmt.Errorf("x5u key type (kty=%v) doesn't match the algorithm key type (%v)", jwk.Type, kty)
+	}
+
+	return jwk, nil
+}
+
+// Returns the cache entry for the URL, fetching it if it is missing or expired. If refresh is set, the entry is
+// fetched again unless it was fetched less than MinRefreshInterval ago.
+func (r *KeyUrlResolver) get(u string, refresh bool,
+	fetch func(body []byte) (*keyUrlCacheEntry, error)) (*keyUrlCacheEntry, error) {
+
+	f := r.fetcher()
+	if err := f.checkAllowed(u); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	if cached := r.cache.get(u); cached != nil {
+		age := now.Sub(cached.stored)
+		if (!refresh && age < r.cacheTTL()) || (refresh && age < r.minRefresh()) {
+			return cached.value.(*keyUrlCacheEntry), nil
+		}
+	}
+
+	body, err := f.fetch(u, "")
+	if err != nil {
+		return nil, err
+	}
+	entry, err := fetch(body)
+	if err != nil {
+		return nil, err
+	}
+
+	maxEntries := r.MaxCacheEntries
+	if maxEntries < 1 {
+		maxEntries = defaultKeyUrlMaxCacheEntries
+	}
+	r.cache.put(u, entry, now, now.Add(r.cacheTTL()), maxEntries)
+
+	return entry, nil
+}
+
+// Returns the fetcher for the resolver's allowlist
+func (r *KeyUrlResolver) fetcher() *httpsFetcher {
+	maxSize := r.MaxResponseSize
+	if maxSize < 1 {
+		maxSize = defaultKeyUrlMaxResponseSize
+	}
+
+	return &httpsFetcher{
+		name:    "Key URL",
+		hosts:   r.AllowedHosts,
+		urls:    r.AllowedUrls,
+		client:  r.Client,
+		timeout: defaultKeyUrlHttpRequestTimeout,
+		maxSize: maxSize,
+	}
+}
+
+func (r *KeyUrlResolver) fetchJwkSet(body []byte) (*keyUrlCacheEntry, error) {
+	jwks := new(JwkSet)
+	if err := json.Unmarshal(body, jwks); err != nil {
+		return nil, err
+	}
+
+	// Only public keys are accepted from a URL
+	keys := make([]*Jwk, 0, len(jwks.Keys))
+	for _, v := range jwks.Keys {
+		if pub := v.Public(); pub != nil {
+			keys = append(keys, pub)
+		}
+	}
+	jwks.Keys = keys
+
+	return &keyUrlCacheEntry{jwks: jwks}, nil
+}
+
+func (r *KeyUrlResolver) fetchX509Chain(body []byte) (*keyUrlCacheEntry, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, body = pem.Decode(body)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+
+	if len(certs) < 1 {
+		return nil, errors.New("No PEM encoded certificates found at x5u")
+	}
+
+	return &keyUrlCacheEntry{certs: certs}, nil
+}
+
+func (r *KeyUrlResolver) cacheTTL() time.Duration {
+	if r.CacheTTL > 0 {
+		return r.CacheTTL
+	}
+	return defaultKeyUrlCacheTTL
+}
+
+func (r *KeyUrlResolver) minRefresh() time.Duration {
+	if r.MinRefreshInterval > 0 {
+		return r.MinRefreshInterval
+	}
+	return defaultKeyUrlMinRefresh
+}
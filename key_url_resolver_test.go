@@ -0,0 +1,125 @@
+package gose
+
+import (
+	"crypto/ecdsa"
+	ec "crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestKeyUrlResolverJku(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(ec.P256(), rand.Reader)
+	signKey := new(Jwk)
+	signKey.ImportKey(key)
+	signKey.Id = "key-1"
+
+	jwksJson, err := json.Marshal(&JwkSet{Keys: []*Jwk{signKey.Public()}})
+	if err != nil {
+		t.Fatalf("Unable to marshal JWK Set. Err: %v\n", err)
+	}
+
+	var fetches int32
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/jwks.json":
+			atomic.AddInt32(&fetches, 1)
+			w.Write(jwksJson)
+		case "/redirect":
+			http.Redirect(w, r, "https://evil.example.com/jwks.json", http.StatusFound)
+		case "/large":
+			w.Write([]byte(strings.Repeat(" ", 2048)))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	host := strings.TrimPrefix(srv.URL, "https://")
+	resolver := NewKeyUrlResolver(host)
+	resolver.Client = srv.Client()
+	resolver.MaxResponseSize = 1024
+
+	vectors := []struct {
+		name  string
+		hdr   *JwHeader
+		valid bool
+	}{
+		{"Allowlisted jku", &JwHeader{Algorithm: JwsAlgES256, KeyId: "key-1", JwkUrl: srv.URL + "/jwks.json"}, true},
+		{"Cached jku", &JwHeader{Algorithm: JwsAlgES256, KeyId: "key-1", JwkUrl: srv.URL + "/jwks.json"}, true},
+		{"Unknown kid", &JwHeader{Algorithm: JwsAlgES256, KeyId: "key-2", JwkUrl: srv.URL + "/jwks.json"}, false},
+		{"Not allowlisted", &JwHeader{Algorithm: JwsAlgES256, KeyId: "key-1", JwkUrl: "https://evil.example.com/jwks.json"}, false},
+		{"Not https", &JwHeader{Algorithm: JwsAlgES256, KeyId: "key-1", JwkUrl: "http://" + host + "/jwks.json"}, false},
+		{"Redirect", &JwHeader{Algorithm: JwsAlgES256, KeyId: "key-1", JwkUrl: srv.URL + "/redirect"}, false},
+		{"Too large", &JwHeader{Algorithm: JwsAlgES256, KeyId: "key-1", JwkUrl: srv.URL + "/large"}, false},
+		{"No key URL", &JwHeader{Algorithm: JwsAlgES256, KeyId: "key-1"}, false},
+	}
+
+	for i, v := range vectors {
+		jws := signTestJws(t, v.hdr, signKey)
+
+		err := jws.VerifyWithKeySource(resolver)
+		if v.valid && err != nil {
+			t.Errorf("Test %d (%s). Unable to verify. Err: %v\n", i+1, v.name, err)
+		} else if !v.valid && err == nil {
+			t.Errorf("Test %d (%s). Verification was expected to fail\n", i+1, v.name)
+		}
+	}
+
+	// Only public keys are fetched, so a key URL can't supply a key to decrypt a JWE
+	hdr := &JwHeader{Algorithm: JweAlgRSA_OAEP_256, EncryptionAlg: JweEncAlgA256GCM, JwkUrl: srv.URL + "/jwks.json"}
+	if _, err := resolver.ResolveKey(hdr); err == nil {
+		t.Errorf("A key to decrypt a JWE was resolved from a key URL\n")
+	}
+
+	// The JWK Set is cached, and the unknown key id doesn't trigger a refetch within MinRefreshInterval
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Errorf("Expected the JWK Set to be fetched once. Got: %d\n", n)
+	}
+}
+
+func TestKeyUrlResolverX5u(t *testing.T) {
+	caKey, _ := ecdsa.GenerateKey(ec.P256(), rand.Reader)
+	ca := createTestCert(t, "Test CA", caKey, nil, nil, true, x509.KeyUsageCertSign)
+	leafKey, _ := ecdsa.GenerateKey(ec.P256(), rand.Reader)
+	leaf := createTestCert(t, "Signer", leafKey, ca, caKey, false, x509.KeyUsageDigitalSignature)
+
+	signKey := new(Jwk)
+	signKey.ImportKey(leafKey)
+
+	chainPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Raw})
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(chainPem)
+	}))
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	resolver := &KeyUrlResolver{AllowedUrls: []string{srv.URL + "/chain.pem"}, Client: srv.Client()}
+	jws := signTestJws(t, &JwHeader{Algorithm: JwsAlgES256, X509Url: srv.URL + "/chain.pem"}, signKey)
+
+	// No x5u policy configured
+	if err := jws.VerifyWithKeySource(resolver); err == nil {
+		t.Errorf("x5u was accepted without a policy\n")
+	}
+
+	resolver.X5uPolicy = &EmbeddedKeyPolicy{Roots: roots}
+	if err := jws.VerifyWithKeySource(resolver); err != nil {
+		t.Errorf("Unable to verify jws with x5u. Err: %v\n", err)
+	}
+
+	// Only the exact URL is allowlisted, not the host
+	other := signTestJws(t, &JwHeader{Algorithm: JwsAlgES256, X509Url: "https://" + u.Host + "/other.pem"}, signKey)
+	if err := other.VerifyWithKeySource(resolver); err == nil {
+		t.Errorf("x5u was fetched from a URL that isn't allowlisted\n")
+	}
+}
@@ -0,0 +1,78 @@
+package gose
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+)
+
+// CertificateThumbprint returns the base64url encoded SHA-256 thumbprint of the DER encoded certificate, as used by
+// the x5t#S256 confirmation method of https://tools.ietf.org/html/rfc8705#section-3.1
+func CertificateThumbprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	b64 := &Base64UrlOctets{Octets: sum[:]}
+	return b64.Encoded()
+}
+
+// ClientCertificateThumbprint returns the x5t#S256 thumbprint of the client certificate of a mutual TLS connection
+func ClientCertificateThumbprint(state *tls.ConnectionState) (string, error) {
+	if state == nil || len(state.PeerCertificates) < 1 {
+		return "", errors.New("Connection has no client certificate")
+	}
+
+	return CertificateThumbprint(state.PeerCertificates[0]), nil
+}
+
+// BindCertificate binds the claim set (e.g. an access token being issued) to the client certificate of the mutual
+// TLS connection, by adding its thumbprint to the confirmation (cnf) claim
+func BindCertificate(c *ClaimSet, state *tls.ConnectionState) error {
+	tp, err := ClientCertificateThumbprint(state)
+	if err != nil {
+		return err
+	}
+
+	cnf, err := c.Confirmation()
+	if err != nil {
+		return err
+	} else if cnf == nil {
+		cnf = new(Confirmation)
+	}
+	cnf.X5tS256 = tp
+
+	return c.SetConfirmation(cnf)
+}
+
+// VerifyCertificateBinding checks that a certificate-bound claim set (e.g. a presented access token) is bound to the
+// client certificate of the mutual TLS connection it was presented over
+func VerifyCertificateBinding(c *ClaimSet, state *tls.ConnectionState) error {
+	if state == nil || len(state.PeerCertificates) < 1 {
+		return errors.New("Connection has no client certificate")
+	}
+
+	cnf, err := c.Confirmation()
+	if err != nil {
+		return err
+	} else if cnf == nil {
+		return errors.New("Claim set has no confirmation (cnf) claim")
+	}
+
+	return cnf.VerifyCertificate(state.PeerCertificates[0])
+}
+
+// VerifyCertificate checks that the certificate matches the confirmation's certificate thumbprint (x5t#S256). It can
+// be used directly when mutual TLS is terminated elsewhere and the client certificate is forwarded.
+func (cnf *Confirmation) VerifyCertificate(cert *x509.Certificate) error {
+	if cnf.X5tS256 == "" {
+		return errors.New("Confirmation has no certificate thumbprint (x5t#S256)")
+	} else if cert == nil {
+		return errors.New("No client certificate was presented")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(cnf.X5tS256), []byte(CertificateThumbprint(cert))) != 1 {
+		return errors.New("Client certificate doesn't match the confirmation thumbprint (cnf.x5t#S256)")
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package gose
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCertificateThumbprint(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	cert := createTestCert(t, "client", key, nil, nil, false, x509.KeyUsageDigitalSignature)
+
+	sum := sha256.Sum256(cert.Raw)
+	if tp := CertificateThumbprint(cert); tp != base64.RawURLEncoding.EncodeToString(sum[:]) {
+		t.Errorf("Unexpected thumbprint: %s\n", tp)
+	}
+
+	if _, err := ClientCertificateThumbprint(&tls.ConnectionState{}); err == nil {
+		t.Errorf("Thumbprint was computed without a client certificate\n")
+	}
+}
+
+func TestCertificateBinding(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	cert := createTestCert(t, "client", key, nil, nil, false, x509.KeyUsageDigitalSignature)
+	other := createTestCert(t, "other", key, nil, nil, false, x509.KeyUsageDigitalSignature)
+	jkt := "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"
+
+	c := new(ClaimSet)
+	c.SetConfirmation(&Confirmation{Jkt: jkt})
+	if err := BindCertificate(c, &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}); err != nil {
+		t.Fatalf("Unable to bind certificate. Err: %v\n", err)
+	}
+
+	cnf, _ := c.Confirmation()
+	if cnf.Jkt != jkt || cnf.X5tS256 != CertificateThumbprint(cert) {
+		t.Errorf("Unexpected confirmation: %+v\n", cnf)
+	}
+
+	vectors := []struct {
+		name  string
+		state *tls.ConnectionState
+		ok    bool
+	}{
+		{"Bound certificate", &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}, true},
+		{"Other certificate", &tls.ConnectionState{PeerCertificates: []*x509.Certificate{other}}, false},
+		{"No certificate", &tls.ConnectionState{}, false},
+		{"No connection state", nil, false},
+	}
+
+	for i, v := range vectors {
+		if err := VerifyCertificateBinding(c, v.state); (err == nil) != v.ok {
+			t.Errorf("Test %d (%s). Unexpected result. Err: %v\n", i+1, v.name, err)
+		}
+	}
+
+	if err := VerifyCertificateBinding(new(ClaimSet), vectors[0].state); err == nil {
+		t.Errorf("Claim set without confirmation was accepted\n")
+	}
+}
+
+func TestCertificateBindingOverMutualTls(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	cert := createTestCert(t, "client", key, nil, nil, false, x509.KeyUsageDigitalSignature)
+
+	var bindErr, verifyErr error
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := &ClaimSet{Subject: "client"}
+		bindErr = BindCertificate(c, r.TLS)
+		verifyErr = VerifyCertificateBinding(c, r.TLS)
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	srv.StartTLS()
+	defer srv.Close()
+
+	client := srv.Client()
+	client.Transport.(*http.Transport).TLSClientConfig.Certificates = []tls.Certificate{
+		{Certificate: [][]byte{cert.Raw}, PrivateKey: key},
+	}
+
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Request failed. Err: %v\n", err)
+	}
+	resp.Body.Close()
+
+	if bindErr != nil || verifyErr != nil {
+		t.Errorf("Unable to bind and verify certificate. Errs: %v, %v\n", bindErr, verifyErr)
+	}
+}
@@ -2,9 +2,14 @@ package gose
 
 import (
 	"encoding/json"
+	"fmt"
+	"math"
 	"time"
 )
 
+// Largest accepted NumericDate: 9999-12-31T23:59:59Z
+const maxNumericDate = 253402300799
+
 // NumericDate represents a date as a UTC Unix Timestamp as defined in:
 // https://tools.ietf.org/html/rfc7519#section-2
 type NumericDate struct {
@@ -30,15 +35,23 @@ func (nd *NumericDate) MarshalJSON() ([]byte, error) {
 	return json.Marshal(nd.Encoded())
 }
 
-// Implements the json.Unmarshaler interface and JSON decodes the Numeric Date
+// Implements the json.Unmarshaler interface and JSON decodes the Numeric Date. Both integer and fractional seconds are
+// accepted. Dates before 1970 or after 9999 are rejected. A JSON null leaves the date unchanged.
 func (nd *NumericDate) UnmarshalJSON(data []byte) error {
-	i := int64(0)
-	if err := json.Unmarshal(data, &i); err != nil {
-		return err
+	if string(data) == "null" {
+		return nil
+	}
+
+	var f float64
+	if err := json.Unmarshal(data, &f); err != nil {
+		return fmt.Errorf("NumericDate must be a JSON number, got: %s", data)
 	}
-	if err := nd.Decode(i); err != nil {
-		return err
+	if f < 0 || f > maxNumericDate {
+		return fmt.Errorf("NumericDate (%s) is out of range", data)
 	}
 
+	sec, frac := math.Modf(f)
+	nd.Time = time.Unix(int64(sec), int64(math.Round(frac*1e9)))
+
 	return nil
 }
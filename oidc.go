@@ -0,0 +1,211 @@
+package gose
+
+import (
+	"crypto"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ID Token claim names as specified in https://openid.net/specs/openid-connect-core-1_0.html#IDToken
+const (
+	ClaimNonce           string = "nonce"
+	ClaimAuthorizedParty string = "azp"
+	ClaimAuthTime        string = "auth_time"
+	ClaimAccessTokenHash string = "at_hash"
+	ClaimCodeHash        string = "c_hash"
+)
+
+// IdTokenValidator validates an OpenID Connect ID Token as specified in
+// https://openid.net/specs/openid-connect-core-1_0.html#IDTokenValidation. Issuers must be set to the
+// expected issuer. It implements the ClaimValidator interface, but at_hash and c_hash can only be checked by
+// ParseIdToken, because they depend on the JWS algorithm.
+type IdTokenValidator struct {
+	Validator
+	// ClientId is the client's id. It must be one of the audiences, and the authorized party (azp) if present.
+	ClientId string
+	// Nonce is the nonce sent in the authentication request. If set, the nonce claim must match it.
+	Nonce string
+	// MaxAuthAge is the max_age sent in the authentication request. If set, auth_time is required and the end-user
+	// must have authenticated within MaxAuthAge (plus Leeway).
+	MaxAuthAge time.Duration
+	// RequireAuthTime requires the auth_time claim, e.g. when it was requested as an essential claim
+	RequireAuthTime bool
+	// AccessToken is the access token issued with the ID Token. If set, at_hash is checked when present.
+	AccessToken string
+	// RequireAccessTokenHash requires at_hash, e.g. for the implicit flow (response_type "id_token token")
+	RequireAccessTokenHash bool
+	// Code is the authorization code issued with the ID Token. If set, c_hash is checked when present.
+	Code string
+	// RequireCodeHash requires c_hash, e.g. for ID Tokens returned from the authorization endpoint in the hybrid flow
+	RequireCodeHash bool
+}
+
+// ValidateClaims validates the registered claims, nonce, azp and auth_time, returning ClaimErrors or nil
+func (v *IdTokenValidator) ValidateClaims(c *ClaimSet) error {
+	errs := v.Validator.validate(c)
+
+	if c.Issuer == "" {
+		errs = append(errs, &ClaimError{ClaimIssuer, errors.New("Required claim is missing")})
+	}
+	if c.Subject == "" {
+		errs = append(errs, &ClaimError{ClaimSubject, errors.New("Required claim is missing")})
+	}
+	if c.Expiration.IsZero() {
+		errs = append(errs, &ClaimError{ClaimExpiration, errors.New("Required claim is missing")})
+	}
+	if c.IssuedAt.IsZero() {
+		errs = append(errs, &ClaimError{ClaimIssuedAt, errors.New("Required claim is missing")})
+	}
+
+	if v.ClientId == "" {
+		return errors.New("IdTokenValidator requires the client id")
+	} else if !containsString(c.Audience, v.ClientId) {
+		errs = append(errs, &ClaimError{ClaimAudience, fmt.Errorf("Audiences (%v) don't contain the client id", c.Audience)})
+	}
+
+	azp, ok, err := c.stringClaim(ClaimAuthorizedParty)
+	if err != nil {
+		errs = append(errs, &ClaimError{ClaimAuthorizedParty, err})
+	} else if !ok && len(c.Audience) > 1 {
+		errs = append(errs, &ClaimError{ClaimAuthorizedParty, errors.New("Authorized party is required when there are multiple audiences")})
+	} else if ok && azp != v.ClientId {
+		errs = append(errs, &ClaimError{ClaimAuthorizedParty, fmt.Errorf("Authorized party (%s) is not the client id", azp)})
+	}
+
+	if v.Nonce != "" {
+		nonce, ok, err := c.stringClaim(ClaimNonce)
+		if err != nil {
+			errs = append(errs, &ClaimError{ClaimNonce, err})
+		} else if !ok {
+			errs = append(errs, &ClaimError{ClaimNonce, errors.New("Required claim is missing")})
+		} else if nonce != v.Nonce {
+			errs = append(errs, &ClaimError{ClaimNonce, errors.New("Nonce doesn't match the authentication request")})
+		}
+	}
+
+	authTime, ok, err := c.timeClaim(ClaimAuthTime)
+	if err != nil {
+		errs = append(errs, &ClaimError{ClaimAuthTime, err})
+	} else if !ok && (v.RequireAuthTime || v.MaxAuthAge > 0) {
+		errs = append(errs, &ClaimError{ClaimAuthTime, errors.New("Required claim is missing")})
+	} else if ok && v.MaxAuthAge > 0 && v.now().Sub(authTime) > v.MaxAuthAge+v.Leeway {
+		errs = append(errs, &ClaimError{ClaimAuthTime, fmt.Errorf("End-user authenticated more than max_age (%v) ago", v.MaxAuthAge)})
+	}
+
+	return v.checkReplay(c, errs)
+}
+
+// ParseIdToken parses a compact serialized ID Token, verifies its signature with the key resolved by ks and validates
+// it with v, including the at_hash and c_hash claims.
+func ParseIdToken(token string, ks KeySource, v *IdTokenValidator, opts ...SignerOption) (*Jwt, error) {
+	if v == nil {
+		return nil, errors.New("An IdTokenValidator is required to validate an ID Token")
+	}
+
+	jwt, err := ParseJwt(token, ks, v, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs ClaimErrors
+	if err := v.validateHash(jwt, ClaimAccessTokenHash, v.AccessToken, v.RequireAccessTokenHash); err != nil {
+		errs = append(errs, &ClaimError{ClaimAccessTokenHash, err})
+	}
+	if err := v.validateHash(jwt, ClaimCodeHash, v.Code, v.RequireCodeHash); err != nil {
+		errs = append(errs, &ClaimError{ClaimCodeHash, err})
+	}
+	if err := errs.err(); err != nil {
+		return nil, err
+	}
+
+	return jwt, nil
+}
+
+// Checks an at_hash or c_hash claim against the value it was computed from
+func (v *IdTokenValidator) validateHash(jwt *Jwt, claim string, value string, required bool) error {
+	hash, ok, err := jwt.Claims.stringClaim(claim)
+	if err != nil {
+		return err
+	} else if !ok {
+		if required {
+			return errors.New("Required claim is missing")
+		}
+		return nil
+	}
+
+	if value == "" {
+		if required {
+			return errors.New("No value was provided to check the hash against")
+		}
+		return nil
+	}
+
+	expected, err := OidcTokenHash(jwt.Header.Algorithm, value)
+	if err != nil {
+		return err
+	} else if hash != expected {
+		return errors.New("Hash doesn't match")
+	}
+
+	return nil
+}
+
+// OidcTokenHash computes an at_hash or c_hash value: the base64url encoding of the left-most half of the hash of the
+// value, using the hash algorithm of the ID Token's JWS algorithm.
+func OidcTokenHash(jwsAlg string, value string) (string, error) {
+	if jwsAlg == JwsAlgNone {
+		return "", errors.New("Unsecured ID Tokens (alg=none) have no hash algorithm")
+	}
+
+	// The hash is the plain SHA-2 function matching the algorithm's bit length, also for HMAC algorithms
+	var hash crypto.Hash
+	switch {
+	case strings.HasSuffix(jwsAlg, "256"):
+		hash = crypto.SHA256
+	case strings.HasSuffix(jwsAlg, "384"):
+		hash = crypto.SHA384
+	case strings.HasSuffix(jwsAlg, "512"):
+		hash = crypto.SHA512
+	default:
+		return "", fmt.Errorf("JWS ALG: %s has no hash algorithm", jwsAlg)
+	}
+
+	h := hash.New()
+	h.Write([]byte(value))
+	sum := h.Sum(nil)
+
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2]), nil
+}
+
+// AddIdTokenHashes sets the at_hash and c_hash claims of an ID Token that will be signed with jwsAlg. The claims are
+// only set for a non-empty access token or code.
+func AddIdTokenHashes(c *ClaimSet, jwsAlg string, accessToken string, code string) error {
+	values := []struct {
+		claim string
+		value string
+	}{
+		{ClaimAccessTokenHash, accessToken},
+		{ClaimCodeHash, code},
+	}
+
+	for _, v := range values {
+		if v.value == "" {
+			continue
+		}
+		hash, err := OidcTokenHash(jwsAlg, v.value)
+		if err != nil {
+			return err
+		}
+		if c.AdditionalClaims == nil {
+			c.AdditionalClaims = make(map[string]interface{})
+		}
+		c.AdditionalClaims[v.claim] = hash
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package gose
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// Test vectors from https://openid.net/specs/openid-connect-core-1_0.html#code-id_tokenExample
+var oidcTokenHashTestVectors = []struct {
+	alg   string
+	value string
+	hash  string
+}{
+	{JwsAlgRS256, "jHkWEdUXMU1BwAsC4vtUsZwnNvTIxEl0z9K3vx5KF0Y", "77QmUPtjPfzWtF2AnpK9RQ"},
+	{JwsAlgRS256, "Qcb0Orv1zh30vL1MPRsbm-diHiMwcLyZvn1arpZv-Jxf_11jnpEX3Tgfvk", "LDktKdoQak3Pk0cnXxCltA"},
+	{JwsAlgHS256, "jHkWEdUXMU1BwAsC4vtUsZwnNvTIxEl0z9K3vx5KF0Y", "77QmUPtjPfzWtF2AnpK9RQ"},
+	{JwsAlgHS256, "Qcb0Orv1zh30vL1MPRsbm-diHiMwcLyZvn1arpZv-Jxf_11jnpEX3Tgfvk", "LDktKdoQak3Pk0cnXxCltA"},
+	{JwsAlgES384, "jHkWEdUXMU1BwAsC4vtUsZwnNvTIxEl0z9K3vx5KF0Y", ""},
+}
+
+func TestOidcTokenHash(t *testing.T) {
+	for i, v := range oidcTokenHashTestVectors {
+		hash, err := OidcTokenHash(v.alg, v.value)
+		if err != nil {
+			t.Errorf("Test %d. Unable to compute hash. Err: %v\n", i+1, err)
+		} else if v.hash != "" && hash != v.hash {
+			t.Errorf("Test %d. Expected: %s, Got: %s\n", i+1, v.hash, hash)
+		} else if v.alg == JwsAlgES384 && len(hash) != 32 {
+			t.Errorf("Test %d. Expected a 24 byte hash, Got: %s\n", i+1, hash)
+		}
+	}
+
+	if _, err := OidcTokenHash(JwsAlgNone, "a"); err == nil {
+		t.Errorf("Hash was computed for alg=none\n")
+	}
+}
+
+func TestParseIdToken(t *testing.T) {
+	key := new(Jwk)
+	if err := json.Unmarshal(jwaSignerTestVectors[2].signKeyJson, key); err != nil {
+		t.Fatalf("Unable to unmarshal key. Err: %v\n", err)
+	}
+
+	now := time.Unix(1311281970, 0)
+	baseValidator := IdTokenValidator{
+		Validator:   Validator{Clock: func() time.Time { return now }, Issuers: []string{"https://server.example.com"}},
+		ClientId:    "s6BhdRkqt3",
+		Nonce:       "n-0S6_WzA2Mj",
+		AccessToken: "access",
+		Code:        "code",
+	}
+
+	newClaims := func(f func(c *ClaimSet)) *ClaimSet {
+		c := &ClaimSet{
+			Issuer:     "https://server.example.com",
+			Subject:    "24400320",
+			Audience:   []string{"s6BhdRkqt3"},
+			Expiration: now.Add(time.Hour),
+			IssuedAt:   now,
+			AdditionalClaims: map[string]interface{}{
+				ClaimNonce:    "n-0S6_WzA2Mj",
+				ClaimAuthTime: now.Add(-time.Minute).Unix(),
+			},
+		}
+		if err := AddIdTokenHashes(c, JwsAlgRS256, "access", "code"); err != nil {
+			t.Fatalf("Unable to add hashes. Err: %v\n", err)
+		}
+		if f != nil {
+			f(c)
+		}
+		return c
+	}
+
+	vectors := []struct {
+		name   string
+		claims *ClaimSet
+		v      func(v *IdTokenValidator)
+		ok     bool
+	}{
+		{"Valid", newClaims(nil), nil, true},
+		{"Valid with max_age", newClaims(nil), func(v *IdTokenValidator) { v.MaxAuthAge = 2 * time.Minute }, true},
+		{"Wrong nonce", newClaims(func(c *ClaimSet) { c.AdditionalClaims[ClaimNonce] = "x" }), nil, false},
+		{"Missing nonce", newClaims(func(c *ClaimSet) { delete(c.AdditionalClaims, ClaimNonce) }), nil, false},
+		{"Wrong audience", newClaims(func(c *ClaimSet) { c.Audience = []string{"other"} }), nil, false},
+		{"Multiple audiences without azp", newClaims(func(c *ClaimSet) {
+			c.Audience = []string{"s6BhdRkqt3", "other"}
+		}), nil, false},
+		{"Multiple audiences with azp", newClaims(func(c *ClaimSet) {
+			c.Audience = []string{"s6BhdRkqt3", "other"}
+			c.AdditionalClaims[ClaimAuthorizedParty] = "s6BhdRkqt3"
+		}), nil, true},
+		{"Wrong azp", newClaims(func(c *ClaimSet) { c.AdditionalClaims[ClaimAuthorizedParty] = "other" }), nil, false},
+		{"auth_time too old", newClaims(nil), func(v *IdTokenValidator) { v.MaxAuthAge = 30 * time.Second }, false},
+		{"auth_time missing with max_age", newClaims(func(c *ClaimSet) { delete(c.AdditionalClaims, ClaimAuthTime) }),
+			func(v *IdTokenValidator) { v.MaxAuthAge = time.Hour }, false},
+		{"Wrong at_hash", newClaims(nil), func(v *IdTokenValidator) { v.AccessToken = "other" }, false},
+		{"Wrong c_hash", newClaims(nil), func(v *IdTokenValidator) { v.Code = "other" }, false},
+		{"Missing c_hash not required", newClaims(func(c *ClaimSet) { delete(c.AdditionalClaims, ClaimCodeHash) }),
+			nil, true},
+		{"Missing c_hash required", newClaims(func(c *ClaimSet) { delete(c.AdditionalClaims, ClaimCodeHash) }),
+			func(v *IdTokenValidator) { v.RequireCodeHash = true }, false},
+		{"Missing iat", newClaims(func(c *ClaimSet) { c.IssuedAt = time.Time{} }), nil, false},
+		{"Expired", newClaims(func(c *ClaimSet) { c.Expiration = now.Add(-time.Second) }), nil, false},
+	}
+
+	for i, v := range vectors {
+		token, err := SignJwt(v.claims, key, &JwtSignOptions{Algorithm: JwsAlgRS256})
+		if err != nil {
+			t.Fatalf("Test %d (%s). Unable to sign ID Token. Err: %v\n", i+1, v.name, err)
+		}
+
+		validator := baseValidator
+		if v.v != nil {
+			v.v(&validator)
+		}
+
+		_, err = ParseIdToken(token, key, &validator)
+		if (err == nil) != v.ok {
+			t.Errorf("Test %d (%s). Unexpected result. Err: %v\n", i+1, v.name, err)
+		}
+	}
+}
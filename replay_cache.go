@@ -0,0 +1,143 @@
+package gose
+
+import (
+	"container/heap"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// Defaults used by MemoryReplayCache when the corresponding field is not set
+const (
+	defaultReplayCacheMaxEntries = 100000
+	replayCacheShards            = 16
+)
+
+// ReplayCache records the ids of one-time tokens (e.g. the jti of a client assertion) to detect replays. An id only
+// needs to be recorded until the token expires (plus any leeway), as an expired token is rejected anyway.
+type ReplayCache interface {
+	// Add records the id until it expires. It returns false if the id is already recorded and hasn't expired.
+	Add(id string, expires time.Time) (bool, error)
+}
+
+// MemoryReplayCache is an in-memory ReplayCache. Ids are spread over shards, each with its own lock, to reduce
+// contention. Memory is bounded by MaxEntries: expired ids are evicted first, and if the cache is still full the ids
+// closest to expiring are evicted. Evicting an unexpired id allows that token to be replayed, so MaxEntries should
+// be sized for the expected number of live tokens.
+type MemoryReplayCache struct {
+	// MaxEntries is the maximum number of recorded ids. Defaults to 100000.
+	MaxEntries int
+	// Clock returns the current time. If nil, time.Now is used.
+	Clock func() time.Time
+
+	once   sync.Once
+	shards [replayCacheShards]replayCacheShard
+}
+
+type replayCacheShard struct {
+	mu     sync.Mutex
+	ids    map[string]time.Time
+	expiry replayCacheHeap
+}
+
+// NewMemoryReplayCache returns an empty in-memory ReplayCache with the default size
+func NewMemoryReplayCache() *MemoryReplayCache {
+	return &MemoryReplayCache{}
+}
+
+// Add implements the ReplayCache interface. Ids that have already expired are accepted but not recorded.
+func (c *MemoryReplayCache) Add(id string, expires time.Time) (bool, error) {
+	c.once.Do(c.init)
+
+	now := time.Now()
+	if c.Clock != nil {
+		now = c.Clock()
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	s := &c.shards[h.Sum32()%replayCacheShards]
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if exp, ok := s.ids[id]; ok && now.Before(exp) {
+		return false, nil
+	}
+	if !now.Before(expires) {
+		return true, nil
+	}
+
+	s.evict(now, c.shardSize())
+	s.ids[id] = expires
+	heap.Push(&s.expiry, replayCacheEntry{id, expires})
+
+	return true, nil
+}
+
+// Len returns the number of recorded ids, including expired ids that haven't been evicted yet
+func (c *MemoryReplayCache) Len() int {
+	c.once.Do(c.init)
+
+	n := 0
+	for i := range c.shards {
+		c.shards[i].mu.Lock()
+		n += len(c.shards[i].ids)
+		c.shards[i].mu.Unlock()
+	}
+	return n
+}
+
+func (c *MemoryReplayCache) init() {
+	for i := range c.shards {
+		c.shards[i].ids = make(map[string]time.Time)
+	}
+}
+
+func (c *MemoryReplayCache) shardSize() int {
+	maxEntries := c.MaxEntries
+	if maxEntries < 1 {
+		maxEntries = defaultReplayCacheMaxEntries
+	}
+	if size := maxEntries / replayCacheShards; size > 0 {
+		return size
+	}
+	return 1
+}
+
+// Removes expired ids, and the ids closest to expiring while the shard is full. s.mu must be held.
+func (s *replayCacheShard) evict(now time.Time, size int) {
+	for s.expiry.Len() > 0 {
+		e := s.expiry[0]
+		if exp, ok := s.ids[e.id]; !ok || !exp.Equal(e.expires) {
+			// Stale entry for an id that was evicted or recorded again
+			heap.Pop(&s.expiry)
+			continue
+		}
+		if now.Before(e.expires) && len(s.ids) < size {
+			return
+		}
+		heap.Pop(&s.expiry)
+		delete(s.ids, e.id)
+	}
+}
+
+type replayCacheEntry struct {
+	id      string
+	expires time.Time
+}
+
+// Min-heap of recorded ids ordered by expiry
+type replayCacheHeap []replayCacheEntry
+
+func (h replayCacheHeap) Len() int            { return len(h) }
+func (h replayCacheHeap) Less(i, j int) bool  { return h[i].expires.Before(h[j].expires) }
+func (h replayCacheHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *replayCacheHeap) Push(x interface{}) { *h = append(*h, x.(replayCacheEntry)) }
+
+func (h *replayCacheHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
@@ -0,0 +1,153 @@
+package gose
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryReplayCache(t *testing.T) {
+	now := validatorTestNow
+	cache := &MemoryReplayCache{Clock: func() time.Time { return now }}
+
+	vectors := []struct {
+		name    string
+		id      string
+		expires time.Time
+		ok      bool
+	}{
+		{"New id", "a", now.Add(time.Minute), true},
+		{"Replayed id", "a", now.Add(time.Minute), false},
+		{"Other id", "b", now.Add(time.Minute), true},
+		{"Expired id", "c", now.Add(-time.Second), true},
+		{"Expired id again", "c", now.Add(-time.Second), true},
+	}
+
+	for i, v := range vectors {
+		ok, err := cache.Add(v.id, v.expires)
+		if err != nil || ok != v.ok {
+			t.Errorf("Test %d (%s). Expected %v, got %v. Err: %v\n", i+1, v.name, v.ok, ok, err)
+		}
+	}
+
+	if n := cache.Len(); n != 2 {
+		t.Errorf("Expected 2 recorded ids, got %d\n", n)
+	}
+
+	// Once expired, the id may be recorded again
+	now = now.Add(2 * time.Minute)
+	if ok, _ := cache.Add("a", now.Add(time.Minute)); !ok {
+		t.Errorf("Expired id was reported as a replay\n")
+	}
+}
+
+func TestMemoryReplayCacheEviction(t *testing.T) {
+	now := validatorTestNow
+	cache := &MemoryReplayCache{MaxEntries: 32, Clock: func() time.Time { return now }}
+
+	for i := 0; i < 1000; i++ {
+		cache.Add(fmt.Sprintf("id-%d", i), now.Add(time.Duration(i+1)*time.Second))
+	}
+	if n := cache.Len(); n > 32 {
+		t.Errorf("Cache exceeds its bound: %d entries\n", n)
+	}
+
+	// The ids closest to expiring are evicted first, so the latest ids are still recorded
+	if ok, _ := cache.Add("id-999", now.Add(time.Hour)); ok {
+		t.Errorf("Latest id was evicted\n")
+	}
+}
+
+func TestMemoryReplayCacheConcurrent(t *testing.T) {
+	cache := NewMemoryReplayCache()
+	expires := time.Now().Add(time.Minute)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	accepted := 0
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if ok, _ := cache.Add(fmt.Sprintf("id-%d", j), expires); ok {
+					mu.Lock()
+					accepted++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if accepted != 100 {
+		t.Errorf("Expected each id to be accepted once, got %d accepts\n", accepted)
+	}
+}
+
+func TestValidatorReplayCache(t *testing.T) {
+	clock := func() time.Time { return validatorTestNow }
+	v := &Validator{
+		Clock:       clock,
+		MaxAge:      time.Minute,
+		ReplayCache: &MemoryReplayCache{Clock: clock},
+	}
+
+	vectors := []struct {
+		name   string
+		claims *ClaimSet
+		failed []string
+	}{
+		{"First use", &ClaimSet{Id: "1", Expiration: validatorTestNow.Add(time.Minute), IssuedAt: validatorTestNow}, nil},
+		{"Replay", &ClaimSet{Id: "1", Expiration: validatorTestNow.Add(time.Minute), IssuedAt: validatorTestNow}, []string{"jti"}},
+		{"Other issuer", &ClaimSet{Issuer: "other", Id: "1", Expiration: validatorTestNow.Add(time.Minute), IssuedAt: validatorTestNow}, nil},
+		{"Issuer with a space", &ClaimSet{Issuer: "a b", Id: "c", Expiration: validatorTestNow.Add(time.Minute), IssuedAt: validatorTestNow}, nil},
+		{"jti with a space", &ClaimSet{Issuer: "a", Id: "b c", Expiration: validatorTestNow.Add(time.Minute), IssuedAt: validatorTestNow}, nil},
+		{"Without jti", &ClaimSet{Expiration: validatorTestNow.Add(time.Minute), IssuedAt: validatorTestNow}, []string{"jti"}},
+		{"iat and MaxAge", &ClaimSet{Id: "2", IssuedAt: validatorTestNow}, nil},
+		{"iat and MaxAge replay", &ClaimSet{Id: "2", IssuedAt: validatorTestNow}, []string{"jti"}},
+		{"Invalid claims aren't recorded", &ClaimSet{Id: "3", Expiration: validatorTestNow.Add(time.Minute)}, []string{"iat"}},
+		{"Previously invalid", &ClaimSet{Id: "3", Expiration: validatorTestNow.Add(time.Minute), IssuedAt: validatorTestNow}, nil},
+	}
+
+	for i, vec := range vectors {
+		err := v.ValidateClaims(vec.claims)
+		if !claimErrorsMatch(err, vec.failed) {
+			t.Errorf("Test %d (%s). Expected failed claims %v. Err: %v\n", i+1, vec.name, vec.failed, err)
+		}
+	}
+
+	// Without MaxAge, exp is required
+	v = &Validator{ReplayCache: NewMemoryReplayCache()}
+	if err := v.ValidateClaims(&ClaimSet{Id: "1", IssuedAt: time.Now()}); !claimErrorsMatch(err, []string{"exp"}) {
+		t.Errorf("JWT without expiration was accepted. Err: %v\n", err)
+	}
+
+	// Validators sharing a ReplayCache, e.g. of several server instances, reject each other's jti
+	cache := NewMemoryReplayCache()
+	assertion := &ClaimSet{Issuer: "client", Subject: "client", Audience: []string{"aud"}, Id: "1", Expiration: time.Now().Add(time.Minute)}
+	for i := 0; i < 2; i++ {
+		av := &AssertionValidator{Validator: Validator{Audiences: []string{"aud"}, ReplayCache: cache}}
+		if err := av.ValidateClaims(assertion); (err == nil) != (i == 0) {
+			t.Errorf("Test %d. Unexpected assertion validation result. Err: %v\n", i+1, err)
+		}
+	}
+}
+
+// Checks that err is nil for no failed claims, or ClaimErrors for exactly the failed claims
+func claimErrorsMatch(err error, failed []string) bool {
+	if len(failed) == 0 {
+		return err == nil
+	}
+	errs, ok := err.(ClaimErrors)
+	if !ok || len(errs) != len(failed) {
+		return false
+	}
+	for i, e := range errs {
+		if e.Claim != failed[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,263 @@
+package gose
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Request object header types as specified in https://tools.ietf.org/html/rfc9101#section-10.8
+const (
+	RequestObjectType      string = "oauth-authz-req+jwt"
+	RequestObjectMediaType string = "application/oauth-authz-req+jwt"
+)
+
+// Authorization request parameters that pass a request object, see https://tools.ietf.org/html/rfc9101#section-5
+const (
+	ParamRequest    string = "request"
+	ParamRequestUri string = "request_uri"
+)
+
+// Default lifetime of a created request object
+const defaultRequestObjectLifetime = 5 * time.Minute
+
+// RequestObjectOptions configures how a request object is created
+type RequestObjectOptions struct {
+	// Audience is the issuer identifier of the authorization server. It is required.
+	Audience string
+	// Lifetime is the time until the request object expires. Defaults to 5 minutes.
+	Lifetime time.Duration
+	// Clock returns the current time. If nil, time.Now is used.
+	Clock func() time.Time
+	// SignOptions configures the signature. The type (typ) is always "oauth-authz-req+jwt".
+	SignOptions *JwtSignOptions
+	// EncryptionKey, if set, is the authorization server's key that the signed request object is encrypted with
+	EncryptionKey *Jwk
+	// EncryptOptions configures the encryption if EncryptionKey is set
+	EncryptOptions *JwtEncryptOptions
+}
+
+// RequestObject is a verified request object (https://tools.ietf.org/html/rfc9101)
+type RequestObject struct {
+	// Header is the protected header of the signed request object
+	Header *JwHeader
+	// Claims is the decoded claim set
+	Claims *ClaimSet
+	// Params are the authorization request parameters. Values that aren't strings (e.g. claims or
+	// authorization_details) are JSON encoded.
+	Params url.Values
+}
+
+// NewRequestObject creates a request object (https://tools.ietf.org/html/rfc9101#section-4) that passes the
+// authorization request parameters of clientId as a JWT signed with key. Its issuer and client_id claim are the
+// client id and its audience is the authorization server. If opts.EncryptionKey is set, the signed request object is
+// then encrypted as a nested JWT.
+func NewRequestObject(clientId string, params map[string]interface{}, key *Jwk, opts *RequestObjectOptions) (string, error) {
+	if clientId == "" {
+		return "", errors.New("A request object requires a client id")
+	} else if opts == nil || opts.Audience == "" {
+		return "", errors.New("A request object requires the authorization server as audience")
+	}
+
+	now := time.Now()
+	if opts.Clock != nil {
+		now = opts.Clock()
+	}
+	lifetime := opts.Lifetime
+	if lifetime <= 0 {
+		lifetime = defaultRequestObjectLifetime
+	}
+
+	jti, err := randomJti()
+	if err != nil {
+		return "", err
+	}
+
+	claims := &ClaimSet{
+		Issuer:           clientId,
+		Audience:         []string{opts.Audience},
+		Id:               jti,
+		IssuedAt:         now,
+		NotBefore:        now,
+		Expiration:       now.Add(lifetime),
+		AdditionalClaims: make(map[string]interface{}, len(params)+1),
+	}
+	for k, v := range params {
+		switch k {
+		case ParamRequest, ParamRequestUri:
+			return "", fmt.Errorf("A request object must not contain the %s parameter", k)
+		case ClaimIssuer, ClaimSubject, ClaimAudience, ClaimExpiration, ClaimNotBefore, ClaimIssuedAt, ClaimId:
+			return "", fmt.Errorf("Parameter %s conflicts with a registered claim of the request object", k)
+		case ClaimClientId:
+			if v != clientId {
+				return "", errors.New("The client_id parameter doesn't match the client id")
+			}
+		}
+		claims.AdditionalClaims[k] = v
+	}
+	claims.AdditionalClaims[ClaimClientId] = clientId
+
+	o := JwtSignOptions{}
+	if opts.SignOptions != nil {
+		o = *opts.SignOptions
+	}
+	o.Type = RequestObjectType
+
+	token, err := SignJwt(claims, key, &o)
+	if err != nil || opts.EncryptionKey == nil {
+		return token, err
+	}
+
+	return EncryptNestedJwt(token, opts.EncryptionKey, opts.EncryptOptions)
+}
+
+// RequestObjectValidator validates request objects received by an authorization server
+// (https://tools.ietf.org/html/rfc9101#section-6.3). Set Audiences to the server's issuer identifier, so that a
+// request object made for another server is rejected, and Issuers to the client id if it is known. The aud and exp
+// claims are required.
+type RequestObjectValidator struct {
+	Validator
+	// DecryptionKeys resolves the authorization server's keys to decrypt encrypted request objects. If nil, encrypted
+	// request objects are rejected.
+	DecryptionKeys KeySource
+	// RequireEncryption rejects request objects that aren't encrypted
+	RequireEncryption bool
+	// RequireType rejects request objects without the "oauth-authz-req+jwt" type (typ). Otherwise a missing type or
+	// "JWT" is also accepted, for clients that predate RFC 9101.
+	RequireType bool
+	// MaxLifetime is the maximum allowed time between iat (or nbf, or now) and exp. If 0, it isn't checked.
+	MaxLifetime time.Duration
+}
+
+// ValidateClaims validates the request object's claims, returning ClaimErrors or nil
+func (v *RequestObjectValidator) ValidateClaims(c *ClaimSet) error {
+	if len(v.Audiences) < 1 {
+		return errors.New("RequestObjectValidator requires the accepted audiences")
+	}
+
+	errs := v.Validator.validate(c)
+	errs = v.requireClaims(c, errs, ClaimAudience, ClaimExpiration)
+
+	if v.MaxLifetime > 0 && !c.Expiration.IsZero() {
+		start := c.IssuedAt
+		if start.IsZero() {
+			start = c.NotBefore
+		}
+		if start.IsZero() {
+			start = v.now()
+		}
+		if c.Expiration.Sub(start) > v.MaxLifetime+v.Leeway {
+			errs = append(errs, &ClaimError{ClaimExpiration, fmt.Errorf("Request object lifetime exceeds %v", v.MaxLifetime)})
+		}
+	}
+
+	return v.checkReplay(c, errs)
+}
+
+// ParseRequestObject decrypts (if needed), verifies and validates a request object. clientId is the client_id
+// authorization request parameter, which must match the request object's client_id claim and, if present, its
+// issuer. ks resolves the client's registered public keys.
+func ParseRequestObject(requestObject string, clientId string, ks KeySource, v *RequestObjectValidator) (*RequestObject, error) {
+	if v == nil {
+		return nil, errors.New("A RequestObjectValidator is required to validate a request object")
+	} else if clientId == "" {
+		return nil, errors.New("The client_id parameter is required with a request object")
+	}
+
+	token, err := decryptJwt(requestObject, v.DecryptionKeys, v.RequireEncryption)
+	if err != nil {
+		return nil, err
+	}
+
+	jwt, err := parseJwtPayload(token, ks, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	typ := jwt.Header.Type
+	if !strings.EqualFold(typ, RequestObjectType) && !strings.EqualFold(typ, RequestObjectMediaType) &&
+		(v.RequireType || (typ != "" && !strings.EqualFold(typ, JwtType))) {
+		return nil, fmt.Errorf("JWT type (typ=%s) is not a request object (%s)", typ, RequestObjectType)
+	}
+
+	claims := new(ClaimSet)
+	if err := claims.UnmarshalJSON(jwt.Payload); err != nil {
+		return nil, err
+	}
+
+	var errs ClaimErrors
+	if id, _, err := claims.stringClaim(ClaimClientId); err != nil || id != clientId {
+		errs = append(errs, &ClaimError{ClaimClientId, errors.New("client_id doesn't match the client_id parameter")})
+	}
+	if claims.Issuer != "" && claims.Issuer != clientId {
+		errs = append(errs, &ClaimError{ClaimIssuer, errors.New("Issuer must be the client id")})
+	}
+	for _, name := range []string{ParamRequest, ParamRequestUri} {
+		if _, ok := claims.AdditionalClaims[name]; ok {
+			errs = append(errs, &ClaimError{name, errors.New("Request object must not contain this parameter")})
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	if err := v.ValidateClaims(claims); err != nil {
+		return nil, err
+	}
+
+	params := make(url.Values, len(claims.AdditionalClaims))
+	for k, val := range claims.AdditionalClaims {
+		if s, ok := val.(string); ok {
+			params.Set(k, s)
+			continue
+		}
+		b, err := json.Marshal(val)
+		if err != nil {
+			return nil, err
+		}
+		params.Set(k, string(b))
+	}
+
+	return &RequestObject{Header: jwt.Header, Claims: claims, Params: params}, nil
+}
+
+// RequestMergeMode selects how RequestObject.Merge combines the request object with the authorization request's
+// query parameters
+type RequestMergeMode int
+
+const (
+	// RequestMergeStrict only uses the request object's parameters, as specified in
+	// https://tools.ietf.org/html/rfc9101#section-5
+	RequestMergeStrict RequestMergeMode = iota
+	// RequestMergeOidc also uses query parameters that aren't in the request object; the request object's parameters
+	// take precedence, as specified in https://openid.net/specs/openid-connect-core-1_0.html#RequestObject
+	RequestMergeOidc
+)
+
+// Merge returns the authorization request parameters to process. The client_id query parameter must match the
+// request object. The request and request_uri query parameters are never included.
+func (ro *RequestObject) Merge(query url.Values, mode RequestMergeMode) (url.Values, error) {
+	if id := query.Get(ClaimClientId); id != ro.Params.Get(ClaimClientId) {
+		return nil, errors.New("The client_id parameter doesn't match the request object")
+	}
+
+	merged := make(url.Values, len(ro.Params))
+	if mode == RequestMergeOidc {
+		for k, v := range query {
+			if k != ParamRequest && k != ParamRequestUri {
+				merged[k] = append([]string{}, v...)
+			}
+		}
+	} else if mode != RequestMergeStrict {
+		return nil, fmt.Errorf("Unknown request merge mode: %d", mode)
+	}
+
+	for k, v := range ro.Params {
+		merged[k] = append([]string{}, v...)
+	}
+
+	return merged, nil
+}
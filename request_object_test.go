@@ -0,0 +1,159 @@
+package gose
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var requestObjectTestParams = map[string]interface{}{
+	"response_type": "code",
+	"redirect_uri":  "https://client.example.org/cb",
+	"scope":         "openid",
+	"state":         "af0ifjsldkj",
+	"max_age":       86400,
+	"claims":        map[string]interface{}{"userinfo": map[string]interface{}{"email": nil}},
+}
+
+func TestRequestObject(t *testing.T) {
+	clientKey, serverKey := newTestNestedJwtKeys(t)
+	opts := &RequestObjectOptions{Audience: "https://server.example.com", SignOptions: &JwtSignOptions{Algorithm: JwsAlgES256}}
+	v := &RequestObjectValidator{Validator: Validator{Audiences: []string{"https://server.example.com"}}, DecryptionKeys: serverKey}
+
+	signed, err := NewRequestObject("s6BhdRkqt3", requestObjectTestParams, clientKey, opts)
+	if err != nil {
+		t.Fatalf("Unable to create request object. Err: %v\n", err)
+	}
+	encOpts := *opts
+	encOpts.EncryptionKey = serverKey
+	encrypted, err := NewRequestObject("s6BhdRkqt3", requestObjectTestParams, clientKey, &encOpts)
+	if err != nil {
+		t.Fatalf("Unable to create encrypted request object. Err: %v\n", err)
+	}
+
+	for i, token := range []string{signed, encrypted} {
+		ro, err := ParseRequestObject(token, "s6BhdRkqt3", clientKey, v)
+		if err != nil {
+			t.Errorf("Test %d. Unable to parse request object. Err: %v\n", i+1, err)
+			continue
+		}
+		if ro.Header.Type != RequestObjectType || ro.Claims.Issuer != "s6BhdRkqt3" || ro.Claims.Id == "" {
+			t.Errorf("Test %d. Unexpected request object: %+v\n", i+1, ro)
+		}
+		expected := url.Values{
+			"client_id":     {"s6BhdRkqt3"},
+			"response_type": {"code"},
+			"redirect_uri":  {"https://client.example.org/cb"},
+			"scope":         {"openid"},
+			"state":         {"af0ifjsldkj"},
+			"max_age":       {"86400"},
+			"claims":        {`{"userinfo":{"email":null}}`},
+		}
+		if !reflect.DeepEqual(ro.Params, expected) {
+			t.Errorf("Test %d. Unexpected parameters: %v\n", i+1, ro.Params)
+		}
+	}
+
+	for i, params := range []map[string]interface{}{{"request_uri": "urn:example"}, {"client_id": "other"}, {"exp": 0}} {
+		if _, err := NewRequestObject("s6BhdRkqt3", params, clientKey, opts); err == nil {
+			t.Errorf("Test %d. Request object with parameters %v was created\n", i+1, params)
+		}
+	}
+	if _, err := NewRequestObject("s6BhdRkqt3", nil, clientKey, nil); err == nil {
+		t.Errorf("Request object without an audience was created\n")
+	}
+}
+
+func TestParseRequestObjectRejects(t *testing.T) {
+	clientKey, serverKey := newTestNestedJwtKeys(t)
+	opts := &RequestObjectOptions{Audience: "https://server.example.com", SignOptions: &JwtSignOptions{Algorithm: JwsAlgES256}}
+	v := &RequestObjectValidator{Validator: Validator{Audiences: []string{"https://server.example.com"}}}
+
+	signed, _ := NewRequestObject("s6BhdRkqt3", requestObjectTestParams, clientKey, opts)
+
+	encOpts := *opts
+	encOpts.EncryptionKey = serverKey
+	encrypted, _ := NewRequestObject("s6BhdRkqt3", requestObjectTestParams, clientKey, &encOpts)
+
+	otherAud := *opts
+	otherAud.Audience = "https://other.example.com"
+	wrongAud, _ := NewRequestObject("s6BhdRkqt3", requestObjectTestParams, clientKey, &otherAud)
+
+	oldOpts := *opts
+	oldOpts.Clock = func() time.Time { return time.Now().Add(-time.Hour) }
+	expired, _ := NewRequestObject("s6BhdRkqt3", requestObjectTestParams, clientKey, &oldOpts)
+
+	longOpts := *opts
+	longOpts.Lifetime = 2 * time.Hour
+	long, _ := NewRequestObject("s6BhdRkqt3", requestObjectTestParams, clientKey, &longOpts)
+
+	noExp, _ := SignJwt(&ClaimSet{Issuer: "s6BhdRkqt3", Audience: []string{"https://server.example.com"},
+		AdditionalClaims: map[string]interface{}{"client_id": "s6BhdRkqt3"}}, clientKey,
+		&JwtSignOptions{Algorithm: JwsAlgES256, Type: RequestObjectType})
+	otherIss, _ := SignJwt(&ClaimSet{Issuer: "mallory", Audience: []string{"https://server.example.com"},
+		Expiration: time.Now().Add(time.Minute), AdditionalClaims: map[string]interface{}{"client_id": "s6BhdRkqt3"}},
+		clientKey, &JwtSignOptions{Algorithm: JwsAlgES256, Type: RequestObjectType})
+	untyped, _ := SignJwt(&ClaimSet{Issuer: "s6BhdRkqt3", Audience: []string{"https://server.example.com"},
+		Expiration: time.Now().Add(time.Minute), AdditionalClaims: map[string]interface{}{"client_id": "s6BhdRkqt3"}},
+		clientKey, &JwtSignOptions{Algorithm: JwsAlgES256})
+	dpop, _ := NewDPoPProof(clientKey, "GET", "https://server.example.com/authorize", nil)
+
+	vectors := []struct {
+		name     string
+		token    string
+		clientId string
+		v        *RequestObjectValidator
+	}{
+		{"Other client", signed, "other", v},
+		{"No client_id parameter", signed, "", v},
+		{"Wrong audience", wrongAud, "s6BhdRkqt3", v},
+		{"Expired", expired, "s6BhdRkqt3", v},
+		{"No expiration", noExp, "s6BhdRkqt3", v},
+		{"Other issuer", otherIss, "s6BhdRkqt3", v},
+		{"Lifetime too long", long, "s6BhdRkqt3", &RequestObjectValidator{Validator: v.Validator, MaxLifetime: time.Hour}},
+		{"Untyped", untyped, "s6BhdRkqt3", &RequestObjectValidator{Validator: v.Validator, RequireType: true}},
+		{"Other type", dpop, "s6BhdRkqt3", v},
+		{"Encrypted without decryption keys", encrypted, "s6BhdRkqt3", v},
+		{"Not encrypted", signed, "s6BhdRkqt3", &RequestObjectValidator{Validator: v.Validator, DecryptionKeys: serverKey, RequireEncryption: true}},
+		{"No audiences", signed, "s6BhdRkqt3", &RequestObjectValidator{}},
+	}
+
+	for i, vec := range vectors {
+		if _, err := ParseRequestObject(vec.token, vec.clientId, clientKey, vec.v); err == nil {
+			t.Errorf("Test %d (%s). Request object was accepted\n", i+1, vec.name)
+		}
+	}
+
+	if _, err := ParseRequestObject(untyped, "s6BhdRkqt3", clientKey, v); err != nil {
+		t.Errorf("Untyped request object was rejected. Err: %v\n", err)
+	}
+}
+
+func TestRequestObjectMerge(t *testing.T) {
+	ro := &RequestObject{Params: url.Values{"client_id": {"s6BhdRkqt3"}, "scope": {"openid"}, "state": {"abc"}}}
+	query := url.Values{
+		"client_id":     {"s6BhdRkqt3"},
+		"scope":         {"openid email"},
+		"response_type": {"code"},
+		"request":       {"eyJ..."},
+	}
+
+	vectors := []struct {
+		mode     RequestMergeMode
+		expected url.Values
+	}{
+		{RequestMergeStrict, url.Values{"client_id": {"s6BhdRkqt3"}, "scope": {"openid"}, "state": {"abc"}}},
+		{RequestMergeOidc, url.Values{"client_id": {"s6BhdRkqt3"}, "scope": {"openid"}, "state": {"abc"}, "response_type": {"code"}}},
+	}
+	for i, v := range vectors {
+		merged, err := ro.Merge(query, v.mode)
+		if err != nil || !reflect.DeepEqual(merged, v.expected) {
+			t.Errorf("Test %d. Expected %v, got %v. Err: %v\n", i+1, v.expected, merged, err)
+		}
+	}
+
+	if _, err := ro.Merge(url.Values{"client_id": {"other"}}, RequestMergeStrict); err == nil {
+		t.Errorf("Request with another client_id was merged\n")
+	}
+}
@@ -0,0 +1,829 @@
+package gose
+
+import (
+	"bytes"
+	"crypto"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SD-JWT claim names as specified in https://datatracker.ietf.org/doc/html/draft-ietf-oauth-selective-disclosure-jwt
+const (
+	ClaimSd     string = "_sd"
+	ClaimSdAlg  string = "_sd_alg"
+	ClaimSdHash string = "sd_hash"
+)
+
+// KeyBindingType is the header type (typ) of a Key Binding JWT
+const KeyBindingType string = "kb+jwt"
+
+// SD-JWT hash algorithms (_sd_alg), named as in the IANA Named Information Hash Algorithm Registry
+const (
+	SdHashSha256 string = "sha-256"
+	SdHashSha384 string = "sha-384"
+	SdHashSha512 string = "sha-512"
+)
+
+// Key of the object that replaces a selectively disclosable array element
+const sdArrayDigestKey = "..."
+
+// Separator of the issuer-signed JWT, the disclosures and the Key Binding JWT
+const sdSeparator = "~"
+
+// Default maximum age of a Key Binding JWT
+const defaultKeyBindingMaxAge = 5 * time.Minute
+
+// Claims that control the validity of an SD-JWT, and can't be selectively disclosable
+var sdNonDisclosableClaims = []string{ClaimIssuer, ClaimExpiration, ClaimNotBefore, ClaimConfirmation, ClaimStatus,
+	ClaimSdAlg}
+
+// Disclosure discloses a selectively disclosable claim or array element. It is the base64url encoded JSON array
+// [salt, name, value] for a claim, or [salt, value] for an array element.
+type Disclosure struct {
+	// Salt is the random salt that prevents guessing the value from its digest
+	Salt string
+	// Name is the claim name. It is empty for an array element.
+	Name string
+	// Value is the disclosed value
+	Value interface{}
+	// ArrayElement is true if the disclosure discloses an array element
+	ArrayElement bool
+	// Encoded is the base64url encoded disclosure. Digests are computed over it as received.
+	Encoded string
+}
+
+// Creates a disclosure with a random salt
+func newDisclosure(name string, value interface{}, arrayElement bool) (*Disclosure, error) {
+	// A random JWT ID has the 128 bits of entropy recommended for a salt
+	salt, err := randomJti()
+	if err != nil {
+		return nil, err
+	}
+
+	arr := []interface{}{salt, name, value}
+	if arrayElement {
+		arr = []interface{}{salt, value}
+	}
+	data, err := json.Marshal(arr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Disclosure{
+		Salt:         salt,
+		Name:         name,
+		Value:        value,
+		ArrayElement: arrayElement,
+		Encoded:      base64.RawURLEncoding.EncodeToString(data),
+	}, nil
+}
+
+// ParseDisclosure decodes a base64url encoded disclosure
+func ParseDisclosure(encoded string) (*Disclosure, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	arr, err := decodeSdJson(data)
+	if err != nil {
+		return nil, err
+	}
+	elems, ok := arr.([]interface{})
+	if !ok || len(elems) < 2 || len(elems) > 3 {
+		return nil, errors.New("Disclosure must be a JSON array of 2 or 3 elements")
+	}
+
+	d := &Disclosure{Encoded: encoded, Value: elems[len(elems)-1], ArrayElement: len(elems) == 2}
+	if d.Salt, ok = elems[0].(string); !ok {
+		return nil, errors.New("Disclosure salt must be a string")
+	}
+	if !d.ArrayElement {
+		if d.Name, ok = elems[1].(string); !ok {
+			return nil, errors.New("Disclosure claim name must be a string")
+		} else if d.Name == ClaimSd || d.Name == sdArrayDigestKey {
+			return nil, fmt.Errorf("Disclosure claim name can't be %s", d.Name)
+		}
+	}
+
+	return d, nil
+}
+
+// Digest returns the base64url encoded digest of the disclosure using the SD-JWT hash algorithm (_sd_alg)
+func (d *Disclosure) Digest(alg string) (string, error) {
+	return sdDigest(alg, d.Encoded)
+}
+
+// SdJwt is a Selective Disclosure JWT: an issuer-signed JWT, the disclosures of its selectively disclosable claims and
+// an optional Key Binding JWT. Its serialization is the tilde separated <JWT>~<Disclosure 1>~...~<Disclosure N>~<KB-JWT>.
+type SdJwt struct {
+	// Jwt is the compact serialized issuer-signed JWT
+	Jwt string
+	// Disclosures are the disclosures issued or presented with the JWT
+	Disclosures []*Disclosure
+	// KeyBinding is the compact serialized Key Binding JWT. It is empty if there is none.
+	KeyBinding string
+}
+
+// SdJwtOptions configures how an SD-JWT is issued
+type SdJwtOptions struct {
+	// HashAlgorithm is the algorithm used to digest the disclosures (_sd_alg). Defaults to sha-256.
+	HashAlgorithm string
+	// HolderKey is the holder's public key. If set, it is put in the confirmation (cnf) claim so the holder can add a
+	// Key Binding JWT to presentations.
+	HolderKey *Jwk
+	// SignOptions configures how the JWT is signed, e.g. its algorithm and type (typ)
+	SignOptions *JwtSignOptions
+}
+
+// IssueSdJwt issues an SD-JWT with the claims at the disclose paths made selectively disclosable. A path is a dot
+// separated list of claim names, with array elements selected by index: e.g. "given_name", "address.street_address"
+// or "nationalities.1". Paths may be nested, in which case the inner claims are concealed within the outer
+// disclosure. Claims that control the SD-JWT's validity (iss, exp, nbf, cnf, status) can't be selectively disclosable.
+func IssueSdJwt(claims *ClaimSet, disclose []string, key *Jwk, opts *SdJwtOptions) (*SdJwt, error) {
+	if opts == nil {
+		opts = &SdJwtOptions{}
+	}
+	alg := opts.HashAlgorithm
+	if alg == "" {
+		alg = SdHashSha256
+	}
+	if _, err := sdHash(alg); err != nil {
+		return nil, err
+	}
+
+	c := new(ClaimSet)
+	if claims != nil {
+		*c = *claims
+		c.AdditionalClaims = make(map[string]interface{}, len(claims.AdditionalClaims))
+		for k, v := range claims.AdditionalClaims {
+			c.AdditionalClaims[k] = v
+		}
+	}
+	if opts.HolderKey != nil {
+		if err := c.SetConfirmation(&Confirmation{Jwk: opts.HolderKey.Public()}); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := decodeSdJson(data)
+	if err != nil {
+		return nil, err
+	}
+	payload := decoded.(map[string]interface{})
+
+	root := new(sdPathNode)
+	for _, path := range disclose {
+		if err := root.add(path); err != nil {
+			return nil, err
+		}
+	}
+
+	sd := new(SdJwt)
+	if _, err := sd.conceal(payload, root, alg, ""); err != nil {
+		return nil, err
+	}
+	payload[ClaimSdAlg] = alg
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	if sd.Jwt, err = signJwtPayload(body, key, opts.SignOptions); err != nil {
+		return nil, err
+	}
+
+	return sd, nil
+}
+
+// Tree of the paths of selectively disclosable claims
+type sdPathNode struct {
+	disclose bool
+	children map[string]*sdPathNode
+}
+
+func (n *sdPathNode) add(path string) error {
+	names := strings.Split(path, ".")
+	for i, name := range names {
+		if name == "" {
+			return fmt.Errorf("Invalid selectively disclosable claim path: %s", path)
+		} else if name == ClaimSd || name == sdArrayDigestKey || (i == 0 && containsString(sdNonDisclosableClaims, name)) {
+			return fmt.Errorf("Claim %s can't be selectively disclosable", path)
+		}
+
+		if n.children == nil {
+			n.children = make(map[string]*sdPathNode)
+		}
+		child, ok := n.children[name]
+		if !ok {
+			child = new(sdPathNode)
+			n.children[name] = child
+		}
+		n = child
+	}
+	n.disclose = true
+
+	return nil
+}
+
+// Replaces the selectively disclosable claims and array elements within v by their digests, innermost first, and
+// adds their disclosures. The concealed value is returned.
+func (s *SdJwt) conceal(v interface{}, n *sdPathNode, alg string, path string) (interface{}, error) {
+	switch obj := v.(type) {
+	case map[string]interface{}:
+		var digests []string
+		for name, child := range n.children {
+			val, ok := obj[name]
+			if !ok {
+				return nil, fmt.Errorf("Selectively disclosable claim %s not found", path+name)
+			}
+			val, err := s.conceal(val, child, alg, path+name+".")
+			if err != nil {
+				return nil, err
+			}
+			obj[name] = val
+			if !child.disclose {
+				continue
+			}
+
+			digest, err := s.addDisclosure(name, val, false, alg)
+			if err != nil {
+				return nil, err
+			}
+			delete(obj, name)
+			digests = append(digests, digest)
+		}
+		if len(digests) > 0 {
+			// Sorted, so the digests don't reveal the order of the claims
+			sort.Strings(digests)
+			sd := make([]interface{}, len(digests))
+			for i, digest := range digests {
+				sd[i] = digest
+			}
+			obj[ClaimSd] = sd
+		}
+		return obj, nil
+
+	case []interface{}:
+		for key, child := range n.children {
+			idx, err := strconv.Atoi(key)
+			if err != nil || idx < 0 || idx >= len(obj) {
+				return nil, fmt.Errorf("Selectively disclosable array element %s not found", path+key)
+			}
+			val, err := s.conceal(obj[idx], child, alg, path+key+".")
+			if err != nil {
+				return nil, err
+			}
+			obj[idx] = val
+			if !child.disclose {
+				continue
+			}
+
+			digest, err := s.addDisclosure("", val, true, alg)
+			if err != nil {
+				return nil, err
+			}
+			obj[idx] = map[string]interface{}{sdArrayDigestKey: digest}
+		}
+		return obj, nil
+	}
+
+	if len(n.children) > 0 {
+		return nil, fmt.Errorf("Claim %s is not an object or array", strings.TrimSuffix(path, "."))
+	}
+	return v, nil
+}
+
+// Creates a disclosure, adds it to the SD-JWT and returns its digest
+func (s *SdJwt) addDisclosure(name string, value interface{}, arrayElement bool, alg string) (string, error) {
+	d, err := newDisclosure(name, value, arrayElement)
+	if err != nil {
+		return "", err
+	}
+	digest, err := d.Digest(alg)
+	if err != nil {
+		return "", err
+	}
+	s.Disclosures = append(s.Disclosures, d)
+
+	return digest, nil
+}
+
+// ParseSdJwt parses a serialized SD-JWT or SD-JWT presentation. Signatures and digests are not verified, see
+// SdJwtVerifier.
+func ParseSdJwt(serialized string) (*SdJwt, error) {
+	parts := strings.Split(strings.TrimSpace(serialized), sdSeparator)
+	if len(parts) < 2 || parts[0] == "" {
+		return nil, errors.New("Invalid SD-JWT. It must be a JWT followed by ~ separated disclosures")
+	}
+
+	sd := &SdJwt{Jwt: parts[0], KeyBinding: parts[len(parts)-1]}
+	for _, v := range parts[1 : len(parts)-1] {
+		if v == "" {
+			return nil, errors.New("Invalid SD-JWT. Disclosures must not be empty")
+		}
+		d, err := ParseDisclosure(v)
+		if err != nil {
+			return nil, err
+		}
+		sd.Disclosures = append(sd.Disclosures, d)
+	}
+
+	return sd, nil
+}
+
+// String returns the serialized SD-JWT
+func (s *SdJwt) String() string {
+	return s.presentation() + s.KeyBinding
+}
+
+// Returns the serialization without the Key Binding JWT, over which its sd_hash is computed
+func (s *SdJwt) presentation() string {
+	var b strings.Builder
+	b.WriteString(s.Jwt)
+	b.WriteString(sdSeparator)
+	for _, d := range s.Disclosures {
+		b.WriteString(d.Encoded)
+		b.WriteString(sdSeparator)
+	}
+	return b.String()
+}
+
+// KeyBindingOptions configures the Key Binding JWT of a presentation
+type KeyBindingOptions struct {
+	// Key is the holder's private key, matching the SD-JWT's confirmation (cnf) key. It is required.
+	Key *Jwk
+	// Algorithm is the JWS algorithm (alg). If empty, the key's algorithm is used.
+	Algorithm string
+	// Audience is the verifier the presentation is intended for (aud). It is required.
+	Audience string
+	// Nonce is the verifier's nonce, ensuring the freshness of the presentation. It is required.
+	Nonce string
+	// Clock returns the current time. If nil, time.Now is used.
+	Clock func() time.Time
+}
+
+// Present creates a presentation that only discloses the claims at the given paths (see IssueSdJwt). The disclosures
+// of enclosing claims are included as needed, as are the disclosures nested within a disclosed claim. If kb is set, a
+// Key Binding JWT signed with the holder's key is appended.
+func (s *SdJwt) Present(paths []string, kb *KeyBindingOptions) (string, error) {
+	payload, alg, err := s.unverifiedPayload()
+	if err != nil {
+		return "", err
+	}
+	disclosurePaths, err := s.disclosurePaths(payload, alg)
+	if err != nil {
+		return "", err
+	}
+
+	p := &SdJwt{Jwt: s.Jwt}
+	for _, d := range s.Disclosures {
+		dp, ok := disclosurePaths[d]
+		if !ok {
+			continue
+		}
+		for _, path := range paths {
+			if path == dp || strings.HasPrefix(path, dp+".") || strings.HasPrefix(dp, path+".") {
+				p.Disclosures = append(p.Disclosures, d)
+				break
+			}
+		}
+	}
+
+	if kb != nil {
+		if p.KeyBinding, err = p.signKeyBinding(kb, alg); err != nil {
+			return "", err
+		}
+	}
+
+	return p.String(), nil
+}
+
+// Signs a Key Binding JWT over the presentation
+func (s *SdJwt) signKeyBinding(kb *KeyBindingOptions, alg string) (string, error) {
+	if kb.Key == nil || kb.Audience == "" || kb.Nonce == "" {
+		return "", errors.New("A Key Binding JWT requires the holder's key, an audience and a nonce")
+	}
+
+	sdHash, err := sdDigest(alg, s.presentation())
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	if kb.Clock != nil {
+		now = kb.Clock()
+	}
+	c := &ClaimSet{
+		Audience:         []string{kb.Audience},
+		IssuedAt:         now,
+		AdditionalClaims: map[string]interface{}{ClaimNonce: kb.Nonce, ClaimSdHash: sdHash},
+	}
+
+	return SignJwt(c, kb.Key, &JwtSignOptions{Algorithm: kb.Algorithm, Type: KeyBindingType})
+}
+
+// Decodes the issuer-signed JWT's payload without verifying it, returning it and its hash algorithm
+func (s *SdJwt) unverifiedPayload() (map[string]interface{}, string, error) {
+	jws := new(Jws)
+	if err := jws.UnmarshalCompact([]byte(s.Jwt)); err != nil {
+		return nil, "", err
+	}
+
+	return sdPayload(jws.Payload)
+}
+
+// Returns the path of each disclosure referenced from the payload
+func (s *SdJwt) disclosurePaths(payload map[string]interface{}, alg string) (map[*Disclosure]string, error) {
+	byDigest := make(map[string]*Disclosure, len(s.Disclosures))
+	for _, d := range s.Disclosures {
+		digest, err := d.Digest(alg)
+		if err != nil {
+			return nil, err
+		}
+		byDigest[digest] = d
+	}
+
+	paths := make(map[*Disclosure]string, len(s.Disclosures))
+	var walk func(v interface{}, prefix string)
+	walk = func(v interface{}, prefix string) {
+		switch x := v.(type) {
+		case map[string]interface{}:
+			digests, _ := x[ClaimSd].([]interface{})
+			for _, e := range digests {
+				digest, _ := e.(string)
+				if d, ok := byDigest[digest]; ok && !d.ArrayElement {
+					if _, seen := paths[d]; !seen {
+						paths[d] = prefix + d.Name
+						walk(d.Value, prefix+d.Name+".")
+					}
+				}
+			}
+			for k, e := range x {
+				if k != ClaimSd {
+					walk(e, prefix+k+".")
+				}
+			}
+		case []interface{}:
+			for i, e := range x {
+				path := prefix + strconv.Itoa(i)
+				if digest, ok := sdArrayDigest(e); ok {
+					if d, ok := byDigest[digest]; ok && d.ArrayElement {
+						if _, seen := paths[d]; !seen {
+							paths[d] = path
+							walk(d.Value, path+".")
+						}
+					}
+					continue
+				}
+				walk(e, path+".")
+			}
+		}
+	}
+	walk(payload, "")
+
+	return paths, nil
+}
+
+// SdJwtVerifier verifies SD-JWT presentations as specified in
+// https://datatracker.ietf.org/doc/html/draft-ietf-oauth-selective-disclosure-jwt#section-7
+type SdJwtVerifier struct {
+	// Validator validates the claims after the disclosures are applied. If nil, exp and nbf are checked.
+	Validator ClaimValidator
+	// RequireKeyBinding requires a Key Binding JWT. If a presentation has one, it is always verified.
+	RequireKeyBinding bool
+	// Audience is the verifier's identifier. If set, it must be the Key Binding JWT's audience.
+	Audience string
+	// Nonce is the nonce the verifier sent to the holder. If set, it must be the Key Binding JWT's nonce.
+	Nonce string
+	// MaxKeyBindingAge is how long after its creation (iat) a Key Binding JWT is accepted. Defaults to 5 minutes.
+	MaxKeyBindingAge time.Duration
+	// Leeway is the allowed clock skew when checking the Key Binding JWT's iat
+	Leeway time.Duration
+	// Clock returns the current time. If nil, time.Now is used.
+	Clock func() time.Time
+}
+
+// Verify verifies the issuer-signed JWT with the key resolved by ks, checks the digests of the disclosures and the Key
+// Binding JWT, and returns the JWT with the disclosed claims. Its Payload is the processed JSON claim set, without
+// the _sd and _sd_alg claims. Disclosures that aren't referenced, or are referenced more than once, are rejected.
+func (v *SdJwtVerifier) Verify(presentation string, ks KeySource, opts ...SignerOption) (*Jwt, error) {
+	sd, err := ParseSdJwt(presentation)
+	if err != nil {
+		return nil, err
+	}
+
+	jwt, err := parseJwtPayload(sd.Jwt, ks, opts)
+	if err != nil {
+		return nil, err
+	}
+	payload, alg, err := sdPayload(jwt.Payload)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &sdRebuild{byDigest: make(map[string]*Disclosure, len(sd.Disclosures)), seen: make(map[string]bool)}
+	for _, d := range sd.Disclosures {
+		digest, err := d.Digest(alg)
+		if err != nil {
+			return nil, err
+		} else if _, ok := r.byDigest[digest]; ok {
+			return nil, errors.New("SD-JWT contains a disclosure more than once")
+		}
+		r.byDigest[digest] = d
+	}
+
+	delete(payload, ClaimSdAlg)
+	if err := r.object(payload); err != nil {
+		return nil, err
+	} else if r.used != len(sd.Disclosures) {
+		return nil, errors.New("SD-JWT contains disclosures that aren't referenced by the JWT")
+	}
+
+	if jwt.Payload, err = json.Marshal(payload); err != nil {
+		return nil, err
+	}
+	jwt.Claims = new(ClaimSet)
+	if err := jwt.Claims.UnmarshalJSON(jwt.Payload); err != nil {
+		return nil, err
+	}
+
+	validator := v.Validator
+	if validator == nil {
+		validator = &Validator{Leeway: v.Leeway, Clock: v.Clock}
+	}
+	if err := validator.ValidateClaims(jwt.Claims); err != nil {
+		return nil, err
+	}
+
+	if sd.KeyBinding != "" {
+		if err := v.verifyKeyBinding(sd, jwt.Claims, alg, opts); err != nil {
+			return nil, err
+		}
+	} else if v.RequireKeyBinding {
+		return nil, errors.New("SD-JWT presentation has no Key Binding JWT")
+	}
+
+	return jwt, nil
+}
+
+// Verifies the Key Binding JWT with the SD-JWT's confirmation key, and checks its claims
+func (v *SdJwtVerifier) verifyKeyBinding(sd *SdJwt, claims *ClaimSet, alg string, opts []SignerOption) error {
+	cnf, err := claims.Confirmation()
+	if err != nil {
+		return err
+	} else if cnf == nil {
+		return errors.New("SD-JWT has no confirmation (cnf) key to verify the Key Binding JWT")
+	}
+
+	if strings.Count(sd.KeyBinding, ".") != 2 {
+		return errors.New("Invalid Key Binding JWT. Only compact serialized JWS's are supported")
+	}
+	jws := new(Jws)
+	if err := jws.UnmarshalCompact([]byte(sd.KeyBinding)); err != nil {
+		return err
+	}
+	if hdr := jws.Signatures[0].ProtectedHeader; hdr == nil || !strings.EqualFold(hdr.Type, KeyBindingType) {
+		return fmt.Errorf("Key Binding JWT must have the type (typ) %s", KeyBindingType)
+	}
+	if err := cnf.VerifyJws(jws, nil, opts...); err != nil {
+		return err
+	}
+
+	kb := new(ClaimSet)
+	if err := kb.UnmarshalJSON(jws.Payload); err != nil {
+		return err
+	}
+
+	var errs ClaimErrors
+	now := time.Now()
+	if v.Clock != nil {
+		now = v.Clock()
+	}
+	maxAge := v.MaxKeyBindingAge
+	if maxAge <= 0 {
+		maxAge = defaultKeyBindingMaxAge
+	}
+	if kb.IssuedAt.IsZero() {
+		errs = append(errs, &ClaimError{ClaimIssuedAt, errors.New("Required claim is missing")})
+	} else if now.Add(v.Leeway).Before(kb.IssuedAt) {
+		errs = append(errs, &ClaimError{ClaimIssuedAt, errors.New("Key Binding JWT was issued in the future")})
+	} else if now.Sub(kb.IssuedAt) > maxAge+v.Leeway {
+		errs = append(errs, &ClaimError{ClaimIssuedAt, errors.New("Key Binding JWT is too old")})
+	}
+
+	if len(kb.Audience) < 1 {
+		errs = append(errs, &ClaimError{ClaimAudience, errors.New("Required claim is missing")})
+	} else if v.Audience != "" && !containsString(kb.Audience, v.Audience) {
+		errs = append(errs, &ClaimError{ClaimAudience, fmt.Errorf("Audiences (%v) don't contain the verifier", kb.Audience)})
+	}
+
+	if nonce, ok, err := kb.stringClaim(ClaimNonce); err != nil {
+		errs = append(errs, &ClaimError{ClaimNonce, err})
+	} else if !ok {
+		errs = append(errs, &ClaimError{ClaimNonce, errors.New("Required claim is missing")})
+	} else if v.Nonce != "" && nonce != v.Nonce {
+		errs = append(errs, &ClaimError{ClaimNonce, errors.New("Nonce doesn't match the verifier's nonce")})
+	}
+
+	expected, err := sdDigest(alg, sd.presentation())
+	if err != nil {
+		return err
+	}
+	if hash, _, err := kb.stringClaim(ClaimSdHash); err != nil {
+		errs = append(errs, &ClaimError{ClaimSdHash, err})
+	} else if subtle.ConstantTimeCompare([]byte(hash), []byte(expected)) != 1 {
+		errs = append(errs, &ClaimError{ClaimSdHash, errors.New("Hash doesn't match the presentation")})
+	}
+
+	return errs.err()
+}
+
+// Replaces the digests of an SD-JWT payload with the disclosed values
+type sdRebuild struct {
+	byDigest map[string]*Disclosure
+	seen     map[string]bool
+	used     int
+}
+
+// Processes an object: its own members first, then the claims disclosed by its _sd digests
+func (r *sdRebuild) object(obj map[string]interface{}) error {
+	for k, e := range obj {
+		if k == ClaimSd {
+			continue
+		}
+		val, err := r.value(e)
+		if err != nil {
+			return err
+		}
+		obj[k] = val
+	}
+
+	raw, ok := obj[ClaimSd]
+	if !ok {
+		return nil
+	}
+	delete(obj, ClaimSd)
+
+	digests, ok := raw.([]interface{})
+	if !ok {
+		return errors.New("SD-JWT _sd claim must be an array of digests")
+	}
+	for _, e := range digests {
+		digest, ok := e.(string)
+		if !ok {
+			return errors.New("SD-JWT _sd claim must be an array of digests")
+		}
+		d, err := r.lookup(digest)
+		if err != nil {
+			return err
+		} else if d == nil {
+			// Undisclosed claim or decoy digest
+			continue
+		} else if d.ArrayElement {
+			return errors.New("Array element disclosure is referenced by an _sd claim")
+		} else if _, ok := obj[d.Name]; ok {
+			return fmt.Errorf("Disclosed claim %s already exists", d.Name)
+		}
+
+		val, err := r.value(d.Value)
+		if err != nil {
+			return err
+		}
+		obj[d.Name] = val
+	}
+
+	return nil
+}
+
+// Processes a value, replacing array elements with their disclosed values and removing undisclosed elements
+func (r *sdRebuild) value(v interface{}) (interface{}, error) {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		return x, r.object(x)
+
+	case []interface{}:
+		elems := make([]interface{}, 0, len(x))
+		for _, e := range x {
+			if digest, ok := sdArrayDigest(e); ok {
+				d, err := r.lookup(digest)
+				if err != nil {
+					return nil, err
+				} else if d == nil {
+					continue
+				} else if !d.ArrayElement {
+					return nil, errors.New("Claim disclosure is referenced as an array element")
+				}
+				e = d.Value
+			}
+
+			val, err := r.value(e)
+			if err != nil {
+				return nil, err
+			}
+			elems = append(elems, val)
+		}
+		return elems, nil
+	}
+
+	return v, nil
+}
+
+// Returns the disclosure with the digest, or nil if it wasn't disclosed. A digest may only be referenced once.
+func (r *sdRebuild) lookup(digest string) (*Disclosure, error) {
+	if r.seen[digest] {
+		return nil, errors.New("SD-JWT contains a digest more than once")
+	}
+	r.seen[digest] = true
+
+	d, ok := r.byDigest[digest]
+	if ok {
+		r.used++
+	}
+	return d, nil
+}
+
+// Returns the digest of an array element that was replaced by {"...": digest}
+func sdArrayDigest(v interface{}) (string, bool) {
+	obj, ok := v.(map[string]interface{})
+	if !ok || len(obj) != 1 {
+		return "", false
+	}
+	digest, ok := obj[sdArrayDigestKey].(string)
+	return digest, ok
+}
+
+// Decodes an SD-JWT payload, returning it and its hash algorithm (_sd_alg, sha-256 by default)
+func sdPayload(data []byte) (map[string]interface{}, string, error) {
+	decoded, err := decodeSdJson(data)
+	if err != nil {
+		return nil, "", err
+	}
+	payload, ok := decoded.(map[string]interface{})
+	if !ok {
+		return nil, "", errors.New("JWT Claim Set must be a JSON object")
+	}
+
+	alg := SdHashSha256
+	if raw, ok := payload[ClaimSdAlg]; ok {
+		if alg, ok = raw.(string); !ok {
+			return nil, "", errors.New("SD-JWT _sd_alg claim must be a string")
+		}
+	}
+	if _, err := sdHash(alg); err != nil {
+		return nil, "", err
+	}
+
+	return payload, alg, nil
+}
+
+// Decodes JSON, keeping numbers as json.Number so that they are re-encoded unchanged
+func decodeSdJson(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	} else if dec.More() {
+		return nil, errors.New("Unexpected data after the JSON value")
+	}
+	return v, nil
+}
+
+// Returns the base64url encoded digest of the value
+func sdDigest(alg string, value string) (string, error) {
+	hash, err := sdHash(alg)
+	if err != nil {
+		return "", err
+	}
+
+	h := hash.New()
+	h.Write([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+func sdHash(alg string) (crypto.Hash, error) {
+	switch alg {
+	case SdHashSha256:
+		return crypto.SHA256, nil
+	case SdHashSha384:
+		return crypto.SHA384, nil
+	case SdHashSha512:
+		return crypto.SHA512, nil
+	}
+	return 0, fmt.Errorf("Unsupported SD-JWT hash algorithm: %s", alg)
+}
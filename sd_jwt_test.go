@@ -0,0 +1,245 @@
+package gose
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Disclosures from https://datatracker.ietf.org/doc/html/draft-ietf-oauth-selective-disclosure-jwt#section-4.2
+var disclosureTestVectors = []struct {
+	encoded      string
+	salt         string
+	name         string
+	value        interface{}
+	arrayElement bool
+	digest       string
+}{
+	{"WyI2cU1RdlJMNWhhaiIsICJmYW1pbHlfbmFtZSIsICJNw7ZiaXVzIl0", "6qMQvRL5haj", "family_name", "Möbius", false,
+		"uutlBuYeMDyjLLTpf6Jxi7yNkEF35jdyWMn9U7b_RYY"},
+	{"WyJsa2x4RjVqTVlsR1RQVW92TU5JdkNBIiwgIkZSIl0", "lklxF5jMYlGTPUovMNIvCA", "", "FR", true,
+		"w0I8EKcdCtUPkGCNUrfwVp2xEgNjtoIDlOxc9-PlOhs"},
+}
+
+func TestParseDisclosure(t *testing.T) {
+	for i, v := range disclosureTestVectors {
+		d, err := ParseDisclosure(v.encoded)
+		if err != nil {
+			t.Errorf("Test %d. Unable to parse disclosure. Err: %v\n", i+1, err)
+			continue
+		}
+		if d.Salt != v.salt || d.Name != v.name || d.Value != v.value || d.ArrayElement != v.arrayElement {
+			t.Errorf("Test %d. Unexpected disclosure: %+v\n", i+1, d)
+		}
+		if digest, err := d.Digest(SdHashSha256); err != nil || digest != v.digest {
+			t.Errorf("Test %d. Expected digest %s, got %s. Err: %v\n", i+1, v.digest, digest, err)
+		}
+	}
+
+	// ["salt", "_sd", "value"]
+	if _, err := ParseDisclosure("WyJzYWx0IiwgIl9zZCIsICJ2YWx1ZSJd"); err == nil {
+		t.Errorf("Disclosure of an _sd claim was accepted\n")
+	}
+}
+
+func newTestSdJwt(t *testing.T) (*SdJwt, *Jwk, *Jwk) {
+	issuerKey := new(Jwk)
+	if err := json.Unmarshal(jwaSignerTestVectors[1].signKeyJson, issuerKey); err != nil {
+		t.Fatalf("Unable to unmarshal key. Err: %v\n", err)
+	}
+	holderKey := new(Jwk)
+	if err := json.Unmarshal(jwaSignerTestVectors[2].signKeyJson, holderKey); err != nil {
+		t.Fatalf("Unable to unmarshal key. Err: %v\n", err)
+	}
+
+	claims := &ClaimSet{
+		Issuer:     "https://issuer.example.com",
+		Subject:    "user_42",
+		Expiration: time.Now().Add(time.Hour),
+		AdditionalClaims: map[string]interface{}{
+			"given_name":    "John",
+			"family_name":   "Doe",
+			"nationalities": []interface{}{"US", "DE"},
+			"address": map[string]interface{}{
+				"street_address": "123 Main St",
+				"locality":       "Anytown",
+				"country":        "US",
+			},
+		},
+	}
+	disclose := []string{"given_name", "family_name", "nationalities.0", "nationalities.1", "address",
+		"address.street_address"}
+
+	sd, err := IssueSdJwt(claims, disclose, issuerKey, &SdJwtOptions{
+		HolderKey:   holderKey,
+		SignOptions: &JwtSignOptions{Algorithm: JwsAlgES256, Type: "example+sd-jwt"},
+	})
+	if err != nil {
+		t.Fatalf("Unable to issue SD-JWT. Err: %v\n", err)
+	}
+
+	return sd, issuerKey, holderKey
+}
+
+func TestIssueSdJwt(t *testing.T) {
+	sd, issuerKey, _ := newTestSdJwt(t)
+
+	if len(sd.Disclosures) != 6 {
+		t.Fatalf("Expected 6 disclosures, got %d\n", len(sd.Disclosures))
+	}
+
+	jwt, err := ParseJwt(sd.Jwt, issuerKey, nil)
+	if err != nil {
+		t.Fatalf("Unable to parse issuer-signed JWT. Err: %v\n", err)
+	}
+	for _, name := range []string{"given_name", "family_name", "address"} {
+		if jwt.Claims.HasClaim(name) {
+			t.Errorf("Selectively disclosable claim %s is in the JWT\n", name)
+		}
+	}
+	if alg, _, _ := jwt.Claims.stringClaim(ClaimSdAlg); alg != SdHashSha256 {
+		t.Errorf("Unexpected _sd_alg: %s\n", alg)
+	}
+	digests, _, _ := jwt.Claims.stringsClaim(ClaimSd)
+	if len(digests) != 3 || !sort.StringsAreSorted(digests) {
+		t.Errorf("Expected 3 sorted digests, got %v\n", digests)
+	}
+
+	// Round trip through the serialization
+	parsed, err := ParseSdJwt(sd.String())
+	if err != nil {
+		t.Fatalf("Unable to parse SD-JWT. Err: %v\n", err)
+	}
+	if parsed.String() != sd.String() || parsed.KeyBinding != "" || !strings.HasSuffix(sd.String(), "~") {
+		t.Errorf("SD-JWT doesn't round trip: %s\n", parsed.String())
+	}
+
+	invalid := []struct {
+		name     string
+		disclose []string
+	}{
+		{"Missing claim", []string{"middle_name"}},
+		{"Missing array element", []string{"nationalities.2"}},
+		{"Issuer", []string{"iss"}},
+		{"Digest claim", []string{"address._sd"}},
+		{"Empty path segment", []string{"address..locality"}},
+		{"Not an object", []string{"given_name.first"}},
+	}
+	for i, v := range invalid {
+		c := &ClaimSet{Issuer: "https://issuer.example.com", AdditionalClaims: map[string]interface{}{
+			"given_name": "John", "nationalities": []interface{}{"US", "DE"}, "address": map[string]interface{}{"locality": "Anytown"},
+		}}
+		if _, err := IssueSdJwt(c, v.disclose, issuerKey, &SdJwtOptions{SignOptions: &JwtSignOptions{Algorithm: JwsAlgES256}}); err == nil {
+			t.Errorf("Test %d (%s). SD-JWT was issued\n", i+1, v.name)
+		}
+	}
+}
+
+func TestSdJwtPresentAndVerify(t *testing.T) {
+	sd, issuerKey, holderKey := newTestSdJwt(t)
+
+	kb := &KeyBindingOptions{Key: holderKey, Algorithm: JwsAlgRS256, Audience: "https://verifier.example.com", Nonce: "n-0S6_WzA2Mj"}
+	verifier := &SdJwtVerifier{RequireKeyBinding: true, Audience: "https://verifier.example.com", Nonce: "n-0S6_WzA2Mj"}
+
+	vectors := []struct {
+		name     string
+		paths    []string
+		expected map[string]interface{}
+	}{
+		{"Nothing disclosed", nil, map[string]interface{}{"nationalities": []interface{}{}}},
+		{"Given name", []string{"given_name"}, map[string]interface{}{"given_name": "John", "nationalities": []interface{}{}}},
+		{"Second nationality", []string{"nationalities.1"}, map[string]interface{}{"nationalities": []interface{}{"DE"}}},
+		{
+			"Address without street",
+			[]string{"address.locality"},
+			map[string]interface{}{"nationalities": []interface{}{}, "address": map[string]interface{}{"locality": "Anytown", "country": "US"}},
+		},
+		{
+			"Street address",
+			[]string{"address.street_address"},
+			map[string]interface{}{"nationalities": []interface{}{}, "address": map[string]interface{}{
+				"street_address": "123 Main St", "locality": "Anytown", "country": "US"}},
+		},
+	}
+
+	for i, v := range vectors {
+		presentation, err := sd.Present(v.paths, kb)
+		if err != nil {
+			t.Errorf("Test %d (%s). Unable to create presentation. Err: %v\n", i+1, v.name, err)
+			continue
+		}
+
+		jwt, err := verifier.Verify(presentation, issuerKey)
+		if err != nil {
+			t.Errorf("Test %d (%s). Unable to verify presentation. Err: %v\n", i+1, v.name, err)
+			continue
+		}
+		if jwt.Claims.Subject != "user_42" || jwt.Header.Type != "example+sd-jwt" {
+			t.Errorf("Test %d (%s). Unexpected JWT: %+v\n", i+1, v.name, jwt)
+		}
+
+		disclosed := make(map[string]interface{})
+		for k, val := range jwt.Claims.AdditionalClaims {
+			if k != ClaimConfirmation {
+				disclosed[k] = val
+			}
+		}
+		if !reflect.DeepEqual(disclosed, v.expected) {
+			t.Errorf("Test %d (%s). Expected claims %v, got %v\n", i+1, v.name, v.expected, disclosed)
+		}
+	}
+}
+
+func TestSdJwtVerifyRejects(t *testing.T) {
+	sd, issuerKey, holderKey := newTestSdJwt(t)
+	kb := &KeyBindingOptions{Key: holderKey, Algorithm: JwsAlgRS256, Audience: "https://verifier.example.com", Nonce: "nonce"}
+
+	all, _ := sd.Present([]string{"given_name", "family_name"}, nil)
+	withKb, _ := sd.Present([]string{"given_name"}, kb)
+	parts := strings.Split(all, "~")
+
+	otherKb := *kb
+	otherKb.Key = issuerKey
+	otherKb.Algorithm = JwsAlgES256
+	wrongKey, _ := sd.Present([]string{"given_name"}, &otherKb)
+
+	oldKb := *kb
+	oldKb.Clock = func() time.Time { return time.Now().Add(-time.Hour) }
+	old, _ := sd.Present([]string{"given_name"}, &oldKb)
+
+	// A Key Binding JWT moved to a presentation with other disclosures
+	moved := all + withKb[strings.LastIndex(withKb, "~")+1:]
+
+	// A disclosure that isn't referenced by the JWT
+	foreign, _ := newDisclosure("given_name", "Mallory", false)
+
+	vectors := []struct {
+		name         string
+		presentation string
+		verifier     *SdJwtVerifier
+	}{
+		{"Duplicate disclosure", parts[0] + "~" + parts[1] + "~" + parts[1] + "~", &SdJwtVerifier{}},
+		{"Unreferenced disclosure", parts[0] + "~" + foreign.Encoded + "~", &SdJwtVerifier{}},
+		{"Tampered disclosure", parts[0] + "~" + parts[1][:len(parts[1])-2] + "fQ~", &SdJwtVerifier{}},
+		{"Missing key binding", all, &SdJwtVerifier{RequireKeyBinding: true}},
+		{"Wrong audience", withKb, &SdJwtVerifier{Audience: "https://other.example.com"}},
+		{"Wrong nonce", withKb, &SdJwtVerifier{Nonce: "other"}},
+		{"Key binding by other key", wrongKey, &SdJwtVerifier{}},
+		{"Old key binding", old, &SdJwtVerifier{}},
+		{"Moved key binding", moved, &SdJwtVerifier{}},
+		{"Not an SD-JWT", parts[0], &SdJwtVerifier{}},
+	}
+
+	for i, v := range vectors {
+		if _, err := v.verifier.Verify(v.presentation, issuerKey); err == nil {
+			t.Errorf("Test %d (%s). Presentation was accepted\n", i+1, v.name)
+		}
+	}
+
+	if _, err := (&SdJwtVerifier{}).Verify(withKb, issuerKey); err != nil {
+		t.Errorf("Valid presentation was rejected. Err: %v\n", err)
+	}
+}
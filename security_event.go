@@ -0,0 +1,353 @@
+package gose
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Security Event Token header types as specified in https://tools.ietf.org/html/rfc8417#section-2.3
+const (
+	SecurityEventType      string = "secevent+jwt"
+	SecurityEventMediaType string = "application/secevent+jwt"
+)
+
+// Security Event Token claim names as specified in https://tools.ietf.org/html/rfc8417#section-2.2, and the subject
+// identifier claim of https://tools.ietf.org/html/rfc9493#section-4
+const (
+	ClaimEvents      string = "events"
+	ClaimTransaction string = "txn"
+	ClaimEventTime   string = "toe"
+	ClaimSubjectId   string = "sub_id"
+)
+
+// Push delivery error codes as specified in https://tools.ietf.org/html/rfc8935#section-2.4
+const (
+	SetErrInvalidRequest       string = "invalid_request"
+	SetErrInvalidKey           string = "invalid_key"
+	SetErrInvalidIssuer        string = "invalid_issuer"
+	SetErrInvalidAudience      string = "invalid_audience"
+	SetErrAuthenticationFailed string = "authentication_failed"
+	SetErrAccessDenied         string = "access_denied"
+)
+
+// Default maximum size of a pushed SET
+const defaultSetMaxBodySize = 64 * 1024
+
+// SecurityEvent is a Security Event Token (SET) as specified in https://tools.ietf.org/html/rfc8417
+type SecurityEvent struct {
+	// Header is the protected header of a parsed SET
+	Header *JwHeader
+	// Claims holds the registered claims (iss, aud, iat, jti) and any additional claims such as txn, toe or sub_id
+	Claims *ClaimSet
+	// Events maps each event type URI to its JSON payload
+	Events map[string]json.RawMessage
+}
+
+// AddEvent JSON encodes the payload and adds it to the events. A nil payload is encoded as an empty object.
+func (s *SecurityEvent) AddEvent(eventType string, payload interface{}) error {
+	data := []byte("{}")
+	if payload != nil {
+		var err error
+		if data, err = json.Marshal(payload); err != nil {
+			return err
+		}
+	}
+
+	if s.Events == nil {
+		s.Events = make(map[string]json.RawMessage)
+	}
+	s.Events[eventType] = data
+
+	return nil
+}
+
+// DecodeEvent JSON decodes the payload of an event into v. An error is returned if the event isn't present.
+func (s *SecurityEvent) DecodeEvent(eventType string, v interface{}) error {
+	payload, ok := s.Events[eventType]
+	if !ok {
+		return fmt.Errorf("SET has no event of type %s", eventType)
+	}
+
+	return json.Unmarshal(payload, v)
+}
+
+// SignSecurityEvent signs the SET with key and returns the compact serialized JWT with typ "secevent+jwt". The issuer
+// and at least one event are required. If not set, iat is set to the current time and jti to a random value. As
+// required by https://tools.ietf.org/html/rfc8417#section-4, SETs can't have an expiration (exp) or nonce, so they
+// can't be confused with access or ID Tokens.
+func SignSecurityEvent(set *SecurityEvent, key *Jwk, opts *JwtSignOptions) (string, error) {
+	c := new(ClaimSet)
+	if set.Claims != nil {
+		*c = *set.Claims
+	}
+
+	if c.Issuer == "" {
+		return "", errors.New("SET issuer (iss) is required")
+	} else if len(set.Events) < 1 {
+		return "", errors.New("SET must contain at least one event")
+	} else if !c.Expiration.IsZero() {
+		return "", errors.New("SET must not have an expiration (exp)")
+	} else if c.HasClaim(ClaimNonce) {
+		return "", errors.New("SET must not have a nonce")
+	}
+
+	c.AdditionalClaims = make(map[string]interface{}, len(c.AdditionalClaims)+1)
+	if set.Claims != nil {
+		for k, v := range set.Claims.AdditionalClaims {
+			c.AdditionalClaims[k] = v
+		}
+	}
+	c.AdditionalClaims[ClaimEvents] = set.Events
+
+	if c.IssuedAt.IsZero() {
+		c.IssuedAt = time.Now()
+	}
+	if c.Id == "" {
+		jti, err := randomJti()
+		if err != nil {
+			return "", err
+		}
+		c.Id = jti
+	}
+
+	o := JwtSignOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	o.Type = SecurityEventType
+
+	return SignJwt(c, key, &o)
+}
+
+// SecurityEventValidator validates SETs (https://tools.ietf.org/html/rfc8417#section-2.2). Set Issuers to the
+// transmitter's issuer and Audiences to the receiver's identifiers. The iss, iat and jti claims are required, and exp
+// is rejected.
+type SecurityEventValidator struct {
+	Validator
+	// EventTypes are the accepted event type URIs. If empty, any event type is accepted.
+	EventTypes []string
+	// AllowSubject accepts SETs with a subject (sub) claim. By default the subject must be identified within the
+	// event payload or by sub_id, so that a SET can't be confused with an access token.
+	AllowSubject bool
+}
+
+// ValidateClaims validates the SET's claims, returning ClaimErrors or nil
+func (v *SecurityEventValidator) ValidateClaims(c *ClaimSet) error {
+	return v.checkReplay(c, v.validateSet(c))
+}
+
+// Validates the SET's claims without recording the jti
+func (v *SecurityEventValidator) validateSet(c *ClaimSet) ClaimErrors {
+	errs := v.Validator.validate(c)
+	errs = v.requireClaims(c, errs, ClaimIssuer, ClaimIssuedAt, ClaimId)
+
+	if !c.Expiration.IsZero() {
+		errs = append(errs, &ClaimError{ClaimExpiration, errors.New("SET must not have an expiration")})
+	}
+	if c.HasClaim(ClaimNonce) {
+		errs = append(errs, &ClaimError{ClaimNonce, errors.New("SET must not have a nonce")})
+	}
+	if c.Subject != "" && !v.AllowSubject {
+		errs = append(errs, &ClaimError{ClaimSubject, errors.New("SET subject (sub) is not accepted")})
+	}
+
+	if _, err := v.events(c); err != nil {
+		errs = append(errs, &ClaimError{ClaimEvents, err})
+	}
+
+	return errs
+}
+
+// Returns the events claim, checking that it is an object of event type URIs to objects
+func (v *SecurityEventValidator) events(c *ClaimSet) (map[string]json.RawMessage, error) {
+	raw, ok := c.AdditionalClaims[ClaimEvents]
+	if !ok {
+		return nil, errors.New("Required claim is missing")
+	}
+
+	obj, ok := raw.(map[string]interface{})
+	if !ok || len(obj) < 1 {
+		return nil, errors.New("Events must be a JSON object with at least one event")
+	}
+
+	events := make(map[string]json.RawMessage, len(obj))
+	for k, e := range obj {
+		if _, ok := e.(map[string]interface{}); !ok {
+			return nil, fmt.Errorf("Event %s must be a JSON object", k)
+		}
+		if len(v.EventTypes) > 0 && !containsString(v.EventTypes, k) {
+			return nil, fmt.Errorf("Event type %s is not accepted", k)
+		}
+
+		data, err := json.Marshal(e)
+		if err != nil {
+			return nil, err
+		}
+		events[k] = data
+	}
+
+	return events, nil
+}
+
+// ParseSecurityEvent parses a compact serialized SET, verifies its signature with the key resolved by ks and validates
+// it with v. JWTs without the "secevent+jwt" type (typ) are rejected.
+func ParseSecurityEvent(token string, ks KeySource, v *SecurityEventValidator, opts ...SignerOption) (*SecurityEvent, error) {
+	set, err := parseSecurityEvent(token, ks, v, opts)
+	if err != nil {
+		return nil, err
+	} else if err := v.checkReplay(set.Claims, nil); err != nil {
+		return nil, err
+	}
+
+	return set, nil
+}
+
+// Parses, verifies and validates a SET like ParseSecurityEvent, without recording its jti
+func parseSecurityEvent(token string, ks KeySource, v *SecurityEventValidator, opts []SignerOption) (*SecurityEvent, error) {
+	if v == nil {
+		return nil, errors.New("A SecurityEventValidator is required to validate a SET")
+	}
+
+	jwt, err := parseJwtPayload(token, ks, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.EqualFold(jwt.Header.Type, SecurityEventType) && !strings.EqualFold(jwt.Header.Type, SecurityEventMediaType) {
+		return nil, fmt.Errorf("JWT type (typ=%s) is not a SET (%s)", jwt.Header.Type, SecurityEventType)
+	}
+
+	claims := new(ClaimSet)
+	if err := claims.UnmarshalJSON(jwt.Payload); err != nil {
+		return nil, err
+	}
+	if err := v.validateSet(claims).err(); err != nil {
+		return nil, err
+	}
+
+	events, err := v.events(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SecurityEvent{Header: jwt.Header, Claims: claims, Events: events}, nil
+}
+
+// SetDeliveryError is a push delivery error (https://tools.ietf.org/html/rfc8935#section-2.3). A SetPushReceiver's
+// Handler can return it to control the error code sent to the transmitter.
+type SetDeliveryError struct {
+	Code        string `json:"err"`
+	Description string `json:"description,omitempty"`
+}
+
+func (e *SetDeliveryError) Error() string {
+	return fmt.Sprintf("SET delivery failed (%s): %s", e.Code, e.Description)
+}
+
+// SetPushReceiver is an http.Handler that receives SETs delivered with HTTP push as specified in
+// https://tools.ietf.org/html/rfc8935. A valid SET is passed to Handler and acknowledged with 202 Accepted. Otherwise
+// 400 Bad Request is returned with a JSON error.
+//
+// If the Validator has a ReplayCache, a SET's jti is only recorded once Handler has processed it, so that the
+// transmitter can redeliver a SET that the Handler failed to process. A SET that is delivered again before it is
+// recorded (e.g. concurrently) is passed to Handler again, so Handler should tolerate duplicates.
+type SetPushReceiver struct {
+	// KeySource resolves the transmitter's key
+	KeySource KeySource
+	// Validator validates received SETs
+	Validator *SecurityEventValidator
+	// Handler processes a valid SET. If it returns a *SetDeliveryError, it is sent to the transmitter; any other
+	// error is sent as access_denied with a generic description, so that internal details aren't disclosed.
+	Handler func(r *http.Request, set *SecurityEvent) error
+	// MaxBodySize is the maximum size of a SET in bytes. Defaults to 64 KiB.
+	MaxBodySize int64
+}
+
+// ServeHTTP implements the http.Handler interface
+func (p *SetPushReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	set, derr := p.receive(r)
+	if derr == nil && p.Handler != nil {
+		if err := p.Handler(r, set); err != nil {
+			if !errors.As(err, &derr) {
+				derr = &SetDeliveryError{SetErrAccessDenied, "The SET was not accepted by the receiver"}
+			}
+		}
+	}
+	if derr == nil {
+		if err := p.Validator.checkReplay(set.Claims, nil); err != nil {
+			derr = &SetDeliveryError{SetErrInvalidRequest, err.Error()}
+		}
+	}
+
+	if derr != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(derr)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// Reads, verifies and validates the pushed SET
+func (p *SetPushReceiver) receive(r *http.Request) (*SecurityEvent, *SetDeliveryError) {
+	if mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mt != SecurityEventMediaType {
+		return nil, &SetDeliveryError{SetErrInvalidRequest, "Content-Type must be " + SecurityEventMediaType}
+	}
+
+	maxSize := p.MaxBodySize
+	if maxSize < 1 {
+		maxSize = defaultSetMaxBodySize
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxSize+1))
+	if err != nil {
+		return nil, &SetDeliveryError{SetErrInvalidRequest, err.Error()}
+	} else if int64(len(body)) > maxSize {
+		return nil, &SetDeliveryError{SetErrInvalidRequest, "SET is too large"}
+	}
+
+	if p.KeySource == nil || p.Validator == nil {
+		return nil, &SetDeliveryError{SetErrInvalidKey, "Receiver is not configured"}
+	}
+
+	// Capture key resolution errors so they can be reported as invalid_key
+	var keyErr error
+	ks := KeySourceFunc(func(hdr *JwHeader) (*Jwk, error) {
+		jwk, err := p.KeySource.ResolveKey(hdr)
+		keyErr = err
+		return jwk, err
+	})
+
+	set, err := parseSecurityEvent(string(body), ks, p.Validator, nil)
+	if err == nil {
+		return set, nil
+	} else if keyErr != nil {
+		return nil, &SetDeliveryError{SetErrInvalidKey, keyErr.Error()}
+	}
+
+	var claimErrs ClaimErrors
+	if errors.As(err, &claimErrs) {
+		for _, v := range claimErrs {
+			switch v.Claim {
+			case ClaimIssuer:
+				return nil, &SetDeliveryError{SetErrInvalidIssuer, v.Error()}
+			case ClaimAudience:
+				return nil, &SetDeliveryError{SetErrInvalidAudience, v.Error()}
+			}
+		}
+	}
+
+	return nil, &SetDeliveryError{SetErrInvalidRequest, err.Error()}
+}
@@ -0,0 +1,223 @@
+package gose
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSessionRevokedEvent = "https://schemas.openid.net/secevent/caep/event-type/session-revoked"
+
+type testSessionRevoked struct {
+	EventTimestamp int64  `json:"event_timestamp"`
+	ReasonAdmin    string `json:"reason_admin,omitempty"`
+}
+
+func newTestSecurityEvent(t *testing.T) (*SecurityEvent, *Jwk) {
+	key := new(Jwk)
+	if err := json.Unmarshal(jwaSignerTestVectors[1].signKeyJson, key); err != nil {
+		t.Fatalf("Unable to unmarshal key. Err: %v\n", err)
+	}
+
+	set := &SecurityEvent{
+		Claims: &ClaimSet{
+			Issuer:   "https://idp.example.com/",
+			Audience: []string{"https://sp.example.com/caep"},
+			AdditionalClaims: map[string]interface{}{
+				ClaimSubjectId: map[string]interface{}{"format": "opaque", "id": "dMTlD|1600802906337.16|16008.16"},
+			},
+		},
+	}
+	if err := set.AddEvent(testSessionRevokedEvent, &testSessionRevoked{1615304991643, "Policy Violation"}); err != nil {
+		t.Fatalf("Unable to add event. Err: %v\n", err)
+	}
+
+	return set, key
+}
+
+func TestSignAndParseSecurityEvent(t *testing.T) {
+	set, key := newTestSecurityEvent(t)
+
+	token, err := SignSecurityEvent(set, key, &JwtSignOptions{Algorithm: JwsAlgES256})
+	if err != nil {
+		t.Fatalf("Unable to sign SET. Err: %v\n", err)
+	}
+
+	v := &SecurityEventValidator{
+		Validator:  Validator{Issuers: []string{"https://idp.example.com/"}, Audiences: []string{"https://sp.example.com/caep"}},
+		EventTypes: []string{testSessionRevokedEvent},
+	}
+	parsed, err := ParseSecurityEvent(token, key, v)
+	if err != nil {
+		t.Fatalf("Unable to parse SET. Err: %v\n", err)
+	}
+	if parsed.Header.Type != SecurityEventType || parsed.Claims.Id == "" || parsed.Claims.IssuedAt.IsZero() {
+		t.Errorf("Unexpected SET: %+v\n", parsed)
+	}
+
+	var event testSessionRevoked
+	if err := parsed.DecodeEvent(testSessionRevokedEvent, &event); err != nil {
+		t.Fatalf("Unable to decode event. Err: %v\n", err)
+	}
+	if event.EventTimestamp != 1615304991643 || event.ReasonAdmin != "Policy Violation" {
+		t.Errorf("Unexpected event: %+v\n", event)
+	}
+	if err := parsed.DecodeEvent("https://example.com/other", &event); err == nil {
+		t.Errorf("Missing event was decoded\n")
+	}
+
+	v.EventTypes = []string{"https://example.com/other"}
+	if _, err := ParseSecurityEvent(token, key, v); err == nil {
+		t.Errorf("SET with an unaccepted event type was parsed\n")
+	}
+
+	// A JWT with the same claims but another type must be rejected
+	jwt, err := SignJwt(parsed.Claims, key, &JwtSignOptions{Algorithm: JwsAlgES256})
+	if err != nil {
+		t.Fatalf("Unable to sign jwt. Err: %v\n", err)
+	}
+	v.EventTypes = nil
+	if _, err := ParseSecurityEvent(jwt, key, v); err == nil {
+		t.Errorf("JWT with typ %s was accepted as a SET\n", JwtType)
+	}
+}
+
+func TestSecurityEventValidator(t *testing.T) {
+	base := func() *ClaimSet {
+		return &ClaimSet{
+			Issuer:   "iss",
+			Id:       "jti",
+			IssuedAt: time.Now(),
+			AdditionalClaims: map[string]interface{}{
+				ClaimEvents: map[string]interface{}{testSessionRevokedEvent: map[string]interface{}{}},
+			},
+		}
+	}
+
+	vectors := []struct {
+		name   string
+		modify func(c *ClaimSet)
+		v      *SecurityEventValidator
+		ok     bool
+	}{
+		{"Valid", func(c *ClaimSet) {}, &SecurityEventValidator{}, true},
+		{"Expiration", func(c *ClaimSet) { c.Expiration = time.Now().Add(time.Hour) }, &SecurityEventValidator{}, false},
+		{"Nonce", func(c *ClaimSet) { c.AdditionalClaims[ClaimNonce] = "n" }, &SecurityEventValidator{}, false},
+		{"Subject", func(c *ClaimSet) { c.Subject = "sub" }, &SecurityEventValidator{}, false},
+		{"Allowed subject", func(c *ClaimSet) { c.Subject = "sub" }, &SecurityEventValidator{AllowSubject: true}, true},
+		{"Missing events", func(c *ClaimSet) { delete(c.AdditionalClaims, ClaimEvents) }, &SecurityEventValidator{}, false},
+		{"Empty events", func(c *ClaimSet) { c.AdditionalClaims[ClaimEvents] = map[string]interface{}{} },
+			&SecurityEventValidator{}, false},
+		{"Event not an object", func(c *ClaimSet) {
+			c.AdditionalClaims[ClaimEvents] = map[string]interface{}{testSessionRevokedEvent: "x"}
+		}, &SecurityEventValidator{}, false},
+		{"Missing jti", func(c *ClaimSet) { c.Id = "" }, &SecurityEventValidator{}, false},
+	}
+
+	for i, v := range vectors {
+		c := base()
+		v.modify(c)
+		if err := v.v.ValidateClaims(c); (err == nil) != v.ok {
+			t.Errorf("Test %d (%s). Unexpected result. Err: %v\n", i+1, v.name, err)
+		}
+	}
+
+	set, key := newTestSecurityEvent(t)
+	set.Claims.Expiration = time.Now()
+	if _, err := SignSecurityEvent(set, key, nil); err == nil {
+		t.Errorf("SET with an expiration was signed\n")
+	}
+}
+
+func TestSetPushReceiver(t *testing.T) {
+	set, key := newTestSecurityEvent(t)
+	token, err := SignSecurityEvent(set, key, &JwtSignOptions{Algorithm: JwsAlgES256, KeyId: "transmitter"})
+	if err != nil {
+		t.Fatalf("Unable to sign SET. Err: %v\n", err)
+	}
+
+	pub := key.Public()
+	pub.Id = "transmitter"
+
+	var received *SecurityEvent
+	failures := map[string]int{"denied": 2, "retried": 1}
+	receiver := &SetPushReceiver{
+		KeySource: &JwkSet{Keys: []*Jwk{pub}},
+		Validator: &SecurityEventValidator{Validator: Validator{
+			Issuers:     []string{"https://idp.example.com/"},
+			MaxAge:      time.Hour,
+			ReplayCache: NewMemoryReplayCache(),
+		}},
+		Handler: func(r *http.Request, set *SecurityEvent) error {
+			if failures[set.Claims.Id] > 0 {
+				failures[set.Claims.Id]--
+				return errors.New("Unable to connect to the session database")
+			}
+			received = set
+			return nil
+		},
+	}
+
+	srv := httptest.NewServer(receiver)
+	defer srv.Close()
+
+	otherIss := *set
+	otherIss.Claims = &ClaimSet{Issuer: "https://other.example.com/"}
+	otherIssToken, _ := SignSecurityEvent(&otherIss, key, &JwtSignOptions{Algorithm: JwsAlgES256, KeyId: "transmitter"})
+	otherKeyToken, _ := SignSecurityEvent(set, key, &JwtSignOptions{Algorithm: JwsAlgES256, KeyId: "unknown"})
+	denied := *set
+	denied.Claims = &ClaimSet{Issuer: "https://idp.example.com/", Id: "denied"}
+	deniedToken, _ := SignSecurityEvent(&denied, key, &JwtSignOptions{Algorithm: JwsAlgES256, KeyId: "transmitter"})
+	retried := *set
+	retried.Claims = &ClaimSet{Issuer: "https://idp.example.com/", Id: "retried"}
+	retriedToken, _ := SignSecurityEvent(&retried, key, &JwtSignOptions{Algorithm: JwsAlgES256, KeyId: "transmitter"})
+
+	vectors := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+		errCode     string
+	}{
+		{"Valid", SecurityEventMediaType, token, http.StatusAccepted, ""},
+		{"Wrong content type", "application/jwt", token, http.StatusBadRequest, SetErrInvalidRequest},
+		{"Malformed", SecurityEventMediaType, "abc", http.StatusBadRequest, SetErrInvalidRequest},
+		{"Wrong issuer", SecurityEventMediaType, otherIssToken, http.StatusBadRequest, SetErrInvalidIssuer},
+		{"Unknown key", SecurityEventMediaType, otherKeyToken, http.StatusBadRequest, SetErrInvalidKey},
+		{"Denied by handler", SecurityEventMediaType, deniedToken, http.StatusBadRequest, SetErrAccessDenied},
+		{"Replay", SecurityEventMediaType, token, http.StatusBadRequest, SetErrInvalidRequest},
+		{"Handler failure", SecurityEventMediaType, retriedToken, http.StatusBadRequest, SetErrAccessDenied},
+		{"Redelivered after handler failure", SecurityEventMediaType, retriedToken, http.StatusAccepted, ""},
+		{"Replay after redelivery", SecurityEventMediaType, retriedToken, http.StatusBadRequest, SetErrInvalidRequest},
+	}
+
+	for i, v := range vectors {
+		resp, err := http.Post(srv.URL, v.contentType, strings.NewReader(v.body))
+		if err != nil {
+			t.Fatalf("Test %d (%s). Request failed. Err: %v\n", i+1, v.name, err)
+		}
+
+		var derr SetDeliveryError
+		if v.status != http.StatusAccepted {
+			json.NewDecoder(resp.Body).Decode(&derr)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != v.status || derr.Code != v.errCode {
+			t.Errorf("Test %d (%s). Expected: %d %s, Got: %d %s (%s)\n", i+1, v.name, v.status, v.errCode,
+				resp.StatusCode, derr.Code, derr.Description)
+		}
+		// Handler errors aren't disclosed to the transmitter
+		if strings.Contains(derr.Description, "database") {
+			t.Errorf("Test %d (%s). Handler error was sent to the transmitter: %s\n", i+1, v.name, derr.Description)
+		}
+	}
+
+	if received == nil || received.Claims.Issuer != "https://idp.example.com/" {
+		t.Errorf("Handler didn't receive the SET\n")
+	}
+}
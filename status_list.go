@@ -0,0 +1,548 @@
+package gose
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Status list token header types as specified in
+// https://datatracker.ietf.org/doc/html/draft-ietf-oauth-status-list#section-5.1
+const (
+	StatusListType      string = "statuslist+jwt"
+	StatusListMediaType string = "application/statuslist+jwt"
+)
+
+// Status list claim names. The status claim is set in referenced tokens, the status_list and ttl claims in status list
+// tokens.
+const (
+	ClaimStatus     string = "status"
+	ClaimStatusList string = "status_list"
+	ClaimTimeToLive string = "ttl"
+)
+
+// Status values as specified in https://datatracker.ietf.org/doc/html/draft-ietf-oauth-status-list#section-7.1
+const (
+	StatusValid     byte = 0x00
+	StatusInvalid   byte = 0x01
+	StatusSuspended byte = 0x02
+)
+
+// Defaults used by the status list fetchers when the corresponding field is not set
+const (
+	defaultStatusListCacheTTL        = 5 * time.Minute
+	defaultStatusListMaxCacheEntries = 100
+	defaultStatusListMaxResponseSize = 1 << 20
+	defaultStatusListMaxSize         = 16 << 20
+	defaultStatusListRequestTimeout  = 10 * time.Second
+)
+
+// StatusList is a list of token statuses, packed into a byte array with Bits (1, 2, 4 or 8) bits per status. The
+// status at index 0 is in the least significant bits of the first byte.
+type StatusList struct {
+	bits   int
+	packed []byte
+}
+
+// NewStatusList returns a status list of size entries, all set to StatusValid. bits must be 1, 2, 4 or 8.
+func NewStatusList(bits int, size int) (*StatusList, error) {
+	if err := checkStatusBits(bits); err != nil {
+		return nil, err
+	} else if size < 0 {
+		return nil, errors.New("Status list size must not be negative")
+	}
+
+	return &StatusList{bits: bits, packed: make([]byte, (size*bits+7)/8)}, nil
+}
+
+// DecodeStatusList decodes the base64url encoded, zlib compressed status list (lst) with bits bits per status
+func DecodeStatusList(bits int, lst string) (*StatusList, error) {
+	if err := checkStatusBits(bits); err != nil {
+		return nil, err
+	}
+
+	compressed, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(lst, "="))
+	if err != nil {
+		return nil, err
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	packed, err := io.ReadAll(io.LimitReader(zr, defaultStatusListMaxSize+1))
+	if err != nil {
+		return nil, err
+	} else if len(packed) > defaultStatusListMaxSize {
+		return nil, fmt.Errorf("Status list exceeds the maximum size of %d bytes", defaultStatusListMaxSize)
+	}
+
+	return &StatusList{bits: bits, packed: packed}, nil
+}
+
+// Bits returns the number of bits per status
+func (l *StatusList) Bits() int {
+	return l.bits
+}
+
+// Len returns the number of statuses in the list. As the list is byte aligned, it may be larger than the size the
+// list was created with.
+func (l *StatusList) Len() int {
+	if l.bits == 0 {
+		return 0
+	}
+	return len(l.packed) * 8 / l.bits
+}
+
+// Get returns the status at the index
+func (l *StatusList) Get(idx int) (byte, error) {
+	if idx < 0 || idx >= l.Len() {
+		return 0, fmt.Errorf("Status list index %d is out of range", idx)
+	}
+
+	pos := idx * l.bits
+	mask := byte(1<<uint(l.bits) - 1)
+	return (l.packed[pos/8] >> uint(pos%8)) & mask, nil
+}
+
+// Set sets the status at the index. The status must fit in the list's bits per status.
+func (l *StatusList) Set(idx int, status byte) error {
+	if idx < 0 || idx >= l.Len() {
+		return fmt.Errorf("Status list index %d is out of range", idx)
+	}
+	mask := byte(1<<uint(l.bits) - 1)
+	if status&^mask != 0 {
+		return fmt.Errorf("Status %d doesn't fit in %d bits", status, l.bits)
+	}
+
+	pos := idx * l.bits
+	shift := uint(pos % 8)
+	l.packed[pos/8] = l.packed[pos/8]&^(mask<<shift) | status<<shift
+	return nil
+}
+
+// Encode returns the zlib compressed, base64url encoded list (lst)
+func (l *StatusList) Encode() (string, error) {
+	var buf bytes.Buffer
+	zw, err := zlib.NewWriterLevel(&buf, zlib.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := zw.Write(l.packed); err != nil {
+		return "", err
+	}
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+type statusListJson struct {
+	Bits int    `json:"bits"`
+	Lst  string `json:"lst"`
+}
+
+// MarshalJSON implements the json.Marshaler interface, encoding the list as the status_list claim value
+func (l *StatusList) MarshalJSON() ([]byte, error) {
+	lst, err := l.Encode()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(&statusListJson{Bits: l.bits, Lst: lst})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface, decoding a status_list claim value
+func (l *StatusList) UnmarshalJSON(data []byte) error {
+	var v statusListJson
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	decoded, err := DecodeStatusList(v.Bits, v.Lst)
+	if err != nil {
+		return err
+	}
+	*l = *decoded
+	return nil
+}
+
+func checkStatusBits(bits int) error {
+	switch bits {
+	case 1, 2, 4, 8:
+		return nil
+	}
+	return fmt.Errorf("Status list bits must be 1, 2, 4 or 8, not %d", bits)
+}
+
+// StatusListReference is the status_list member of a referenced token's status claim. It identifies the token's
+// entry in a status list.
+type StatusListReference struct {
+	// Index is the index of the token's status in the list
+	Index int `json:"idx"`
+	// Uri identifies the status list token. It is the subject of the status list token.
+	Uri string `json:"uri"`
+}
+
+type statusClaim struct {
+	StatusList *StatusListReference `json:"status_list,omitempty"`
+}
+
+// StatusListReference returns the status_list member of the status claim, or nil if the claim set has none
+func (c *ClaimSet) StatusListReference() (*StatusListReference, error) {
+	v, ok := c.AdditionalClaims[ClaimStatus]
+	if !ok {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var status statusClaim
+	if err := json.Unmarshal(data, &status); err != nil {
+		return nil, fmt.Errorf("Invalid status claim: %v", err)
+	} else if status.StatusList == nil {
+		return nil, nil
+	} else if status.StatusList.Uri == "" || status.StatusList.Index < 0 {
+		return nil, errors.New("Status list reference requires a uri and a non-negative idx")
+	}
+
+	return status.StatusList, nil
+}
+
+// SetStatusListReference sets the status claim to reference the token's entry in a status list
+func (c *ClaimSet) SetStatusListReference(ref *StatusListReference) error {
+	if ref == nil {
+		delete(c.AdditionalClaims, ClaimStatus)
+		return nil
+	} else if ref.Uri == "" || ref.Index < 0 {
+		return errors.New("Status list reference requires a uri and a non-negative idx")
+	}
+
+	if c.AdditionalClaims == nil {
+		c.AdditionalClaims = make(map[string]interface{})
+	}
+	c.AdditionalClaims[ClaimStatus] = map[string]interface{}{
+		ClaimStatusList: map[string]interface{}{"idx": ref.Index, "uri": ref.Uri},
+	}
+
+	return nil
+}
+
+// StatusListToken is a status list token as specified in
+// https://datatracker.ietf.org/doc/html/draft-ietf-oauth-status-list#section-5.1
+type StatusListToken struct {
+	// Header is the protected header of a parsed status list token
+	Header *JwHeader
+	// Claims holds the registered claims. The subject (sub) is the URI of the status list, and is required.
+	Claims *ClaimSet
+	// List is the status list
+	List *StatusList
+	// TimeToLive is the maximum time the token may be cached before fetching a fresh copy (ttl). If 0, it isn't set.
+	TimeToLive time.Duration
+}
+
+// SignStatusListToken signs the status list token with key and returns the compact serialized JWT with typ
+// "statuslist+jwt". The subject (the status list URI) is required; iat is set to the current time if not set.
+func SignStatusListToken(slt *StatusListToken, key *Jwk, opts *JwtSignOptions) (string, error) {
+	c := new(ClaimSet)
+	if slt.Claims != nil {
+		*c = *slt.Claims
+	}
+
+	if c.Subject == "" {
+		return "", errors.New("Status list token subject (sub) is required")
+	} else if slt.List == nil {
+		return "", errors.New("Status list token requires a status list")
+	}
+
+	c.AdditionalClaims = make(map[string]interface{}, len(c.AdditionalClaims)+2)
+	if slt.Claims != nil {
+		for k, v := range slt.Claims.AdditionalClaims {
+			c.AdditionalClaims[k] = v
+		}
+	}
+	c.AdditionalClaims[ClaimStatusList] = slt.List
+	if slt.TimeToLive > 0 {
+		c.AdditionalClaims[ClaimTimeToLive] = int64(slt.TimeToLive / time.Second)
+	}
+
+	if c.IssuedAt.IsZero() {
+		c.IssuedAt = time.Now()
+	}
+
+	o := JwtSignOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	o.Type = StatusListType
+
+	return SignJwt(c, key, &o)
+}
+
+// ParseStatusListToken parses a compact serialized status list token, verifies its signature with the key resolved
+// by ks and validates its claims with v. Tokens without the "statuslist+jwt" type (typ) are rejected, and the subject
+// must be uri, the URI the token was fetched from. If v is nil, exp and nbf are checked.
+func ParseStatusListToken(token string, uri string, ks KeySource, v ClaimValidator,
+	opts ...SignerOption) (*StatusListToken, error) {
+
+	jwt, err := parseJwtPayload(token, ks, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.EqualFold(jwt.Header.Type, StatusListType) && !strings.EqualFold(jwt.Header.Type, StatusListMediaType) {
+		return nil, fmt.Errorf("JWT type (typ=%s) is not a status list token (%s)", jwt.Header.Type, StatusListType)
+	}
+
+	claims := new(ClaimSet)
+	if err := claims.UnmarshalJSON(jwt.Payload); err != nil {
+		return nil, err
+	}
+	if v == nil {
+		v = &Validator{}
+	}
+	if err := v.ValidateClaims(claims); err != nil {
+		return nil, err
+	}
+
+	if claims.Subject != uri {
+		return nil, fmt.Errorf("Status list token subject (%s) doesn't match its URI (%s)", claims.Subject, uri)
+	}
+	if claims.IssuedAt.IsZero() {
+		return nil, ClaimErrors{&ClaimError{ClaimIssuedAt, errors.New("Required claim is missing")}}
+	}
+
+	slt := &StatusListToken{Header: jwt.Header, Claims: claims, List: new(StatusList)}
+
+	raw, ok := claims.AdditionalClaims[ClaimStatusList]
+	if !ok {
+		return nil, ClaimErrors{&ClaimError{ClaimStatusList, errors.New("Required claim is missing")}}
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := slt.List.UnmarshalJSON(data); err != nil {
+		return nil, ClaimErrors{&ClaimError{ClaimStatusList, err}}
+	}
+
+	if ttl, ok := claims.AdditionalClaims[ClaimTimeToLive]; ok {
+		seconds, ok := ttl.(float64)
+		if !ok || seconds < 0 {
+			return nil, ClaimErrors{&ClaimError{ClaimTimeToLive, errors.New("Claim ttl must be a positive number")}}
+		}
+		slt.TimeToLive = time.Duration(seconds) * time.Second
+	}
+
+	return slt, nil
+}
+
+// StatusListFetcher fetches and verifies the status list token identified by a URI
+type StatusListFetcher interface {
+	FetchStatusList(uri string) (*StatusListToken, error)
+}
+
+// StatusListFetcherFunc is an adapter to allow the use of an ordinary function as a StatusListFetcher, e.g. to serve
+// status lists from a local store
+type StatusListFetcherFunc func(uri string) (*StatusListToken, error)
+
+func (f StatusListFetcherFunc) FetchStatusList(uri string) (*StatusListToken, error) {
+	return f(uri)
+}
+
+// HttpStatusListFetcher is a StatusListFetcher that fetches status list tokens over HTTPS, as described in
+// https://datatracker.ietf.org/doc/html/draft-ietf-oauth-status-list#section-8. Status list URIs are taken from the
+// referenced tokens, so only URIs whose host is in AllowedHosts, or which are listed in AllowedUrls, are ever fetched
+// and redirects are only followed to allowlisted URIs. Wrap it in a StatusListCache to avoid fetching the list for
+// every referenced token.
+type HttpStatusListFetcher struct {
+	// KeySource resolves the key that verifies status list tokens. It is required.
+	KeySource KeySource
+	// AllowedHosts are the hosts (host or host:port, case-insensitive) status lists may be fetched from
+	AllowedHosts []string
+	// AllowedUrls are individual URIs status lists may be fetched from
+	AllowedUrls []string
+	// Validator validates the status list token's claims. If nil, exp and nbf are checked.
+	Validator ClaimValidator
+	// Client is the HTTP client used for requests. If nil, a client with a 10 second timeout is used.
+	Client *http.Client
+	// MaxResponseSize is the maximum size of a fetched token in bytes. Defaults to 1 MiB.
+	MaxResponseSize int64
+}
+
+// NewHttpStatusListFetcher returns an HttpStatusListFetcher that fetches status lists from the allowed hosts and
+// verifies them with the key resolved by ks
+func NewHttpStatusListFetcher(ks KeySource, allowedHosts ...string) *HttpStatusListFetcher {
+	return &HttpStatusListFetcher{KeySource: ks, AllowedHosts: allowedHosts}
+}
+
+// FetchStatusList implements the StatusListFetcher interface
+func (f *HttpStatusListFetcher) FetchStatusList(uri string) (*StatusListToken, error) {
+	if f.KeySource == nil {
+		return nil, errors.New("HttpStatusListFetcher requires a KeySource")
+	} else if len(f.AllowedHosts) < 1 && len(f.AllowedUrls) < 1 {
+		return nil, errors.New("HttpStatusListFetcher requires the allowed hosts or URLs")
+	}
+
+	maxSize := f.MaxResponseSize
+	if maxSize < 1 {
+		maxSize = defaultStatusListMaxResponseSize
+	}
+	fetcher := &httpsFetcher{
+		name:    "Status list URI",
+		hosts:   f.AllowedHosts,
+		urls:    f.AllowedUrls,
+		client:  f.Client,
+		timeout: defaultStatusListRequestTimeout,
+		maxSize: maxSize,
+	}
+	body, err := fetcher.fetch(uri, StatusListMediaType)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseStatusListToken(string(bytes.TrimSpace(body)), uri, f.KeySource, f.Validator)
+}
+
+// StatusListCache is a StatusListFetcher that caches the status list tokens returned by Fetcher. A token is cached for
+// its ttl, or CacheTTL if it has none, and never past its expiration (exp).
+type StatusListCache struct {
+	// Fetcher fetches status list tokens that aren't cached. It is required.
+	Fetcher StatusListFetcher
+	// CacheTTL is how long tokens without a ttl are cached. Defaults to 5 minutes.
+	CacheTTL time.Duration
+	// MaxCacheEntries is the maximum number of cached tokens. Defaults to 100.
+	MaxCacheEntries int
+	// Clock returns the current time. If nil, time.Now is used.
+	Clock func() time.Time
+
+	cache ttlCache
+}
+
+// NewStatusListCache returns a StatusListCache that caches the tokens returned by fetcher
+func NewStatusListCache(fetcher StatusListFetcher) *StatusListCache {
+	return &StatusListCache{Fetcher: fetcher}
+}
+
+// FetchStatusList implements the StatusListFetcher interface
+func (c *StatusListCache) FetchStatusList(uri string) (*StatusListToken, error) {
+	if c.Fetcher == nil {
+		return nil, errors.New("StatusListCache requires a Fetcher")
+	}
+
+	now := c.now()
+
+	if cached := c.cache.get(uri); cached != nil && now.Before(cached.expires) {
+		return cached.value.(*StatusListToken), nil
+	}
+
+	token, err := c.Fetcher.FetchStatusList(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := token.TimeToLive
+	if ttl <= 0 {
+		ttl = c.CacheTTL
+	}
+	if ttl <= 0 {
+		ttl = defaultStatusListCacheTTL
+	}
+	expires := now.Add(ttl)
+	if exp := token.Claims.Expiration; !exp.IsZero() && exp.Before(expires) {
+		expires = exp
+	}
+
+	maxEntries := c.MaxCacheEntries
+	if maxEntries < 1 {
+		maxEntries = defaultStatusListMaxCacheEntries
+	}
+	c.cache.put(uri, token, now, expires, maxEntries)
+
+	return token, nil
+}
+
+func (c *StatusListCache) now() time.Time {
+	if c.Clock != nil {
+		return c.Clock()
+	}
+	return time.Now()
+}
+
+// StatusListValidator validates a referenced token's claims and checks its status in the status list referenced by
+// the status claim. The status is only fetched if all other claims are valid, so an invalid token never causes a
+// request to the status list's URI.
+type StatusListValidator struct {
+	Validator
+	// Fetcher resolves status list tokens, e.g. a StatusListCache. It is required.
+	Fetcher StatusListFetcher
+	// RequireStatus rejects tokens without a status list reference. By default they are accepted.
+	RequireStatus bool
+	// AcceptedStatuses are the statuses a token may have. Defaults to StatusValid only.
+	AcceptedStatuses []byte
+}
+
+// ValidateClaims validates the claims and the token's status, returning ClaimErrors or nil
+func (v *StatusListValidator) ValidateClaims(c *ClaimSet) error {
+	if v.Fetcher == nil {
+		return errors.New("StatusListValidator requires a Fetcher")
+	}
+
+	errs := v.Validator.validate(c)
+	if len(errs) > 0 {
+		return errs
+	}
+
+	status, ok, err := v.Status(c)
+	if err != nil {
+		errs = append(errs, &ClaimError{ClaimStatus, err})
+	} else if !ok && v.RequireStatus {
+		errs = append(errs, &ClaimError{ClaimStatus, errors.New("Required claim is missing")})
+	} else if ok && !v.accepted(status) {
+		errs = append(errs, &ClaimError{ClaimStatus, fmt.Errorf("Token status (0x%02x) is not accepted", status)})
+	}
+
+	return v.checkReplay(c, errs)
+}
+
+// Status returns the token's status from the status list referenced by its status claim. ok is false if the token
+// has no status list reference. If the token has an issuer, the status list token must have the same issuer.
+func (v *StatusListValidator) Status(c *ClaimSet) (status byte, ok bool, err error) {
+	ref, err := c.StatusListReference()
+	if err != nil || ref == nil {
+		return 0, false, err
+	}
+
+	slt, err := v.Fetcher.FetchStatusList(ref.Uri)
+	if err != nil {
+		return 0, true, err
+	}
+	if c.Issuer != "" && slt.Claims.Issuer != c.Issuer {
+		return 0, true, fmt.Errorf("Status list issuer (%s) doesn't match the token issuer (%s)", slt.Claims.Issuer, c.Issuer)
+	}
+
+	status, err = slt.List.Get(ref.Index)
+	return status, true, err
+}
+
+func (v *StatusListValidator) accepted(status byte) bool {
+	if len(v.AcceptedStatuses) < 1 {
+		return status == StatusValid
+	}
+	for _, s := range v.AcceptedStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,277 @@
+package gose
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Status lists from https://datatracker.ietf.org/doc/html/draft-ietf-oauth-status-list#section-4.1
+var statusListTestVectors = []struct {
+	bits     int
+	lst      string
+	statuses []byte
+}{
+	{1, "eNrbuRgAAhcBXQ", []byte{1, 0, 0, 1, 1, 1, 0, 1, 1, 1, 0, 0, 0, 1, 0, 1}},
+	{2, "eNo76fITAAPfAgc", []byte{1, 2, 0, 3, 0, 1, 0, 1, 1, 2, 3, 3}},
+}
+
+func TestStatusList(t *testing.T) {
+	for i, v := range statusListTestVectors {
+		decoded, err := DecodeStatusList(v.bits, v.lst)
+		if err != nil {
+			t.Errorf("Test %d. Unable to decode status list. Err: %v\n", i+1, err)
+			continue
+		}
+		for idx, status := range v.statuses {
+			if got, err := decoded.Get(idx); err != nil || got != status {
+				t.Errorf("Test %d. Status %d: expected %d, got %d. Err: %v\n", i+1, idx, status, got, err)
+			}
+		}
+
+		// Build the same list and round trip it
+		list, err := NewStatusList(v.bits, len(v.statuses))
+		if err != nil {
+			t.Fatalf("Test %d. Unable to create status list. Err: %v\n", i+1, err)
+		}
+		for idx, status := range v.statuses {
+			if err := list.Set(idx, status); err != nil {
+				t.Errorf("Test %d. Unable to set status %d. Err: %v\n", i+1, idx, err)
+			}
+		}
+		data, err := json.Marshal(list)
+		if err != nil {
+			t.Fatalf("Test %d. Unable to marshal status list. Err: %v\n", i+1, err)
+		}
+		parsed := new(StatusList)
+		if err := json.Unmarshal(data, parsed); err != nil {
+			t.Fatalf("Test %d. Unable to unmarshal status list. Err: %v\n", i+1, err)
+		}
+		if parsed.Bits() != v.bits || string(parsed.packed) != string(decoded.packed) {
+			t.Errorf("Test %d. Round tripped status list doesn't match. Got: %x\n", i+1, parsed.packed)
+		}
+	}
+
+	list, _ := NewStatusList(4, 3)
+	if list.Len() != 4 {
+		t.Errorf("Expected a byte aligned length of 4, got %d\n", list.Len())
+	}
+	if err := list.Set(0, 0x10); err == nil {
+		t.Errorf("Status that doesn't fit in 4 bits was set\n")
+	}
+	if _, err := list.Get(4); err == nil {
+		t.Errorf("Out of range index was accepted\n")
+	}
+	if _, err := NewStatusList(3, 8); err == nil {
+		t.Errorf("Status list with 3 bits per status was created\n")
+	}
+}
+
+func TestClaimSetStatusListReference(t *testing.T) {
+	c := new(ClaimSet)
+	if ref, err := c.StatusListReference(); ref != nil || err != nil {
+		t.Errorf("Expected no reference. Got: %+v, Err: %v\n", ref, err)
+	}
+	if err := c.SetStatusListReference(&StatusListReference{Index: 0}); err == nil {
+		t.Errorf("Reference without uri was set\n")
+	}
+	if err := c.SetStatusListReference(&StatusListReference{Index: 1234, Uri: "https://example.com/statuslists/1"}); err != nil {
+		t.Fatalf("Unable to set reference. Err: %v\n", err)
+	}
+
+	data, _ := json.Marshal(c)
+	parsed := new(ClaimSet)
+	if err := json.Unmarshal(data, parsed); err != nil {
+		t.Fatalf("Unable to unmarshal claims. Err: %v\n", err)
+	}
+	ref, err := parsed.StatusListReference()
+	if err != nil || ref == nil || ref.Index != 1234 || ref.Uri != "https://example.com/statuslists/1" {
+		t.Errorf("Unexpected reference: %+v, Err: %v\n", ref, err)
+	}
+}
+
+func newTestStatusListToken(t *testing.T, uri string) (string, *Jwk) {
+	key := new(Jwk)
+	if err := json.Unmarshal(jwaSignerTestVectors[1].signKeyJson, key); err != nil {
+		t.Fatalf("Unable to unmarshal key. Err: %v\n", err)
+	}
+
+	list, _ := DecodeStatusList(statusListTestVectors[1].bits, statusListTestVectors[1].lst)
+	slt := &StatusListToken{
+		Claims:     &ClaimSet{Issuer: "https://example.com", Subject: uri, Expiration: time.Now().Add(time.Hour)},
+		List:       list,
+		TimeToLive: 10 * time.Minute,
+	}
+	token, err := SignStatusListToken(slt, key, &JwtSignOptions{Algorithm: JwsAlgES256})
+	if err != nil {
+		t.Fatalf("Unable to sign status list token. Err: %v\n", err)
+	}
+
+	return token, key
+}
+
+func TestSignAndParseStatusListToken(t *testing.T) {
+	uri := "https://example.com/statuslists/1"
+	token, key := newTestStatusListToken(t, uri)
+
+	slt, err := ParseStatusListToken(token, uri, key, nil)
+	if err != nil {
+		t.Fatalf("Unable to parse status list token. Err: %v\n", err)
+	}
+	if slt.Header.Type != StatusListType || slt.TimeToLive != 10*time.Minute || slt.Claims.IssuedAt.IsZero() {
+		t.Errorf("Unexpected status list token: %+v\n", slt)
+	}
+	if status, _ := slt.List.Get(3); status != 3 {
+		t.Errorf("Expected status 3, got %d\n", status)
+	}
+
+	if _, err := ParseStatusListToken(token, "https://example.com/statuslists/2", key, nil); err == nil {
+		t.Errorf("Status list token with another subject was accepted\n")
+	}
+
+	jwt, _ := SignJwt(&ClaimSet{Subject: uri, IssuedAt: time.Now()}, key, &JwtSignOptions{Algorithm: JwsAlgES256})
+	if _, err := ParseStatusListToken(jwt, uri, key, nil); err == nil {
+		t.Errorf("JWT without the statuslist+jwt type was accepted\n")
+	}
+
+	if _, err := SignStatusListToken(&StatusListToken{List: slt.List}, key, nil); err == nil {
+		t.Errorf("Status list token without a subject was signed\n")
+	}
+}
+
+func TestHttpStatusListFetcher(t *testing.T) {
+	var uri, token string
+	var key *Jwk
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "https://example.com/statuslists/1", http.StatusFound)
+			return
+		}
+		if r.Header.Get("Accept") != StatusListMediaType {
+			w.WriteHeader(http.StatusNotAcceptable)
+			return
+		}
+		w.Header().Set("Content-Type", StatusListMediaType)
+		w.Write([]byte(token))
+	}))
+	defer srv.Close()
+
+	uri = srv.URL + "/statuslists/1"
+	token, key = newTestStatusListToken(t, uri)
+
+	host := strings.TrimPrefix(srv.URL, "https://")
+	f := &HttpStatusListFetcher{KeySource: key, AllowedHosts: []string{host}, Client: srv.Client()}
+	slt, err := f.FetchStatusList(uri)
+	if err != nil {
+		t.Fatalf("Unable to fetch status list. Err: %v\n", err)
+	}
+	if slt.Claims.Subject != uri {
+		t.Errorf("Unexpected subject: %s\n", slt.Claims.Subject)
+	}
+
+	if _, err := f.FetchStatusList("http://" + host + "/statuslists/1"); err == nil {
+		t.Errorf("Status list was fetched over http\n")
+	}
+	if _, err := f.FetchStatusList("https://example.com/statuslists/1"); err == nil {
+		t.Errorf("Status list was fetched from a host that isn't allowlisted\n")
+	}
+	if _, err := f.FetchStatusList(srv.URL + "/redirect"); err == nil {
+		t.Errorf("Redirect to a host that isn't allowlisted was followed\n")
+	}
+
+	urlOnly := &HttpStatusListFetcher{KeySource: key, AllowedUrls: []string{uri}, Client: srv.Client()}
+	if _, err := urlOnly.FetchStatusList(uri); err != nil {
+		t.Errorf("Unable to fetch allowlisted status list URI. Err: %v\n", err)
+	}
+	if _, err := urlOnly.FetchStatusList(srv.URL + "/statuslists/2"); err == nil {
+		t.Errorf("Status list was fetched from a URI that isn't allowlisted\n")
+	}
+
+	if _, err := (&HttpStatusListFetcher{KeySource: key, Client: srv.Client()}).FetchStatusList(uri); err == nil {
+		t.Errorf("Status list was fetched without an allowlist\n")
+	}
+}
+
+func TestStatusListCache(t *testing.T) {
+	uri := "https://example.com/statuslists/1"
+	token, key := newTestStatusListToken(t, uri)
+
+	fetches := 0
+	fetcher := StatusListFetcherFunc(func(u string) (*StatusListToken, error) {
+		fetches++
+		if u != uri {
+			return nil, errors.New("Unknown status list")
+		}
+		return ParseStatusListToken(token, u, key, nil)
+	})
+
+	now := time.Now()
+	cache := &StatusListCache{Fetcher: fetcher, Clock: func() time.Time { return now }}
+
+	for i := 0; i < 3; i++ {
+		if _, err := cache.FetchStatusList(uri); err != nil {
+			t.Fatalf("Unable to fetch status list. Err: %v\n", err)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("Expected 1 fetch, got %d\n", fetches)
+	}
+
+	// The token is cached for its ttl
+	now = now.Add(11 * time.Minute)
+	cache.FetchStatusList(uri)
+	if fetches != 2 {
+		t.Errorf("Expected the list to be fetched again after its ttl. Fetches: %d\n", fetches)
+	}
+
+	if _, err := cache.FetchStatusList("https://example.com/statuslists/2"); err == nil {
+		t.Errorf("Unknown status list was fetched\n")
+	}
+}
+
+func TestStatusListValidator(t *testing.T) {
+	uri := "https://example.com/statuslists/1"
+	token, key := newTestStatusListToken(t, uri)
+
+	v := &StatusListValidator{
+		Fetcher: NewStatusListCache(StatusListFetcherFunc(func(u string) (*StatusListToken, error) {
+			return ParseStatusListToken(token, u, key, nil)
+		})),
+	}
+
+	// Statuses: 1, 2, 0, 3, ...
+	vectors := []struct {
+		name string
+		iss  string
+		idx  int
+		v    *StatusListValidator
+		ok   bool
+	}{
+		{"Valid", "https://example.com", 2, v, true},
+		{"Invalid", "https://example.com", 0, v, false},
+		{"Suspended", "https://example.com", 1, v, false},
+		{"Suspended accepted", "https://example.com", 1, &StatusListValidator{Fetcher: v.Fetcher, AcceptedStatuses: []byte{StatusValid, StatusSuspended}}, true},
+		{"Out of range", "https://example.com", 1000, v, false},
+		{"Other issuer", "https://other.example.com", 2, v, false},
+	}
+
+	for i, vec := range vectors {
+		c := &ClaimSet{Issuer: vec.iss}
+		c.SetStatusListReference(&StatusListReference{Index: vec.idx, Uri: uri})
+		if err := vec.v.ValidateClaims(c); (err == nil) != vec.ok {
+			t.Errorf("Test %d (%s). Unexpected result. Err: %v\n", i+1, vec.name, err)
+		}
+	}
+
+	if err := v.ValidateClaims(&ClaimSet{}); err != nil {
+		t.Errorf("Token without status was rejected. Err: %v\n", err)
+	}
+	required := &StatusListValidator{Fetcher: v.Fetcher, RequireStatus: true}
+	if err := required.ValidateClaims(&ClaimSet{}); err == nil {
+		t.Errorf("Token without status was accepted\n")
+	}
+}